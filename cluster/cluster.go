@@ -13,6 +13,7 @@ import (
 	"github.com/Jille/raftadmin"
 	"github.com/dihedron/rafter/distributed"
 	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/encryption"
 	"github.com/dihedron/rafter/logging"
 	"github.com/dihedron/rafter/logging/noop"
 	"github.com/hashicorp/raft"
@@ -26,30 +27,50 @@ const (
 	RaftTimeout         = 10 * time.Second
 )
 
+// durable is implemented by the state machines that outlive the process,
+// along with the index of the last entry they applied.
+type durable interface {
+	Durable() bool
+	AppliedIndex() uint64
+}
+
 type Cluster struct {
 	id        string
 	directory string
 	address   Address
 	peers     []Peer
 	bootstrap bool
+	fsm       raft.FSM
 	context   *distributed.Context
+	services  []Service
+	keyring   *encryption.Keyring
 	raft      *raft.Raft
+	store     *raftboltdb.BoltStore
+	logs      raft.LogStore
 	transport *transport.Manager
 	server    *grpc.Server
 	logger    logging.Logger
 }
 
-func New(id string, context *distributed.Context, options ...Option) (*Cluster, error) {
+// New creates a new node replicating the given state machine; if none is
+// given, the node replicates a key/value distributed context. The key/value
+// gRPC service and the leader's housekeeping are only available when the
+// state machine is a distributed context.
+func New(id string, fsm raft.FSM, options ...Option) (*Cluster, error) {
 
 	c := &Cluster{
-		id:      id,
-		peers:   []Peer{},
-		logger:  &noop.Logger{},
-		context: context,
+		id:     id,
+		peers:  []Peer{},
+		logger: &noop.Logger{},
+		fsm:    fsm,
 	}
 	for _, option := range options {
 		option(c)
 	}
+	if c.fsm == nil {
+		c.fsm = distributed.NewContext(c.logger)
+	}
+	c.context, _ = c.fsm.(*distributed.Context)
 
 	// initialise the Raft cluster
 	if err := os.MkdirAll(c.directory, 0700); err != nil {
@@ -65,18 +86,38 @@ func New(id string, context *distributed.Context, options ...Option) (*Cluster,
 	}
 
 	// create the BoltDB instance for both log store and stable store
-	boltDB, err := raftboltdb.NewBoltStore(filepath.Join(c.directory, "raft.db"))
+	c.store, err = raftboltdb.NewBoltStore(filepath.Join(c.directory, "raft.db"))
 	if err != nil {
 		c.logger.Error("error creating BoltDB store: %v", err)
 		return nil, fmt.Errorf("error creating new BoltDB store: %w", err)
 	}
+	c.logs = c.store
+	if c.keyring != nil {
+		c.logs = encryption.NewLogStore(c.store, c.keyring)
+	}
 
 	c.transport = transport.New(raft.ServerAddress(c.address.String()), []grpc.DialOption{grpc.WithInsecure()})
 
 	config := raft.DefaultConfig()
 	config.LocalID = raft.ServerID(c.id)
 	config.SnapshotThreshold = 64
-	c.raft, err = raft.NewRaft(config, c.context, boltDB, boltDB, snapshots, c.transport.Transport())
+	if fsm, ok := c.fsm.(durable); ok && fsm.Durable() {
+		// the state machine already holds the state as of its last applied
+		// entry, and skips the entries it has already applied; the entries
+		// up to the latest snapshot are not replayed, so the snapshot must
+		// still be restored unless the state machine has applied them all,
+		// e.g. because its file is new or was lost
+		snapshot := uint64(0)
+		if metas, err := snapshots.List(); err != nil {
+			c.logger.Error("error listing snapshots: %v", err)
+			return nil, fmt.Errorf("error listing snapshots: %w", err)
+		} else if len(metas) > 0 {
+			snapshot = metas[0].Index
+		}
+		config.NoSnapshotRestoreOnStart = fsm.AppliedIndex() >= snapshot
+		c.logger.Info("state machine applied up to index %d, latest snapshot at %d (restore: %t)", fsm.AppliedIndex(), snapshot, !config.NoSnapshotRestoreOnStart)
+	}
+	c.raft, err = raft.NewRaft(config, c.fsm, c.logs, c.store, snapshots, c.transport.Transport())
 	if err != nil {
 		c.logger.Error("error creating new raft cluster: %v", err)
 		return nil, fmt.Errorf("error creating new Raft cluster: %w", err)
@@ -123,7 +164,12 @@ func (c *Cluster) StartRPCServer() error {
 	c.logger.Debug("TCP address %s available", c.address.String())
 	// start the gRPC server
 	c.server = grpc.NewServer()
-	proto.RegisterContextServer(c.server, distributed.NewRPCInterface(c.context, c.raft, c.logger))
+	if c.context != nil {
+		proto.RegisterContextServer(c.server, distributed.NewRPCInterface(c.context, c.raft, c.logger))
+	}
+	for _, service := range c.services {
+		service(c.server, c.raft)
+	}
 	c.transport.Register(c.server)
 	leaderhealth.Setup(c.raft, c.server, []string{"quis.RaftLeader"})
 	raftadmin.Register(c.server, c.raft)
@@ -146,6 +192,57 @@ func (c *Cluster) StopRPCServer() {
 	c.server.GracefulStop()
 }
 
+// ExpireLeases commits the expiry of the leases whose time to live has
+// elapsed; it must only be called on the leader, and does nothing unless
+// the state machine is a distributed context.
+func (c *Cluster) ExpireLeases() error {
+	if c.context == nil {
+		return nil
+	}
+	return distributed.ExpireLeases(c.context, c.raft, c.logger)
+}
+
+// RequeueItems commits the return to their queues of the items whose
+// visibility timeout has elapsed; it must only be called on the leader,
+// and does nothing unless the state machine is a distributed context.
+func (c *Cluster) RequeueItems() error {
+	if c.context == nil {
+		return nil
+	}
+	return distributed.RequeueItems(c.context, c.raft, c.logger)
+}
+
+// CompactRevisions commits the compaction of the revisions older than the
+// retention window; it must only be called on the leader, and does nothing
+// unless the state machine is a distributed context.
+func (c *Cluster) CompactRevisions() error {
+	if c.context == nil {
+		return nil
+	}
+	return distributed.CompactRevisions(c.context, c.raft, c.logger)
+}
+
+// DropAbandonedImports commits the removal of the keys staged by imports
+// that are no longer in progress; it must only be called on the leader, and
+// does nothing unless the state machine is a distributed context.
+func (c *Cluster) DropAbandonedImports() error {
+	if c.context == nil {
+		return nil
+	}
+	return distributed.DropAbandonedImports(c.context, c.raft, c.logger)
+}
+
+// FSM returns the state machine replicated by the node.
+func (c *Cluster) FSM() raft.FSM {
+	return c.fsm
+}
+
+// Raft returns the node's Raft instance, e.g. to apply commands to a
+// custom state machine.
+func (c *Cluster) Raft() *raft.Raft {
+	return c.raft
+}
+
 type NodeState uint8
 
 const (
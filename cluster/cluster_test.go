@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+)
+
+// tally is a state machine counting the entries applied to it.
+type tally struct {
+	mtx   sync.Mutex
+	count int
+}
+
+func (f *tally) Apply(l *raft.Log) interface{} {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.count++
+	return f.count
+}
+
+func (f *tally) Snapshot() (raft.FSMSnapshot, error) {
+	return nil, raft.ErrNothingNewToSnapshot
+}
+
+func (f *tally) Restore(r io.ReadCloser) error {
+	return r.Close()
+}
+
+func TestCustomFSM(t *testing.T) {
+	socket, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("error finding a free port: %v", err)
+	}
+	address := socket.Addr().String()
+	socket.Close()
+	fsm := &tally{}
+	registered := false
+	c, err := New("n1", fsm,
+		WithDirectory(t.TempDir()),
+		WithNetAddress(address),
+		WithBootstrap(true),
+		WithService(func(server *grpc.Server, r *raft.Raft) { registered = r != nil }),
+		WithLogger(test.NewLogger(t)),
+	)
+	if err != nil {
+		t.Fatalf("error creating node: %v", err)
+	}
+	defer c.Raft().Shutdown()
+	if err := c.StartRPCServer(); err != nil {
+		t.Fatalf("error starting gRPC server: %v", err)
+	}
+	defer c.StopRPCServer()
+	if !registered {
+		t.Errorf("expected extra service to be registered with the Raft instance")
+	}
+	if c.FSM() != fsm {
+		t.Errorf("expected the node to replicate the given state machine")
+	}
+	for deadline := time.Now().Add(10 * time.Second); c.Raft().State() != raft.Leader; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("node not elected leader")
+		}
+	}
+	f := c.Raft().Apply([]byte("x"), time.Second)
+	if err := f.Error(); err != nil {
+		t.Fatalf("error applying entry: %v", err)
+	}
+	if count := f.Response(); count != 1 {
+		t.Errorf("expected the entry to reach the state machine, got %v", count)
+	}
+	// the housekeeping of distributed contexts does not apply
+	for name, housekeeping := range map[string]func() error{
+		"leases":    c.ExpireLeases,
+		"queues":    c.RequeueItems,
+		"revisions": c.CompactRevisions,
+		"imports":   c.DropAbandonedImports,
+	} {
+		if err := housekeeping(); err != nil {
+			t.Errorf("%s: expected no housekeeping, got %v", name, err)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package cluster
 
 import (
+	"github.com/dihedron/rafter/encryption"
 	"github.com/dihedron/rafter/logging"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
 )
 
 // Option is the type for functional options.
 type Option func(*Cluster)
 
+// Service registers a gRPC service on the node's server; it is given the
+// node's Raft instance, so that the service can apply commands to the
+// replicated state machine.
+type Service func(server *grpc.Server, r *raft.Raft)
+
 func WithBootstrap(value bool) Option {
 	return func(c *Cluster) {
 		c.bootstrap = value
@@ -48,6 +56,22 @@ func WithPeers(peers ...Peer) Option {
 	}
 }
 
+// WithService registers an additional gRPC service on the node's server,
+// alongside the Raft transport, leader health and admin services.
+func WithService(service Service) Option {
+	return func(c *Cluster) {
+		c.services = append(c.services, service)
+	}
+}
+
+// WithKeyring encrypts the data of the entries in the Raft log with the
+// given keyring; snapshots are encrypted by the state machine.
+func WithKeyring(keyring *encryption.Keyring) Option {
+	return func(c *Cluster) {
+		c.keyring = keyring
+	}
+}
+
 // WithLogger specifies a logger.
 func WithLogger(logger logging.Logger) Option {
 	return func(c *Cluster) {
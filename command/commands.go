@@ -4,6 +4,7 @@ import (
 	"github.com/dihedron/rafter/command/administration"
 	"github.com/dihedron/rafter/command/data"
 	"github.com/dihedron/rafter/command/run"
+	"github.com/dihedron/rafter/command/snapshot"
 )
 
 // Commands is the set of root command groups.
@@ -13,4 +14,6 @@ type Commands struct {
 	Data data.Data `command:"data" alias:"d" description:"Manage data in the cluster."`
 
 	Administration administration.Administration `command:"administration" alias:"admin" alias:"a" description:"Run command against the cluster."`
+
+	Snapshot snapshot.Snapshot `command:"snapshot" alias:"s" description:"Manage the snapshots of a stopped node."`
 }
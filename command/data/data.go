@@ -1,14 +1,86 @@
 package data
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/dihedron/grpc-multi-resolver"
 	"github.com/dihedron/rafter/cluster"
 	"github.com/dihedron/rafter/command/base"
+	"github.com/dihedron/rafter/distributed"
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging"
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/health"
+)
+
+const (
+	// leaderServiceConfig sends the calls to the leader, as told by the
+	// health of the nodes.
+	leaderServiceConfig = `{"healthCheckConfig": {"serviceName": "quis.RaftLeader"}, "loadBalancingConfig": [ { "round_robin": {} } ]}`
+	// anyServiceConfig spreads the calls over all the nodes.
+	anyServiceConfig = `{"loadBalancingConfig": [ { "round_robin": {} } ]}`
 )
 
+// session numbers the requests of the process, so that the cluster applies
+// each of them only once however many times it is retried; it is shared by
+// all connections, so that the process is a single client of the cluster.
+var session = distributed.NewSession()
+
 type Base struct {
 	base.Base
 
 	Peers []cluster.Peer `short:"p" long:"peer" description:"The address of a peer node in the cluster to join" required:"yes"`
+
+	Namespace string `short:"n" long:"namespace" description:"The namespace of the keys" optional:"yes" default:"default"`
+}
+
+// Dial connects to the leader of the cluster through the peers.
+func (cmd *Base) Dial(logger logging.Logger) (*grpc.ClientConn, error) {
+	return cmd.dial(logger, leaderServiceConfig)
+}
+
+// DialRead connects to the nodes that can serve reads at the given
+// consistency level, and returns the level to ask for: stale reads can be
+// served by any node, the others only by the leader.
+func (cmd *Base) DialRead(logger logging.Logger, level string) (*grpc.ClientConn, proto.Consistency, error) {
+	switch level {
+	case "leader-local":
+		conn, err := cmd.dial(logger, leaderServiceConfig)
+		return conn, proto.Consistency_LEADER_LOCAL, err
+	case "stale":
+		conn, err := cmd.dial(logger, anyServiceConfig)
+		return conn, proto.Consistency_STALE, err
+	}
+	conn, err := cmd.dial(logger, leaderServiceConfig)
+	return conn, proto.Consistency_LINEARIZABLE, err
+}
+
+// dial connects to the peers; unary calls are numbered by the session and
+// retried. The first interceptor of a chain is the outermost, so the session
+// numbers each call once and all its retries carry the same number.
+func (cmd *Base) dial(logger logging.Logger, serviceConfig string) (*grpc.ClientConn, error) {
+	retryOpts := []grpc_retry.CallOption{
+		grpc_retry.WithBackoff(grpc_retry.BackoffExponential(100 * time.Millisecond)),
+		grpc_retry.WithMax(5),
+	}
+	peers := []string{}
+	for _, peer := range cmd.Peers {
+		peers = append(peers, peer.Address.String())
+	}
+	address := fmt.Sprintf("multi:///%s", strings.Join(peers, ","))
+	logger.Info("connecting to %s", address)
+	conn, err := grpc.Dial(address,
+		grpc.WithDefaultServiceConfig(serviceConfig), grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+		grpc.WithChainUnaryInterceptor(session.UnaryClientInterceptor(), grpc_retry.UnaryClientInterceptor(retryOpts...)))
+	if err != nil {
+		logger.Error("dialing failed: %v", err)
+		return nil, err
+	}
+	return conn, nil
 }
 
 // Log is the set of distributed log related commands.
@@ -17,9 +89,36 @@ type Data struct {
 
 	Get Get `command:"get" alias:"g" description:"Get a value from a distributed log."`
 
+	Range Range `command:"range" alias:"r" description:"Read the keys in a range from the distributed log."`
+
+	History History `command:"history" alias:"h" description:"List the past values of a key in the distributed log."`
+
+	Compact Compact `command:"compact" alias:"c" description:"Drop the past values of keys older than an index."`
+
+	Incr Incr `command:"incr" alias:"i" description:"Atomically increment or decrement a counter in the distributed log."`
+
+	Seq Seq `command:"seq" alias:"q" description:"Reserve a block of unique identifiers from a sequence in the distributed log."`
+
 	Benchmark Benchmark `command:"benchmark" alias:"b" description:"Benchmark the speed of the distributed log."`
 
+	Namespace Namespace `command:"namespace" alias:"ns" description:"Create, drop or list the namespaces in the distributed log."`
+
+	Schema Schema `command:"schema" alias:"sc" description:"Set, drop or list the schemas of the values of keys by prefix."`
+
+	Export Export `command:"export" alias:"ex" description:"Export the keys in the distributed log to a JSON Lines or YAML file."`
+
+	Import Import `command:"import" alias:"im" description:"Import the keys in a JSON Lines or YAML file into the distributed log."`
+
 	// Join Join `command:"join" alias:"j" description:"Join a node to the cluster."`
 
 	// Leave Leave `command:"leave" alias:"l" description:"Leave a node to the cluster."`
 }
+
+// describe formats the metadata of a key.
+func describe(metadata *proto.KeyMetadata) string {
+	s := fmt.Sprintf("created: %d, modified: %d, version: %d, size: %d", metadata.CreateIndex, metadata.ModIndex, metadata.Version, metadata.Size)
+	if metadata.Lease != 0 {
+		s += fmt.Sprintf(", lease: %d", metadata.Lease)
+	}
+	return s
+}
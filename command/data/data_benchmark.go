@@ -4,18 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/dihedron/grpc-multi-resolver"
 	"github.com/dihedron/rafter/command/data/random"
 	proto "github.com/dihedron/rafter/distributed/proto"
 	"github.com/dihedron/rafter/logging/console"
-	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
 	"github.com/montanaflynn/stats"
-	"google.golang.org/grpc"
-	_ "google.golang.org/grpc/health"
 )
 
 type Benchmark struct {
@@ -24,6 +19,7 @@ type Benchmark struct {
 	Iterations  int    `short:"i" long:"iterations" description:"The number of distinct values to set during the benchmark" optional:"yes" default:"1000"`
 	Concurrency int    `short:"c" long:"concurrency" description:"The number of goroutines to run in parallel" optional:"yes" default:"10"`
 	Length      int    `short:"l" long:"length" description:"The length of the random values to set in the benchmark" optional:"yes" default:"16"`
+	Batch       int    `short:"b" long:"batch" description:"The number of values to set in each request; above 1, values are set with batch requests on as many keys" optional:"yes" default:"1"`
 	Verbose     bool   `short:"v" long:"verbose" description:"Whether to produce verbose output" optional:"yes"`
 }
 
@@ -34,28 +30,25 @@ func (cmd *Benchmark) Execute(args []string) error {
 	logger := console.NewLogger(console.StdOut)
 	// defer cmd.ProfileCPU(logger).Close()
 
-	serviceConfig := `{"healthCheckConfig": {"serviceName": "quis.RaftLeader"}, "loadBalancingConfig": [ { "round_robin": {} } ]}`
-	retryOpts := []grpc_retry.CallOption{
-		grpc_retry.WithBackoff(grpc_retry.BackoffExponential(100 * time.Millisecond)),
-		grpc_retry.WithMax(5),
-	}
-	peers := []string{}
-	for _, peer := range cmd.Peers {
-		peers = append(peers, peer.Address.String())
-	}
-	address := fmt.Sprintf("multi:///%s", strings.Join(peers, ","))
-	logger.Info("connecting to %s", address)
-	conn, err := grpc.Dial(address,
-		grpc.WithDefaultServiceConfig(serviceConfig), grpc.WithInsecure(),
-		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
-		grpc.WithUnaryInterceptor(grpc_retry.UnaryClientInterceptor(retryOpts...)))
+	conn, err := cmd.Dial(logger)
 	if err != nil {
-		logger.Error("dialing failed: %v", err)
 		return err
 	}
 	defer conn.Close()
 	c := proto.NewContextClient(conn)
 
+	if cmd.Batch < 1 {
+		return fmt.Errorf("invalid batch size: %d", cmd.Batch)
+	}
+	// batched values go to distinct keys, which are reused across batches
+	keys := []string{cmd.Key}
+	if cmd.Batch > 1 {
+		keys = make([]string, 0, cmd.Batch)
+		for i := 0; i < cmd.Batch; i++ {
+			keys = append(keys, fmt.Sprintf("%s/%d", cmd.Key, i))
+		}
+	}
+
 	ch := generateWords(cmd.Iterations, cmd.Length)
 
 	var wg sync.WaitGroup
@@ -65,9 +58,29 @@ func (cmd *Benchmark) Execute(args []string) error {
 		go func(goroutine int) {
 			defer wg.Done()
 			ts := []time.Duration{}
+			if cmd.Batch > 1 {
+				for items := nextBatch(ch, keys); len(items) > 0; items = nextBatch(ch, keys) {
+					start := time.Now()
+					_, err := c.MultiSet(context.Background(), &proto.MultiSetRequest{Namespace: cmd.Namespace, Items: items})
+					elapsed := time.Since(start)
+					ts = append(ts, elapsed)
+					if err != nil {
+						logger.Error("[%d] MultiSet RPC failed: %v", goroutine, err)
+						os.Exit(1)
+					}
+					if cmd.Verbose {
+						logger.Info("[%d] Setting %d values took %s", goroutine, len(items), elapsed)
+					}
+				}
+				data := stats.LoadRawData(ts)
+				mean, _ := data.Mean()
+				stddev, _ := data.StandardDeviation()
+				logger.Info("[%d] Stats: count: %d batches, mean %s, std dev: %s", goroutine, len(ts), time.Duration(mean), time.Duration(stddev))
+				return
+			}
 			for w := range ch {
 				start := time.Now()
-				_, err := c.Set(context.Background(), &proto.SetRequest{Key: cmd.Key, Value: []byte(w)})
+				_, err := c.Set(context.Background(), &proto.SetRequest{Namespace: cmd.Namespace, Key: cmd.Key, Value: []byte(w)})
 				elapsed := time.Since(start)
 				ts = append(ts, elapsed)
 				if err != nil {
@@ -89,15 +102,28 @@ func (cmd *Benchmark) Execute(args []string) error {
 		}(i)
 	}
 	wg.Wait()
-	_, err = c.Get(context.Background(), &proto.GetRequest{Key: cmd.Key})
-	if err != nil {
-		logger.Error("Get RPC failed: %v", err)
-		os.Exit(1)
-	}
-	_, err = c.Remove(context.Background(), &proto.RemoveRequest{Key: cmd.Key})
-	if err != nil {
-		logger.Error("Remove RPC failed: %v", err)
-		os.Exit(1)
+	if cmd.Batch > 1 {
+		_, err = c.MultiGet(context.Background(), &proto.MultiGetRequest{Namespace: cmd.Namespace, Keys: keys})
+		if err != nil {
+			logger.Error("MultiGet RPC failed: %v", err)
+			os.Exit(1)
+		}
+		_, err = c.MultiRemove(context.Background(), &proto.MultiRemoveRequest{Namespace: cmd.Namespace, Keys: keys})
+		if err != nil {
+			logger.Error("MultiRemove RPC failed: %v", err)
+			os.Exit(1)
+		}
+	} else {
+		_, err = c.Get(context.Background(), &proto.GetRequest{Namespace: cmd.Namespace, Key: cmd.Key})
+		if err != nil {
+			logger.Error("Get RPC failed: %v", err)
+			os.Exit(1)
+		}
+		_, err = c.Remove(context.Background(), &proto.RemoveRequest{Namespace: cmd.Namespace, Key: cmd.Key})
+		if err != nil {
+			logger.Error("Remove RPC failed: %v", err)
+			os.Exit(1)
+		}
 	}
 	elapsed := time.Since(start)
 	logger.Info("[FINAL] Benchmark run took %s", elapsed)
@@ -105,6 +131,20 @@ func (cmd *Benchmark) Execute(args []string) error {
 	return nil
 }
 
+// nextBatch takes up to as many values as there are keys off the channel,
+// and pairs them with the keys.
+func nextBatch(ch <-chan string, keys []string) []*proto.KeyValue {
+	items := make([]*proto.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		w, ok := <-ch
+		if !ok {
+			break
+		}
+		items = append(items, &proto.KeyValue{Key: key, Value: []byte(w)})
+	}
+	return items
+}
+
 func generateWords(number int, length int) <-chan string {
 	ch := make(chan string, 1)
 	go func() {
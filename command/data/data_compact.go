@@ -0,0 +1,37 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Compact drops the revisions of all keys superseded before an index.
+type Compact struct {
+	Base
+	Revision uint64 `short:"r" long:"revision" description:"The index up to which revisions are compacted" required:"yes"`
+}
+
+func (cmd *Compact) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	conn, err := cmd.Dial(logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	response, err := c.Compact(context.Background(), &proto.CompactRequest{Revision: cmd.Revision})
+	if err != nil {
+		log.Fatalf("Compact RPC failed: %v", err)
+		return err
+	}
+	fmt.Printf("revisions compacted up to index %d (index: %d)\n", cmd.Revision, response.Index)
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Export writes the keys of a namespace, or of all namespaces, to the file
+// given as argument, or to the standard output, as JSON Lines or YAML.
+type Export struct {
+	Base
+	Prefix        string `short:"x" long:"prefix" description:"The prefix of the keys to export" optional:"yes"`
+	AllNamespaces bool   `short:"A" long:"all-namespaces" description:"Export the keys of all namespaces" optional:"yes"`
+	Format        string `short:"f" long:"format" description:"The format of the export (by default, as told by the extension of the file, or JSON Lines)" optional:"yes" choice:"jsonl" choice:"yaml"`
+	Consistency   string `short:"c" long:"consistency" description:"The consistency level of the read" optional:"yes" choice:"linearizable" choice:"leader-local" choice:"stale" default:"linearizable"`
+}
+
+func (cmd *Export) Execute(args []string) error {
+
+	// the keys may be written to the standard output
+	logger := console.NewLogger(console.StdErr)
+	defer cmd.ProfileCPU(logger).Close()
+
+	if len(args) > 1 {
+		return fmt.Errorf("invalid command line format: use 'export [<file>]'")
+	}
+
+	conn, consistency, err := cmd.DialRead(logger, cmd.Consistency)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+
+	var output io.Writer = os.Stdout
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+		file, err := os.Create(path)
+		if err != nil {
+			logger.Error("error creating export file '%s': %v", path, err)
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	w := bufio.NewWriter(output)
+	format := formatOf(cmd.Format, path)
+
+	stream, err := c.Export(context.Background(), &proto.ExportRequest{
+		Namespace:     cmd.Namespace,
+		Prefix:        cmd.Prefix,
+		Consistency:   consistency,
+		AllNamespaces: cmd.AllNamespaces,
+	})
+	if err != nil {
+		logger.Error("Export RPC failed: %v", err)
+		return err
+	}
+	var count, index uint64
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logger.Error("Export RPC failed after %d keys: %v", count, err)
+			return err
+		}
+		if err := writeRecord(w, format, newRecord(response.Namespace, response.Key, response.Value)); err != nil {
+			logger.Error("error writing export: %v", err)
+			return err
+		}
+		count++
+		index = response.Index
+	}
+	if err := w.Flush(); err != nil {
+		logger.Error("error writing export: %v", err)
+		return err
+	}
+	logger.Info("%d keys exported (index: %d)", count, index)
+	cmd.ProfileMemory(logger)
+	return nil
+}
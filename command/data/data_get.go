@@ -4,20 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
-	"time"
 
-	_ "github.com/dihedron/grpc-multi-resolver"
 	proto "github.com/dihedron/rafter/distributed/proto"
 	"github.com/dihedron/rafter/logging/console"
-	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
-	"google.golang.org/grpc"
-	_ "google.golang.org/grpc/health"
 )
 
 type Get struct {
 	Base
-	Key string `short:"k" long:"key" description:"The key to set/replace" required:"yes"`
+	Key         string `short:"k" long:"key" description:"The key to set/replace" required:"yes"`
+	Consistency string `short:"c" long:"consistency" description:"The consistency level of the read" optional:"yes" choice:"linearizable" choice:"leader-local" choice:"stale" default:"linearizable"`
+	Revision    uint64 `short:"r" long:"revision" description:"The index to read the key at (the latest if not specified)" optional:"yes"`
+	Metadata    bool   `short:"m" long:"metadata" description:"Also print the metadata of the key" optional:"yes"`
 }
 
 func (cmd *Get) Execute(args []string) error {
@@ -25,33 +22,21 @@ func (cmd *Get) Execute(args []string) error {
 	logger := console.NewLogger(console.StdOut)
 	defer cmd.ProfileCPU(logger).Close()
 
-	serviceConfig := `{"healthCheckConfig": {"serviceName": "quis.RaftLeader"}, "loadBalancingConfig": [ { "round_robin": {} } ]}`
-	retryOpts := []grpc_retry.CallOption{
-		grpc_retry.WithBackoff(grpc_retry.BackoffExponential(100 * time.Millisecond)),
-		grpc_retry.WithMax(5),
-	}
-	peers := []string{}
-	for _, peer := range cmd.Peers {
-		peers = append(peers, peer.Address.String())
-	}
-	address := fmt.Sprintf("multi:///%s", strings.Join(peers, ","))
-	logger.Info("connecting to %s", address)
-	conn, err := grpc.Dial(address,
-		grpc.WithDefaultServiceConfig(serviceConfig), grpc.WithInsecure(),
-		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
-		grpc.WithUnaryInterceptor(grpc_retry.UnaryClientInterceptor(retryOpts...)))
+	conn, consistency, err := cmd.DialRead(logger, cmd.Consistency)
 	if err != nil {
-		logger.Error("dialing failed: %v", err)
 		return err
 	}
 	defer conn.Close()
 	c := proto.NewContextClient(conn)
-	response, err := c.Get(context.Background(), &proto.GetRequest{Key: cmd.Key})
+	response, err := c.Get(context.Background(), &proto.GetRequest{Namespace: cmd.Namespace, Key: cmd.Key, Consistency: consistency, Revision: cmd.Revision})
 	if err != nil {
-		log.Fatalf("Set RPC failed: %v", err)
+		log.Fatalf("Get RPC failed: %v", err)
 		return err
 	}
 	fmt.Printf("key '%s' has value '%s' (index: %d)\n", response.Key, response.Value, response.Index)
+	if cmd.Metadata && response.Metadata != nil {
+		fmt.Printf("  %s\n", describe(response.Metadata))
+	}
 	cmd.ProfileMemory(logger)
 	return nil
 }
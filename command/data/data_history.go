@@ -0,0 +1,45 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// History lists the revisions of a key that have not been compacted yet.
+type History struct {
+	Base
+	Key         string `short:"k" long:"key" description:"The key whose history to list" required:"yes"`
+	Consistency string `short:"c" long:"consistency" description:"The consistency level of the read" optional:"yes" choice:"linearizable" choice:"leader-local" choice:"stale" default:"linearizable"`
+}
+
+func (cmd *History) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	conn, consistency, err := cmd.DialRead(logger, cmd.Consistency)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	response, err := c.History(context.Background(), &proto.HistoryRequest{Namespace: cmd.Namespace, Key: cmd.Key, Consistency: consistency})
+	if err != nil {
+		log.Fatalf("History RPC failed: %v", err)
+		return err
+	}
+	for _, revision := range response.Revisions {
+		if revision.Deleted {
+			fmt.Printf("%d: deleted\n", revision.Index)
+		} else {
+			fmt.Printf("%d: '%s' (version: %d)\n", revision.Index, revision.Value, revision.Version)
+		}
+	}
+	fmt.Printf("key '%s' has %d revisions since index %d (index: %d)\n", cmd.Key, len(response.Revisions), response.Compacted, response.Index)
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Import sets the keys in the JSON Lines or YAML file given as argument,
+// as written by Export; keys with no namespace go to the namespace of the
+// command. The keys are applied all at once, when the whole file was read;
+// in replace mode, all the keys in the cluster are removed at the same time.
+type Import struct {
+	Base
+	Mode   string `short:"o" long:"mode" description:"Whether to merge the keys with the existing ones, or to replace all of them" optional:"yes" choice:"merge" choice:"replace" default:"merge"`
+	Format string `short:"f" long:"format" description:"The format of the file (by default, as told by its extension, or JSON Lines)" optional:"yes" choice:"jsonl" choice:"yaml"`
+}
+
+func (cmd *Import) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	if len(args) != 1 {
+		return fmt.Errorf("invalid command line format: use 'import <file>'")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		logger.Error("error opening import file '%s': %v", args[0], err)
+		return err
+	}
+	defer file.Close()
+
+	conn, err := cmd.Dial(logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+
+	mode := proto.ImportMode_MERGE
+	if cmd.Mode == "replace" {
+		mode = proto.ImportMode_REPLACE
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := c.Import(ctx)
+	if err != nil {
+		logger.Error("Import RPC failed: %v", err)
+		return err
+	}
+	var serr error
+	err = readRecords(bufio.NewReader(file), formatOf(cmd.Format, args[0]), func(r *record) error {
+		value, err := r.value()
+		if err != nil {
+			return err
+		}
+		namespace := r.Namespace
+		if namespace == "" {
+			namespace = cmd.Namespace
+		}
+		serr = stream.Send(&proto.ImportRequest{Mode: mode, Namespace: namespace, Key: r.Key, Value: value})
+		return serr
+	})
+	if err != nil && serr == nil {
+		// abort the stream, so that the keys not yet applied are dropped
+		cancel()
+		logger.Error("error reading import file '%s': %v", args[0], err)
+		return err
+	}
+	// errors sending requests are told by the response
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		logger.Error("Import RPC failed: %v", err)
+		return err
+	}
+	fmt.Printf("%d keys imported, %d removed (index: %d)\n", response.Imported, response.Removed, response.Index)
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Incr atomically adds a delta to an integer key, optionally within
+// bounds.
+type Incr struct {
+	Base
+	Key   string `short:"k" long:"key" description:"The key of the counter" required:"yes"`
+	Delta int64  `short:"d" long:"delta" description:"The amount to add to the counter, negative to decrement" optional:"yes" default:"1"`
+	Min   *int64 `long:"min" description:"The minimum value of the counter" optional:"yes"`
+	Max   *int64 `long:"max" description:"The maximum value of the counter" optional:"yes"`
+}
+
+func (cmd *Incr) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	conn, err := cmd.Dial(logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	request := &proto.IncrementRequest{Namespace: cmd.Namespace, Key: cmd.Key, Delta: cmd.Delta}
+	if cmd.Min != nil {
+		request.Min = &proto.Bound{Value: *cmd.Min}
+	}
+	if cmd.Max != nil {
+		request.Max = &proto.Bound{Value: *cmd.Max}
+	}
+	response, err := c.Increment(context.Background(), request)
+	if err != nil {
+		log.Fatalf("Increment RPC failed: %v", err)
+		return err
+	}
+	if response.Succeeded {
+		fmt.Printf("counter '%s' set to %d (index: %d)\n", cmd.Key, response.Value, response.Index)
+	} else {
+		fmt.Printf("counter '%s' left at %d: out of bounds (index: %d)\n", cmd.Key, response.Value, response.Index)
+	}
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Namespace creates, drops or lists namespaces; the operation and the
+// namespace it applies to are given as arguments, e.g. "create <name>",
+// "drop <name>" or "list".
+type Namespace struct {
+	Base
+}
+
+func (cmd *Namespace) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	if len(args) < 1 || (args[0] != "list" && len(args) != 2) {
+		return fmt.Errorf("invalid command line format: use one of 'create <name>', 'drop <name>' or 'list'")
+	}
+
+	conn, err := cmd.Dial(logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	switch args[0] {
+	case "create":
+		response, err := c.CreateNamespace(context.Background(), &proto.CreateNamespaceRequest{Namespace: args[1]})
+		if err != nil {
+			log.Fatalf("CreateNamespace RPC failed: %v", err)
+			return err
+		}
+		fmt.Printf("namespace '%s' created (index: %d)\n", args[1], response.Index)
+	case "drop":
+		response, err := c.DropNamespace(context.Background(), &proto.DropNamespaceRequest{Namespace: args[1]})
+		if err != nil {
+			log.Fatalf("DropNamespace RPC failed: %v", err)
+			return err
+		}
+		fmt.Printf("namespace '%s' dropped along with %d keys (index: %d)\n", args[1], len(response.Keys), response.Index)
+	case "list":
+		response, err := c.ListNamespaces(context.Background(), &proto.ListNamespacesRequest{})
+		if err != nil {
+			log.Fatalf("ListNamespaces RPC failed: %v", err)
+			return err
+		}
+		for _, namespace := range response.Namespaces {
+			fmt.Println(namespace)
+		}
+	default:
+		return fmt.Errorf("unknown operation '%s': use one of 'create', 'drop' or 'list'", args[0])
+	}
+	cmd.ProfileMemory(logger)
+	return nil
+}
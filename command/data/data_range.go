@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Range reads the keys in a namespace in lexicographic order, either by
+// prefix or in the [start, end) interval.
+type Range struct {
+	Base
+	Prefix      string `short:"x" long:"prefix" description:"The prefix of the keys" optional:"yes"`
+	Start       string `short:"s" long:"start" description:"The first key in the interval" optional:"yes"`
+	End         string `short:"e" long:"end" description:"The key ending the interval (excluded)" optional:"yes"`
+	Limit       int32  `short:"l" long:"limit" description:"The maximum number of keys per page" optional:"yes"`
+	Token       string `short:"t" long:"token" description:"The continuation token returned by the previous page" optional:"yes"`
+	KeysOnly    bool   `short:"K" long:"keys-only" description:"Only return the keys" optional:"yes"`
+	CountOnly   bool   `short:"N" long:"count-only" description:"Only count the keys" optional:"yes"`
+	Revision    uint64 `short:"r" long:"revision" description:"The index to read the keys at (the latest if not specified)" optional:"yes"`
+	Consistency string `short:"c" long:"consistency" description:"The consistency level of the read" optional:"yes" choice:"linearizable" choice:"leader-local" choice:"stale" default:"linearizable"`
+	Metadata    bool   `short:"m" long:"metadata" description:"Also print the metadata of the keys" optional:"yes"`
+}
+
+func (cmd *Range) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	conn, consistency, err := cmd.DialRead(logger, cmd.Consistency)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	request := &proto.RangeRequest{
+		Namespace:   cmd.Namespace,
+		Limit:       cmd.Limit,
+		Token:       cmd.Token,
+		KeysOnly:    cmd.KeysOnly,
+		CountOnly:   cmd.CountOnly,
+		Consistency: consistency,
+		Revision:    cmd.Revision,
+	}
+	if cmd.Prefix != "" {
+		request.Selector = &proto.RangeRequest_Prefix{Prefix: cmd.Prefix}
+	} else if cmd.Start != "" || cmd.End != "" {
+		request.Selector = &proto.RangeRequest_Interval{Interval: &proto.Interval{Start: cmd.Start, End: cmd.End}}
+	}
+	response, err := c.Range(context.Background(), request)
+	if err != nil {
+		log.Fatalf("Range RPC failed: %v", err)
+		return err
+	}
+	for _, pair := range response.Pairs {
+		if cmd.KeysOnly {
+			fmt.Printf("%s\n", pair.Key)
+		} else {
+			fmt.Printf("%s: '%s'\n", pair.Key, pair.Value)
+		}
+		if cmd.Metadata && pair.Metadata != nil {
+			fmt.Printf("  %s\n", describe(pair.Metadata))
+		}
+	}
+	fmt.Printf("%d keys (index: %d)\n", response.Count, response.Index)
+	if response.Token != "" {
+		fmt.Printf("more keys available (token: %s)\n", response.Token)
+	}
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Schema sets, drops or lists the JSON schemas that the values of the keys
+// with a prefix must satisfy; the operation and the prefix it applies to
+// are given as arguments, e.g. "set <prefix> <file>", "drop <prefix>" or
+// "list".
+type Schema struct {
+	Base
+}
+
+func (cmd *Schema) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	if len(args) < 1 || (args[0] == "set" && len(args) != 3) || (args[0] == "drop" && len(args) != 2) || (args[0] == "list" && len(args) != 1) {
+		return fmt.Errorf("invalid command line format: use one of 'set <prefix> <file>', 'drop <prefix>' or 'list'")
+	}
+
+	var schema []byte
+	if args[0] == "set" {
+		var err error
+		if schema, err = os.ReadFile(args[2]); err != nil {
+			logger.Error("error reading schema from '%s': %v", args[2], err)
+			return err
+		}
+	}
+
+	conn, err := cmd.Dial(logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	switch args[0] {
+	case "set":
+		response, err := c.SetSchema(context.Background(), &proto.SetSchemaRequest{Namespace: cmd.Namespace, Prefix: args[1], Schema: string(schema)})
+		if err != nil {
+			log.Fatalf("SetSchema RPC failed: %v", err)
+			return err
+		}
+		fmt.Printf("schema of prefix '%s' set (index: %d)\n", args[1], response.Index)
+	case "drop":
+		response, err := c.DropSchema(context.Background(), &proto.DropSchemaRequest{Namespace: cmd.Namespace, Prefix: args[1]})
+		if err != nil {
+			log.Fatalf("DropSchema RPC failed: %v", err)
+			return err
+		}
+		if response.Dropped {
+			fmt.Printf("schema of prefix '%s' dropped (index: %d)\n", args[1], response.Index)
+		} else {
+			fmt.Printf("prefix '%s' has no schema (index: %d)\n", args[1], response.Index)
+		}
+	case "list":
+		response, err := c.ListSchemas(context.Background(), &proto.ListSchemasRequest{Namespace: cmd.Namespace})
+		if err != nil {
+			log.Fatalf("ListSchemas RPC failed: %v", err)
+			return err
+		}
+		for _, schema := range response.Schemas {
+			fmt.Printf("'%s' (index: %d): %s\n", schema.Prefix, schema.Index, schema.Schema)
+		}
+	default:
+		return fmt.Errorf("unknown operation '%s': use one of 'set', 'drop' or 'list'", args[0])
+	}
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	"github.com/dihedron/rafter/logging/console"
+)
+
+// Seq reserves a block of unique identifiers from a sequence key.
+type Seq struct {
+	Base
+	Key   string `short:"k" long:"key" description:"The key of the sequence" required:"yes"`
+	Count int64  `short:"c" long:"count" description:"The number of identifiers to reserve" optional:"yes" default:"1"`
+}
+
+func (cmd *Seq) Execute(args []string) error {
+
+	logger := console.NewLogger(console.StdOut)
+	defer cmd.ProfileCPU(logger).Close()
+
+	conn, err := cmd.Dial(logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := proto.NewContextClient(conn)
+	response, err := c.Allocate(context.Background(), &proto.AllocateRequest{Namespace: cmd.Namespace, Key: cmd.Key, Count: cmd.Count})
+	if err != nil {
+		log.Fatalf("Allocate RPC failed: %v", err)
+		return err
+	}
+	fmt.Printf("identifiers %d to %d reserved from sequence '%s' (index: %d)\n", response.First, response.Last, cmd.Key, response.Index)
+	cmd.ProfileMemory(logger)
+	return nil
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// record is a key as exported and imported; values that are not valid
+// UTF-8 are encoded in base64, so that files can be read and edited.
+type record struct {
+	Namespace string  `json:"namespace" yaml:"namespace"`
+	Key       string  `json:"key" yaml:"key"`
+	Value     *string `json:"value,omitempty" yaml:"value,omitempty"`
+	Base64    string  `json:"base64,omitempty" yaml:"base64,omitempty"`
+}
+
+func newRecord(namespace string, key string, value []byte) *record {
+	r := &record{Namespace: namespace, Key: key}
+	if utf8.Valid(value) {
+		s := string(value)
+		r.Value = &s
+	} else {
+		r.Base64 = base64.StdEncoding.EncodeToString(value)
+	}
+	return r
+}
+
+// value returns the value of the record.
+func (r *record) value() ([]byte, error) {
+	if r.Base64 != "" {
+		value, err := base64.StdEncoding.DecodeString(r.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 value of key '%s': %w", r.Key, err)
+		}
+		return value, nil
+	}
+	if r.Value == nil {
+		return []byte{}, nil
+	}
+	return []byte(*r.Value), nil
+}
+
+// formatOf returns the format of a file of records, as given or else as
+// told by its extension, defaulting to JSON Lines.
+func formatOf(format string, path string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "jsonl"
+}
+
+// writeRecord writes a record in the given format; YAML records are
+// written as the items of a sequence, one at a time.
+func writeRecord(w io.Writer, format string, r *record) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case "yaml":
+		data, err = yaml.Marshal([]*record{r})
+	default:
+		if data, err = json.Marshal(r); err == nil {
+			data = append(data, '\n')
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding key '%s': %w", r.Key, err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readRecords reads the records in the given format, and passes them to
+// the callback in order until it returns an error.
+func readRecords(r io.Reader, format string, callback func(*record) error) error {
+	switch format {
+	case "yaml":
+		records := []*record{}
+		if err := yaml.NewDecoder(r).Decode(&records); err != nil && err != io.EOF {
+			return fmt.Errorf("error decoding YAML records: %w", err)
+		}
+		for _, record := range records {
+			if err := callback(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		decoder := json.NewDecoder(r)
+		for n := 1; ; n++ {
+			record := &record{}
+			if err := decoder.Decode(record); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("error decoding JSON record %d: %w", n, err)
+			}
+			if err := callback(record); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"time"
 
+	"github.com/dihedron/rafter/cluster"
 	"github.com/dihedron/rafter/logging"
 )
 
 const LoopInterval time.Duration = 2 * time.Second
 
-func LeaderRoutine(ctx context.Context, logger logging.Logger, done chan<- bool) {
+func LeaderRoutine(ctx context.Context, c *cluster.Cluster, logger logging.Logger, done chan<- bool) {
 	ticker := time.NewTicker(LoopInterval)
 	logger.Info("LEADER: background checker started ticking every %+v ms", LoopInterval)
 	defer ticker.Stop()
@@ -22,6 +23,18 @@ loop:
 			break loop
 		case <-ticker.C:
 			logger.Info("LEADER: woken up")
+			if err := c.ExpireLeases(); err != nil {
+				logger.Error("LEADER: error expiring leases: %v", err)
+			}
+			if err := c.RequeueItems(); err != nil {
+				logger.Error("LEADER: error requeueing items: %v", err)
+			}
+			if err := c.CompactRevisions(); err != nil {
+				logger.Error("LEADER: error compacting revisions: %v", err)
+			}
+			if err := c.DropAbandonedImports(); err != nil {
+				logger.Error("LEADER: error dropping abandoned imports: %v", err)
+			}
 		}
 	}
 }
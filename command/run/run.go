@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"github.com/dihedron/rafter/cluster"
 	"github.com/dihedron/rafter/command/base"
+	"github.com/dihedron/rafter/compression"
 	"github.com/dihedron/rafter/distributed"
+	"github.com/dihedron/rafter/encryption"
 )
 
 type Run struct {
@@ -22,6 +25,18 @@ type Run struct {
 	Peers []cluster.Peer `short:"p" long:"peer" description:"The address of a peer node in the cluster to join" optional:"yes"`
 	// State is the directory for Raft cluster state storage.
 	Directory string `short:"d" long:"directory" description:"The base directory where Raft cluster state and snapshots are stored." optional:"yes" default:"./state"`
+	// FSMStore is where the replicated state is kept.
+	FSMStore string `long:"fsm-store" description:"Where to keep the replicated state: in memory, or in a BoltDB file in the base directory." optional:"yes" choice:"memory" choice:"bolt" default:"memory"`
+	// KeyFile is the file holding the keys to encrypt data at rest with.
+	KeyFile string `short:"k" long:"key-file" description:"The JSON or YAML file with the keys to encrypt the Raft log, snapshots and state at rest." optional:"yes"`
+	// Compression is the codec to compress snapshots and large log entries with.
+	Compression string `long:"compression" description:"The codec to compress snapshots and large log entries with; nodes read compressed data whatever their own setting." optional:"yes" choice:"none" choice:"gzip" default:"none"`
+	// CompressionThreshold is the size above which log entries are compressed.
+	CompressionThreshold int `long:"compression-threshold" description:"The size in bytes above which log entries are compressed." optional:"yes" default:"4096"`
+	// MaxBatch is the maximum number of items in a batch request.
+	MaxBatch int `long:"max-batch" description:"The maximum number of items in a batch request, and of keys in each log entry of an import." optional:"yes" default:"1000"`
+	// Retention is the number of log entries whose revisions are kept.
+	Retention uint64 `long:"retention" description:"The number of log entries whose revisions are kept for reads at past revisions, compacted by the leader; 0 disables automatic compaction." optional:"yes" default:"10000"`
 }
 
 func (cmd *Run) Execute(args []string) error {
@@ -34,7 +49,39 @@ func (cmd *Run) Execute(args []string) error {
 	logger := cmd.GetLogger()
 	//defer cmd.ProfileCPU(logger).Close()
 
-	appl := distributed.NewContext(logger)
+	var keyring *encryption.Keyring
+	if cmd.KeyFile != "" {
+		var err error
+		if keyring, err = encryption.Load(cmd.KeyFile); err != nil {
+			return err
+		}
+		logger.Info("encrypting data at rest with key '%s'", keyring.Active())
+	}
+
+	options := []distributed.Option{distributed.WithKeyring(keyring), distributed.WithMaxBatch(cmd.MaxBatch), distributed.WithRetention(cmd.Retention)}
+	if cmd.Compression != "none" {
+		codec, ok := compression.Lookup(cmd.Compression)
+		if !ok {
+			return fmt.Errorf("unknown compression codec '%s'", cmd.Compression)
+		}
+		options = append(options, distributed.WithCompression(codec, cmd.CompressionThreshold))
+		logger.Info("compressing snapshots and log entries above %d bytes with '%s'", cmd.CompressionThreshold, codec.Name())
+	}
+
+	var appl *distributed.Context
+	switch cmd.FSMStore {
+	case "bolt":
+		if err := os.MkdirAll(cmd.Directory, 0700); err != nil {
+			return fmt.Errorf("error creating base directory '%s': %w", cmd.Directory, err)
+		}
+		var err error
+		if appl, err = distributed.OpenContext(filepath.Join(cmd.Directory, "fsm.db"), logger, options...); err != nil {
+			return fmt.Errorf("error opening distributed context: %w", err)
+		}
+		defer appl.Close()
+	default:
+		appl = distributed.NewContext(logger, options...)
+	}
 
 	c, err := cluster.New(
 		args[0],
@@ -44,6 +91,7 @@ func (cmd *Run) Execute(args []string) error {
 		cluster.WithPeers(cmd.Peers...),
 		cluster.WithLogger(logger),
 		cluster.WithBootstrap(cmd.Bootstrap),
+		cluster.WithKeyring(keyring),
 	)
 	if err != nil {
 		return fmt.Errorf("error creating new cluster: %w", err)
@@ -98,7 +146,7 @@ loop:
 				}
 				logger.Info("starting the new leader routine")
 				ctx, cancel = context.WithCancel(interrupts)
-				go LeaderRoutine(ctx, logger, done)
+				go LeaderRoutine(ctx, c, logger, done)
 			case cluster.Follower:
 				logger.Info("received notification: I'm a follower")
 				if cancel != nil {
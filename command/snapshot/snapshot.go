@@ -0,0 +1,8 @@
+package snapshot
+
+// Snapshot is the set of offline commands operating on the snapshots of a
+// node; the node must not be running.
+type Snapshot struct {
+	RotateKey RotateKey `command:"rotate-key" alias:"rk" description:"Re-encrypt the snapshots of a node with the active key."`
+	Verify    Verify    `command:"verify" alias:"v" description:"Check a snapshot file against its header and checksum."`
+}
@@ -0,0 +1,174 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dihedron/rafter/command/base"
+	"github.com/dihedron/rafter/distributed"
+	"github.com/dihedron/rafter/encryption"
+)
+
+type RotateKey struct {
+	base.Base
+	Directory string `short:"d" long:"directory" description:"The base directory where Raft cluster state and snapshots are stored." optional:"yes" default:"./state"`
+	KeyFile   string `short:"k" long:"key-file" description:"The JSON or YAML file with the keys, including the active one and those the snapshots are encrypted with." required:"yes"`
+}
+
+// Execute re-encrypts the given snapshots, or all the snapshots in the base
+// directory, with the active key; the node must not be running. Snapshots
+// that are in plaintext get encrypted.
+func (cmd *RotateKey) Execute(args []string) error {
+	logger := cmd.GetLogger()
+	defer cmd.ProfileCPU(logger).Close()
+
+	keyring, err := encryption.Load(cmd.KeyFile)
+	if err != nil {
+		logger.Error("error loading key file: %v", err)
+		return err
+	}
+	root := filepath.Join(cmd.Directory, "snapshots")
+	ids := args
+	if len(ids) == 0 {
+		entries, err := ioutil.ReadDir(root)
+		if err != nil {
+			logger.Error("error listing snapshots in '%s': %v", root, err)
+			return fmt.Errorf("error listing snapshots in '%s': %w", root, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && filepath.Ext(entry.Name()) != ".tmp" {
+				ids = append(ids, entry.Name())
+			}
+		}
+	}
+	for _, id := range ids {
+		previous, err := rotate(filepath.Join(root, id), keyring)
+		if err != nil {
+			logger.Error("error re-encrypting snapshot '%s': %v", id, err)
+			return fmt.Errorf("error re-encrypting snapshot '%s': %w", id, err)
+		}
+		switch previous {
+		case keyring.Active():
+			fmt.Printf("snapshot '%s' already encrypted with key '%s'\n", id, previous)
+		case "":
+			fmt.Printf("snapshot '%s' encrypted with key '%s'\n", id, keyring.Active())
+		default:
+			fmt.Printf("snapshot '%s' re-encrypted from key '%s' to key '%s'\n", id, previous, keyring.Active())
+		}
+	}
+	cmd.ProfileMemory(logger)
+	return nil
+}
+
+// rotate re-encrypts the state of a snapshot with the active key, keeping
+// its envelope, which is verified along the way, and updates its size and
+// checksum in the metadata, which Raft verifies when opening the snapshot;
+// it returns the key the state was encrypted with.
+func rotate(directory string, keyring *encryption.Keyring) (string, error) {
+	state := filepath.Join(directory, "state.bin")
+	metadata := filepath.Join(directory, "meta.json")
+
+	in, err := os.Open(state)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	envelope, err := distributed.OpenEnvelope(in)
+	if err != nil {
+		return "", err
+	}
+	previous, _, err := encryption.KeyOf(envelope)
+	if err != nil || previous == keyring.Active() {
+		return previous, err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if envelope, err = distributed.OpenEnvelope(in); err != nil {
+		return "", err
+	}
+	plaintext, err := keyring.Reader(envelope)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.Create(state + ".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	hash := crc64.New(crc64.MakeTable(crc64.ECMA))
+	counter := &counter{}
+	var sink io.Writer = io.MultiWriter(out, hash, counter)
+	var wrapper *distributed.EnvelopeWriter
+	if info := envelope.Info(); info != nil {
+		if wrapper, err = distributed.NewEnvelopeWriter(sink, info.Index, info.Term); err != nil {
+			return "", err
+		}
+		sink = wrapper
+	}
+	w, err := keyring.Writer(sink)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(w, plaintext); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if wrapper != nil {
+		info, err := envelope.Verify(-1)
+		if err != nil {
+			return "", err
+		}
+		if err := wrapper.Finish(info.Entries); err != nil {
+			return "", err
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return "", err
+	}
+
+	// the metadata is only partially known here: keep the other fields
+	data, err := ioutil.ReadFile(metadata)
+	if err != nil {
+		return "", err
+	}
+	meta := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", fmt.Errorf("error unmarshalling snapshot metadata: %w", err)
+	}
+	if meta["Size"], err = json.Marshal(counter.n); err != nil {
+		return "", err
+	}
+	if meta["CRC"], err = json.Marshal(hash.Sum(nil)); err != nil {
+		return "", err
+	}
+	if data, err = json.Marshal(meta); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(metadata+".tmp", data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(out.Name(), state); err != nil {
+		return "", err
+	}
+	return previous, os.Rename(metadata+".tmp", metadata)
+}
+
+// counter counts the bytes written to it.
+type counter struct {
+	n int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
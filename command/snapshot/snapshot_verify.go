@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dihedron/rafter/command/base"
+	"github.com/dihedron/rafter/distributed"
+	"github.com/dihedron/rafter/encryption"
+)
+
+type Verify struct {
+	base.Base
+	KeyFile string `short:"k" long:"key-file" description:"The JSON or YAML file with the keys the snapshot is encrypted with, to check its entries too." optional:"yes"`
+}
+
+// Execute checks a snapshot file, or the state of a snapshot directory,
+// against its envelope; the entries of encrypted snapshots are only checked
+// if a key file is given. If the metadata Raft keeps along with the state
+// is there, the index and term are checked against it.
+func (cmd *Verify) Execute(args []string) error {
+	logger := cmd.GetLogger()
+	defer cmd.ProfileCPU(logger).Close()
+
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one snapshot file must be specified: (%v)", args)
+	}
+	path := args[0]
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		path = filepath.Join(path, "state.bin")
+	}
+
+	var keyring *encryption.Keyring
+	if cmd.KeyFile != "" {
+		var err error
+		if keyring, err = encryption.Load(cmd.KeyFile); err != nil {
+			logger.Error("error loading key file: %v", err)
+			return err
+		}
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		logger.Error("error opening snapshot '%s': %v", path, err)
+		return fmt.Errorf("error opening snapshot '%s': %w", path, err)
+	}
+	defer in.Close()
+	info, decoded, err := distributed.VerifySnapshot(in, keyring)
+	if err != nil {
+		logger.Error("snapshot '%s' is invalid: %v", path, err)
+		return fmt.Errorf("snapshot '%s' is invalid: %w", path, err)
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), "meta.json")); err == nil {
+		meta := struct {
+			Index uint64
+			Term  uint64
+		}{}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("error unmarshalling snapshot metadata: %w", err)
+		}
+		// the envelope holds the last entry applied to the state machine,
+		// while Raft also counts the entries it does not see, e.g. barriers
+		// and configuration changes, so the metadata may be ahead of it
+		if meta.Index < info.Index || meta.Term < info.Term {
+			return fmt.Errorf("snapshot '%s' is invalid: index %d and term %d in metadata, %d and %d in envelope", path, meta.Index, meta.Term, info.Index, info.Term)
+		}
+	}
+
+	fmt.Printf("snapshot '%s' is valid: version %d, index %d, term %d, %d entries\n", path, info.Version, info.Index, info.Term, info.Entries)
+	if !decoded {
+		fmt.Printf("snapshot '%s' is encrypted: entries not checked, since no key file was given\n", path)
+	}
+	cmd.ProfileMemory(logger)
+	return nil
+}
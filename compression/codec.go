@@ -0,0 +1,183 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Codec compresses and decompresses data; codecs are identified by a byte
+// in the headers of compressed data, so that readers can tell which codec
+// to use whatever the codec configured locally, and must be registered on
+// all the nodes of a cluster before they are used.
+type Codec interface {
+	// ID identifies the codec in headers.
+	ID() byte
+	// Name identifies the codec on the command line.
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	lock   sync.RWMutex
+	codecs = map[byte]Codec{}
+)
+
+func init() {
+	Register(Gzip{})
+}
+
+// Register makes a codec available to readers and writers.
+func Register(codec Codec) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, other := range codecs {
+		if other.ID() == codec.ID() || other.Name() == codec.Name() {
+			return fmt.Errorf("codec '%s' (%d) conflicts with codec '%s' (%d)", codec.Name(), codec.ID(), other.Name(), other.ID())
+		}
+	}
+	codecs[codec.ID()] = codec
+	return nil
+}
+
+// Lookup returns the registered codec with the given name.
+func Lookup(name string) (Codec, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of the registered codecs, in order.
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		names = append(names, codec.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// byID returns the registered codec with the given ID.
+func byID(id byte) (Codec, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	codec, ok := codecs[id]
+	if !ok {
+		return nil, fmt.Errorf("data is compressed with unknown codec %d", id)
+	}
+	return codec, nil
+}
+
+// Compress compresses data with the given codec, prefixing it with the ID
+// of the codec.
+func Compress(codec Codec, data []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{codec.ID()})
+	w, err := codec.NewWriter(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("error compressing data with codec '%s': %w", codec.Name(), err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing data with codec '%s': %w", codec.Name(), err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decompress decompresses data prefixed with the ID of its codec.
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("compressed data is empty")
+	}
+	codec, err := byID(data[0])
+	if err != nil {
+		return nil, err
+	}
+	r, err := codec.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing data with codec '%s': %w", codec.Name(), err)
+	}
+	defer r.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing data with codec '%s': %w", codec.Name(), err)
+	}
+	return plain, nil
+}
+
+// magic is the leading sequence of a compressed stream; it is followed by
+// the ID of the codec and by the compressed data.
+var magic = []byte{0xC0, 'R', 'F', 'T', 'Z', 1}
+
+// Writer returns a writer that compresses what is written to it with the
+// given codec before passing it on to w; it must be closed to flush the
+// compressed data, which does not close w. A nil codec writes the data as
+// it is, with no header.
+func Writer(codec Codec, w io.Writer) (io.WriteCloser, error) {
+	if codec == nil {
+		return nopCloser{w}, nil
+	}
+	if _, err := w.Write(append(append([]byte{}, magic...), codec.ID())); err != nil {
+		return nil, err
+	}
+	return codec.NewWriter(w)
+}
+
+// Reader returns a reader that decompresses the stream read from r with
+// the codec in its header; streams with no header are read as they are.
+func Reader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(len(magic) + 1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(prefix) <= len(magic) || !bytes.Equal(prefix[:len(magic)], magic) {
+		return br, nil
+	}
+	codec, err := byID(prefix[len(magic)])
+	if err != nil {
+		return nil, err
+	}
+	br.Discard(len(prefix))
+	return codec.NewReader(br)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Gzip is the built-in gzip codec.
+type Gzip struct{}
+
+func (Gzip) ID() byte {
+	return 1
+}
+
+func (Gzip) Name() string {
+	return "gzip"
+}
+
+func (Gzip) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (Gzip) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
@@ -0,0 +1,155 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// identity is a codec that leaves data as it is.
+type identity struct {
+	id   byte
+	name string
+}
+
+func (i identity) ID() byte {
+	return i.id
+}
+
+func (i identity) Name() string {
+	return i.name
+}
+
+func (identity) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopCloser{w}, nil
+}
+
+func (identity) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+func TestRegister(t *testing.T) {
+	if codec, ok := Lookup("gzip"); !ok || codec.ID() != 1 {
+		t.Fatalf("expected built-in gzip codec to be registered")
+	}
+	if err := Register(identity{id: 1, name: "other"}); err == nil {
+		t.Errorf("expected codec with the ID of gzip to be refused")
+	}
+	if err := Register(identity{id: 200, name: "gzip"}); err == nil {
+		t.Errorf("expected codec with the name of gzip to be refused")
+	}
+	if _, ok := Lookup("identity"); ok {
+		t.Fatalf("expected codec to be unknown before it is registered")
+	}
+	if _, err := Decompress([]byte{201}); err == nil || !strings.Contains(err.Error(), "unknown codec 201") {
+		t.Errorf("expected data compressed with unknown codec to fail, got %v", err)
+	}
+	if err := Register(identity{id: 201, name: "identity"}); err != nil {
+		t.Fatalf("error registering codec: %v", err)
+	}
+	if codec, ok := Lookup("identity"); !ok || codec.ID() != 201 {
+		t.Errorf("expected registered codec to be found by name")
+	}
+	if names := Names(); strings.Join(names, ",") != "gzip,identity" {
+		t.Errorf("expected codecs gzip and identity, got %v", names)
+	}
+	if data, err := Decompress([]byte{201, 'x'}); err != nil || string(data) != "x" {
+		t.Errorf("expected data compressed with registered codec to be read, got %q (%v)", data, err)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	gzip, _ := Lookup("gzip")
+	for _, data := range [][]byte{{}, []byte("x"), bytes.Repeat([]byte("0123456789"), 1000)} {
+		compressed, err := Compress(gzip, data)
+		if err != nil {
+			t.Fatalf("error compressing data: %v", err)
+		}
+		if compressed[0] != gzip.ID() {
+			t.Errorf("expected data to be prefixed by codec ID %d, got %d", gzip.ID(), compressed[0])
+		}
+		if plain, err := Decompress(compressed); err != nil || !bytes.Equal(plain, data) {
+			t.Errorf("expected %d bytes to be decompressed, got %d (%v)", len(data), len(plain), err)
+		}
+	}
+	if _, err := Decompress(nil); err == nil {
+		t.Errorf("expected empty data to fail")
+	}
+	if _, err := Decompress([]byte{gzip.ID(), 'x'}); err == nil {
+		t.Errorf("expected corrupted data to fail")
+	}
+}
+
+func TestStream(t *testing.T) {
+	gzip, _ := Lookup("gzip")
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{"gzip", gzip},
+		{"plain", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := &bytes.Buffer{}
+			w, err := Writer(test.codec, stream)
+			if err != nil {
+				t.Fatalf("error creating writer: %v", err)
+			}
+			w.Write(data)
+			if err := w.Close(); err != nil {
+				t.Fatalf("error closing writer: %v", err)
+			}
+			header := append(append([]byte{}, magic...), 1)
+			if compressed := bytes.HasPrefix(stream.Bytes(), header); compressed != (test.codec != nil) {
+				t.Errorf("expected header to be written only with a codec, got %t", compressed)
+			}
+			r, err := Reader(stream)
+			if err != nil {
+				t.Fatalf("error creating reader: %v", err)
+			}
+			if plain, err := io.ReadAll(r); err != nil || !bytes.Equal(plain, data) {
+				t.Errorf("expected %d bytes to be read back, got %d (%v)", len(data), len(plain), err)
+			}
+		})
+	}
+}
+
+func TestStreamHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream []byte
+		err    string
+	}{
+		{"empty", nil, ""},
+		{"shorter than magic", magic[:3], ""},
+		{"magic only", magic, ""},
+		{"other magic", append([]byte{0xC0, 'R', 'F', 'T', 'X', 1}, 1), ""},
+		{"other version", append([]byte{0xC0, 'R', 'F', 'T', 'Z', 2}, 1), ""},
+		{"unknown codec", append(append([]byte{}, magic...), 202), "unknown codec 202"},
+		{"corrupted", append(append([]byte{}, magic...), 1, 'x'), "EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := Reader(bytes.NewReader(test.stream))
+			var data []byte
+			if err == nil {
+				data, err = io.ReadAll(r)
+			}
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error reading stream: %v", err)
+			}
+			if !bytes.Equal(data, test.stream) {
+				t.Errorf("expected stream with no header to be read as it is, got %q", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package distributed
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// DefaultMaxBatch is the default maximum number of items in a batch request.
+const DefaultMaxBatch = 1000
+
+// applyBatch executes many operations on keys in a single log entry, in
+// order; unless all the values to set match their schemas, none is set.
+func (c *Context) applyBatch(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	if err := c.check(message.Namespace, message.Operations); err != nil {
+		c.mtx.Unlock()
+		c.logger.Error("error applying batch at index %d: %v", l.Index, err)
+		return nil, err
+	}
+	results, events := c.operate(message.Namespace, message.Operations, l.Index)
+	c.mtx.Unlock()
+	c.hub.publish(events...)
+	return &Message{
+		Results: results,
+		Index:   l.Index,
+	}, nil
+}
+
+// checkBatch refuses empty batches and batches larger than the maximum
+// configured on the node.
+func (c *Context) checkBatch(size int) error {
+	if size == 0 {
+		return fmt.Errorf("no items in batch")
+	}
+	if c.maxBatch > 0 && size > c.maxBatch {
+		return fmt.Errorf("batch of %d items exceeds the maximum of %d", size, c.maxBatch)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package distributed
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	proto "github.com/dihedron/rafter/distributed/proto"
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestBatchSize(t *testing.T) {
+	logger := test.NewLogger(t)
+	c := NewContext(logger, WithMaxBatch(2))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	// oversized batches are refused before they reach the log, so there is
+	// no need for Raft here
+	r := NewRPCInterface(c, nil, logger)
+	tests := []struct {
+		name string
+		keys []string
+		err  string
+	}{
+		{"empty", nil, "no items in batch"},
+		{"too large", []string{"a", "b", "c"}, "batch of 3 items exceeds the maximum of 2"},
+	}
+	for _, test := range tests {
+		items := []*proto.KeyValue{}
+		for _, key := range test.keys {
+			items = append(items, &proto.KeyValue{Key: key, Value: []byte("1")})
+		}
+		errs := map[string]error{}
+		_, errs["get"] = r.MultiGet(context.Background(), &proto.MultiGetRequest{Keys: test.keys, Consistency: proto.Consistency_STALE})
+		_, errs["set"] = r.MultiSet(context.Background(), &proto.MultiSetRequest{Items: items})
+		_, errs["remove"] = r.MultiRemove(context.Background(), &proto.MultiRemoveRequest{Keys: test.keys})
+		for method, err := range errs {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected multi-%s to fail with %q, got %v", test.name, method, test.err, err)
+			}
+		}
+	}
+	response, err := r.MultiGet(context.Background(), &proto.MultiGetRequest{Keys: []string{"a", "b"}, Consistency: proto.Consistency_STALE})
+	if err != nil || len(response.Results) != 2 || !response.Results[0].Found || response.Results[1].Found {
+		t.Errorf("expected a batch at the maximum to be served, got %+v (%v)", response, err)
+	}
+	// without a maximum only empty batches are refused
+	if err := NewContext(logger, WithMaxBatch(0)).checkBatch(DefaultMaxBatch + 1); err != nil {
+		t.Errorf("expected no maximum, got %v", err)
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	apply(t, c, 2, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "json/", Value: []byte(`{"type":"integer"}`)})
+	result := apply(t, c, 3, &Message{Type: Batch, Namespace: DefaultNamespace, Operations: []Operation{
+		{Type: Remove, Key: "a"},
+		{Type: Set, Key: "b", Value: []byte("2")},
+		{Type: Remove, Key: "c"},
+	}})
+	if len(result.Results) != 3 || !result.Results[0].Succeeded || result.Results[2].Succeeded || result.Index != 3 {
+		t.Fatalf("expected results in order at index 3, got %+v", result)
+	}
+	// a value that does not match its schema fails the whole batch
+	err := refused(t, c, 4, &Message{Type: Batch, Namespace: DefaultNamespace, Operations: []Operation{
+		{Type: Set, Key: "c", Value: []byte("3")},
+		{Type: Set, Key: "json/a", Value: []byte(`"a"`)},
+	}})
+	if err == nil {
+		t.Fatalf("expected batch to be refused")
+	}
+	if entry, _ := c.Read(DefaultNamespace, "c"); entry != nil {
+		t.Errorf("expected no key of the refused batch to be set, got %+v", entry)
+	}
+}
@@ -0,0 +1,702 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dihedron/rafter/encryption"
+	"github.com/dihedron/rafter/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// valuesBucket and historyBucket hold one nested bucket per namespace,
+	// with the entries of its keys and, for each key, a further bucket of
+	// its revisions by index, respectively.
+	valuesBucket  = []byte("values")
+	historyBucket = []byte("history")
+	// stateBucket holds the layout of the file and the index of the last
+	// applied log entry.
+	stateBucket = []byte("state")
+	formatKey   = []byte("format")
+	appliedKey  = []byte("applied")
+	// extrasBucket holds one nested bucket per kind of record of the rest
+	// of the state of the context, e.g. leases, with a record per ID.
+	extrasBucket = []byte("extras")
+)
+
+// OpenContext creates a distributed context whose keys are stored in the
+// BoltDB file at the given path, so that datasets need not fit in memory;
+// if the file exists, the context resumes from the state it holds, and the
+// log entries it has already applied are skipped when they are replayed.
+// Leases, locks, elections, queues and the state of custom commands are
+// still held in memory, and each is written to the file when it changes.
+func OpenContext(path string, l logging.Logger, options ...Option) (*Context, error) {
+	l.Info("opening distributed context in '%s'...", path)
+	values, err := openBolt(path)
+	if err != nil {
+		l.Error("error opening context storage '%s': %v", path, err)
+		return nil, err
+	}
+	c := newContext(values, l, options...)
+	values.keyring = c.keyring
+	index, err := values.load()
+	var s *state
+	if err == nil {
+		s, err = load(values)
+	}
+	if err != nil {
+		values.Close()
+		l.Error("error loading context from '%s': %v", path, err)
+		return nil, err
+	}
+	c.compacted = s.compacted
+	c.leases = s.leases
+	c.locks = s.locks
+	c.elections = s.elections
+	c.queues = s.queues
+	c.pending = s.commands
+	c.sessions = newLRU(s.sessions)
+	c.schemas = s.schemas
+	attach(values, c.leases)
+	c.advance(index)
+	// watchers cannot resume from before the restart
+	c.hub.reset(index)
+	l.Info("distributed context loaded at index %d (%d leases)", index, len(c.leases))
+	return c, nil
+}
+
+// Durable tells whether the context outlives the process, so that it need
+// not be restored from the latest snapshot when the node restarts.
+func (c *Context) Durable() bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.storage.Durable()
+}
+
+// Close releases the storage of the context.
+func (c *Context) Close() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.storage.Close()
+}
+
+// boltStorage is the storage of a context in a BoltDB file; the entries and
+// revisions of the keys are stored as JSON, encrypted if there is a keyring,
+// under the key prefixed with a slash since BoltDB does not allow empty
+// keys, which are never encrypted. The changes made while a
+// log entry is applied are buffered in memory, and written in a single
+// transaction along with the index of the entry, so that the file is always
+// consistent with the last applied index. Views are read-only transactions,
+// which may delay the growth of the file while they are open.
+type boltStorage struct {
+	db      *bolt.DB
+	path    string
+	tx      *bolt.Tx
+	keyring *encryption.Keyring
+	changes *changes
+}
+
+// boltFormat is the layout of the BoltDB files written by this version.
+const boltFormat = 3
+
+// changes are the writes to a storage that have not been persisted yet;
+// nil entries are deletions, revisions are appended to those on disk, and
+// namespaces map to whether they were created or dropped.
+type changes struct {
+	namespaces map[string]bool
+	values     map[string]map[string]*Entry
+	history    map[string]map[string][]Revision
+	extras     map[string]map[string]interface{}
+	compact    uint64
+}
+
+func newChanges() *changes {
+	return &changes{
+		namespaces: map[string]bool{},
+		values:     map[string]map[string]*Entry{},
+		history:    map[string]map[string][]Revision{},
+		extras:     map[string]map[string]interface{}{},
+	}
+}
+
+var _ storage = &boltStorage{}
+
+// openBolt opens or creates the BoltDB file at the given path, with the
+// default namespace.
+func openBolt(path string) (*boltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening BoltDB file '%s': %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{valuesBucket, historyBucket} {
+			bucket, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if _, err := bucket.CreateBucketIfNotExists([]byte(DefaultNamespace)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucketIfNotExists(extrasBucket); err != nil {
+			return err
+		}
+		state, err := tx.CreateBucketIfNotExists(stateBucket)
+		if err != nil {
+			return err
+		}
+		format := make([]byte, 8)
+		binary.BigEndian.PutUint64(format, boltFormat)
+		if v := state.Get(formatKey); v == nil && state.Get(appliedKey) == nil {
+			return state.Put(formatKey, format)
+		} else if v == nil || binary.BigEndian.Uint64(v) != boltFormat {
+			return errors.New("unsupported file format")
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initialising BoltDB file '%s': %w", path, err)
+	}
+	return &boltStorage{db: db, path: path, changes: newChanges()}, nil
+}
+
+// load returns the index of the last applied log entry, if any.
+func (b *boltStorage) load() (uint64, error) {
+	var index uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(stateBucket).Get(appliedKey); v != nil {
+			index = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	return index, err
+}
+
+// encode marshals a value to JSON and encrypts it.
+func (b *boltStorage) encode(value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return b.keyring.Seal(data)
+}
+
+// decode decrypts a value and unmarshals it from JSON.
+func (b *boltStorage) decode(data []byte, value interface{}) error {
+	data, err := b.keyring.Open(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// view runs fn in the storage's own transaction if it is a view, or in a
+// new read-only one; failures to read the file are unrecoverable.
+func (b *boltStorage) view(fn func(tx *bolt.Tx) error) {
+	var err error
+	if b.tx != nil {
+		err = fn(b.tx)
+	} else {
+		err = b.db.View(fn)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("error reading BoltDB file '%s': %v", b.path, err))
+	}
+}
+
+// bucket returns the bucket of a namespace under the given one, or nil.
+func bucket(tx *bolt.Tx, parent []byte, namespace string) *bolt.Bucket {
+	return tx.Bucket(parent).Bucket([]byte(namespace))
+}
+
+// dbkey returns the key of a bucket item for the given key.
+func dbkey(key []byte) []byte {
+	return append([]byte{'/'}, key...)
+}
+
+func (b *boltStorage) Namespaces() []string {
+	names := []string{}
+	b.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(valuesBucket).ForEach(func(k, v []byte) error {
+			if _, ok := b.changes.namespaces[string(k)]; !ok {
+				names = append(names, string(k))
+			}
+			return nil
+		})
+	})
+	for name, created := range b.changes.namespaces {
+		if created {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *boltStorage) HasNamespace(namespace string) bool {
+	if created, ok := b.changes.namespaces[namespace]; ok {
+		return created
+	}
+	found := false
+	b.view(func(tx *bolt.Tx) error {
+		found = bucket(tx, valuesBucket, namespace) != nil
+		return nil
+	})
+	return found
+}
+
+func (b *boltStorage) Create(namespace string) {
+	b.changes.namespaces[namespace] = true
+}
+
+func (b *boltStorage) Drop(namespace string) {
+	b.changes.namespaces[namespace] = false
+	delete(b.changes.values, namespace)
+	delete(b.changes.history, namespace)
+}
+
+// read returns the value of a key under the given parent bucket, unless
+// its namespace was created or dropped since the last write to the file.
+func (b *boltStorage) read(parent []byte, namespace string, key string, value interface{}) bool {
+	if _, ok := b.changes.namespaces[namespace]; ok {
+		return false
+	}
+	found := false
+	b.view(func(tx *bolt.Tx) error {
+		if bucket := bucket(tx, parent, namespace); bucket != nil {
+			if data := bucket.Get(dbkey([]byte(key))); data != nil {
+				found = true
+				return b.decode(data, value)
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+func (b *boltStorage) Get(namespace string, key string) *Entry {
+	if entry, ok := b.changes.values[namespace][key]; ok {
+		return entry
+	}
+	entry := &Entry{}
+	if !b.read(valuesBucket, namespace, key, entry) {
+		return nil
+	}
+	return entry
+}
+
+func (b *boltStorage) Put(namespace string, key string, entry *Entry) {
+	if _, ok := b.changes.values[namespace]; !ok {
+		b.changes.values[namespace] = map[string]*Entry{}
+	}
+	b.changes.values[namespace][key] = entry
+}
+
+func (b *boltStorage) Delete(namespace string, key string) *Entry {
+	entry := b.Get(namespace, key)
+	if entry != nil {
+		b.Put(namespace, key, nil)
+	}
+	return entry
+}
+
+// Revisions merges the revisions of a key on disk with those appended since
+// the last write to the file.
+func (b *boltStorage) Revisions(namespace string, key string) []Revision {
+	revisions := []Revision{}
+	if _, ok := b.changes.namespaces[namespace]; !ok {
+		b.view(func(tx *bolt.Tx) error {
+			if bucket := bucket(tx, historyBucket, namespace); bucket != nil {
+				var err error
+				revisions, err = b.revisions(bucket.Bucket(dbkey([]byte(key))))
+				return err
+			}
+			return nil
+		})
+	}
+	revisions = append(revisions, b.changes.history[namespace][key]...)
+	if len(revisions) == 0 {
+		return nil
+	}
+	return revisions
+}
+
+// revisions decodes the revisions in the bucket of a key, if any.
+func (b *boltStorage) revisions(bucket *bolt.Bucket) ([]Revision, error) {
+	revisions := []Revision{}
+	if bucket == nil {
+		return revisions, nil
+	}
+	err := bucket.ForEach(func(k, data []byte) error {
+		revision := Revision{}
+		if err := b.decode(data, &revision); err != nil {
+			return fmt.Errorf("error unmarshalling revision %d: %w", binary.BigEndian.Uint64(k), err)
+		}
+		revisions = append(revisions, revision)
+		return nil
+	})
+	return revisions, err
+}
+
+// Append is deferred to the next write to the file, where only the new
+// revision is written.
+func (b *boltStorage) Append(namespace string, key string, revision Revision) {
+	if _, ok := b.changes.history[namespace]; !ok {
+		b.changes.history[namespace] = map[string][]Revision{}
+	}
+	b.changes.history[namespace][key] = append(b.changes.history[namespace][key], revision)
+}
+
+// Extra is deferred to the next write to the file, where the record is
+// encoded as it is then.
+func (b *boltStorage) Extra(kind string, id string, value interface{}) {
+	if _, ok := b.changes.extras[kind]; !ok {
+		b.changes.extras[kind] = map[string]interface{}{}
+	}
+	b.changes.extras[kind][id] = value
+}
+
+// Extras only returns the records on disk, and is meant to be called when
+// the file is opened.
+func (b *boltStorage) Extras(kind string) (map[string]json.RawMessage, error) {
+	records := map[string]json.RawMessage{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(extrasBucket).Bucket([]byte(kind))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			data, err := b.keyring.Open(append([]byte{}, v...))
+			if err != nil {
+				return fmt.Errorf("error decrypting %s record '%s': %w", kind, k, err)
+			}
+			records[string(k)] = data
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Compact is deferred to the next write to the file, where it is applied
+// to all the revisions on disk.
+func (b *boltStorage) Compact(index uint64) {
+	b.changes.compact = index
+}
+
+// Seek merges the keys on disk with those changed since the last write to
+// the file, the latter taking precedence; revisions appended since are
+// added to those on disk.
+func (b *boltStorage) Seek(namespace string, history bool, from []byte, fn func(k []byte, v interface{}) bool) {
+	parent := valuesBucket
+	pending := map[string]interface{}{}
+	if history {
+		parent = historyBucket
+		for key, revisions := range b.changes.history[namespace] {
+			if revisions != nil {
+				pending[key] = revisions
+			} else {
+				pending[key] = nil
+			}
+		}
+	} else {
+		for key, entry := range b.changes.values[namespace] {
+			if entry != nil {
+				pending[key] = entry
+			} else {
+				pending[key] = nil
+			}
+		}
+	}
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		if key >= string(from) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	b.view(func(tx *bolt.Tx) error {
+		var (
+			cursor *bolt.Cursor
+			stored *bolt.Bucket
+		)
+		if _, ok := b.changes.namespaces[namespace]; !ok {
+			if stored = bucket(tx, parent, namespace); stored != nil {
+				cursor = stored.Cursor()
+			}
+		}
+		decode := func(k []byte, data []byte) (interface{}, error) {
+			if history {
+				return b.revisions(stored.Bucket(k))
+			}
+			entry := &Entry{}
+			return entry, b.decode(data, entry)
+		}
+		var k, data []byte
+		if cursor != nil {
+			k, data = cursor.Seek(dbkey(from))
+		}
+		for k != nil || len(keys) > 0 {
+			if k != nil && (len(keys) == 0 || string(k[1:]) < keys[0]) {
+				v, err := decode(k, data)
+				if err != nil {
+					return fmt.Errorf("error unmarshalling key '%s': %w", k[1:], err)
+				}
+				if fn(k[1:], v) {
+					return nil
+				}
+				k, data = cursor.Next()
+				continue
+			}
+			key := keys[0]
+			keys = keys[1:]
+			v := pending[key]
+			if k != nil && string(k[1:]) == key {
+				if history {
+					revisions, err := decode(k, data)
+					if err != nil {
+						return fmt.Errorf("error unmarshalling key '%s': %w", key, err)
+					}
+					v = append(revisions.([]Revision), v.([]Revision)...)
+				}
+				k, data = cursor.Next()
+			}
+			if v != nil {
+				if fn([]byte(key), v) {
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStorage) View() (storage, error) {
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("error opening view of BoltDB file '%s': %w", b.path, err)
+	}
+	return &boltStorage{db: b.db, path: b.path, tx: tx, keyring: b.keyring, changes: newChanges()}, nil
+}
+
+// Empty creates a new file next to the current one, which Replace moves
+// in its place.
+func (b *boltStorage) Empty() (storage, error) {
+	path := b.path + ".restore"
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error removing BoltDB file '%s': %w", path, err)
+	}
+	fresh, err := openBolt(path)
+	if err != nil {
+		return nil, err
+	}
+	fresh.keyring = b.keyring
+	return fresh, nil
+}
+
+// Replace moves the new file over the current one, which stays open until
+// closed, e.g. by the views still reading from it.
+func (b *boltStorage) Replace(fresh storage) (storage, error) {
+	f, ok := fresh.(*boltStorage)
+	if !ok {
+		return nil, fmt.Errorf("cannot replace BoltDB storage with %T", fresh)
+	}
+	if err := os.Rename(f.path, b.path); err != nil {
+		return nil, fmt.Errorf("error replacing BoltDB file '%s': %w", b.path, err)
+	}
+	f.path = b.path
+	return f, nil
+}
+
+func (b *boltStorage) Durable() bool {
+	return true
+}
+
+func (b *boltStorage) Flush() error {
+	return b.Commit(0)
+}
+
+// Commit writes the buffered changes to the file, along with the applied
+// index unless zero.
+func (b *boltStorage) Commit(index uint64) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for name, created := range b.changes.namespaces {
+			for _, parent := range [][]byte{valuesBucket, historyBucket} {
+				err := tx.Bucket(parent).DeleteBucket([]byte(name))
+				if err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+				if created {
+					if _, err := tx.Bucket(parent).CreateBucket([]byte(name)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for name, values := range b.changes.values {
+			for key, entry := range values {
+				var data []byte
+				if entry != nil {
+					var err error
+					if data, err = b.encode(entry); err != nil {
+						return err
+					}
+				}
+				if err := write(tx, valuesBucket, name, key, data); err != nil {
+					return err
+				}
+			}
+		}
+		for name, history := range b.changes.history {
+			for key, revisions := range history {
+				if err := b.append(tx, name, key, revisions); err != nil {
+					return err
+				}
+			}
+		}
+		for kind, records := range b.changes.extras {
+			bucket, err := tx.Bucket(extrasBucket).CreateBucketIfNotExists([]byte(kind))
+			if err != nil {
+				return err
+			}
+			for id, value := range records {
+				if value == nil {
+					err = bucket.Delete([]byte(id))
+				} else {
+					var data []byte
+					if data, err = b.encode(value); err == nil {
+						err = bucket.Put([]byte(id), data)
+					}
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if b.changes.compact != 0 {
+			if err := b.compact(tx, b.changes.compact); err != nil {
+				return err
+			}
+		}
+		if index != 0 {
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint64(data, index)
+			return tx.Bucket(stateBucket).Put(appliedKey, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error writing to BoltDB file '%s': %w", b.path, err)
+	}
+	b.changes = newChanges()
+	return nil
+}
+
+// write stores or, if data is nil, deletes a key in the bucket of its
+// namespace.
+func write(tx *bolt.Tx, parent []byte, namespace string, key string, data []byte) error {
+	bucket := bucket(tx, parent, namespace)
+	if bucket == nil {
+		return fmt.Errorf("namespace '%s' not found", namespace)
+	}
+	if data == nil {
+		return bucket.Delete(dbkey([]byte(key)))
+	}
+	return bucket.Put(dbkey([]byte(key)), data)
+}
+
+// append writes revisions to the bucket of their key, each on its own.
+func (b *boltStorage) append(tx *bolt.Tx, namespace string, key string, revisions []Revision) error {
+	history := bucket(tx, historyBucket, namespace)
+	if history == nil {
+		return fmt.Errorf("namespace '%s' not found", namespace)
+	}
+	bucket, err := history.CreateBucketIfNotExists(dbkey([]byte(key)))
+	if err != nil {
+		return err
+	}
+	for _, revision := range revisions {
+		data, err := b.encode(revision)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(revisionKey(revision.Index), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact drops the revisions superseded before the given index from the
+// history of all namespaces, one key at a time; only the revision current at
+// index is read, since all those before it are dropped.
+func (b *boltStorage) compact(tx *bolt.Tx, index uint64) error {
+	return tx.Bucket(historyBucket).ForEach(func(name, _ []byte) error {
+		history := tx.Bucket(historyBucket).Bucket(name)
+		cursor := history.Cursor()
+		for k, _ := cursor.First(); k != nil; {
+			key := append([]byte{}, k...)
+			empty, err := b.compactKey(history.Bucket(key), index)
+			if err != nil {
+				return fmt.Errorf("error compacting key '%s': %w", key[1:], err)
+			}
+			if empty {
+				if err := history.DeleteBucket(key); err != nil {
+					return err
+				}
+			}
+			// the cursor is moved again past the key, since the bucket
+			// may have changed under it
+			if k, _ = cursor.Seek(key); k != nil && bytes.Equal(k, key) {
+				k, _ = cursor.Next()
+			}
+		}
+		return nil
+	})
+}
+
+// compactKey drops the revisions superseded before the given index from the
+// bucket of a key, and tells whether none is left.
+func (b *boltStorage) compactKey(bucket *bolt.Bucket, index uint64) (bool, error) {
+	cursor := bucket.Cursor()
+	k, data := cursor.Seek(revisionKey(index + 1))
+	if k == nil {
+		k, data = cursor.Last()
+	} else {
+		k, data = cursor.Prev()
+	}
+	if k == nil {
+		return false, nil
+	}
+	revision := Revision{}
+	if err := b.decode(data, &revision); err != nil {
+		return false, err
+	}
+	current := append([]byte{}, k...)
+	for r, _ := cursor.First(); r != nil && bytes.Compare(r, current) < 0; r, _ = cursor.First() {
+		if err := cursor.Delete(); err != nil {
+			return false, err
+		}
+	}
+	if revision.Deleted {
+		if err := bucket.Delete(current); err != nil {
+			return false, err
+		}
+	}
+	r, _ := cursor.First()
+	return r == nil, nil
+}
+
+func (b *boltStorage) Close() error {
+	if b.tx != nil {
+		return b.tx.Rollback()
+	}
+	return b.db.Close()
+}
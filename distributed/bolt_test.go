@@ -0,0 +1,407 @@
+package distributed
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+	"github.com/hashicorp/raft"
+	bolt "go.etcd.io/bbolt"
+)
+
+// apply applies a message to a context as the log entry at the given index,
+// and fails the test if it returns an error.
+func apply(t *testing.T, c *Context, index uint64, message *Message) *Message {
+	t.Helper()
+	data, err := c.encode(message)
+	if err != nil {
+		t.Fatalf("error encoding message: %v", err)
+	}
+	switch result := c.Apply(&raft.Log{Index: index, Term: 1, Data: data}).(type) {
+	case error:
+		t.Fatalf("error applying log entry %d: %v", index, result)
+	case *Message:
+		return result
+	}
+	return nil
+}
+
+func TestOpenContextRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "context.db")
+	c, err := OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error opening context: %v", err)
+	}
+	apply(t, c, 1, &Message{Type: CreateNamespace, Namespace: "ns"})
+	apply(t, c, 2, &Message{Type: SetSchema, Namespace: "ns", Key: "a", Value: []byte(`{"type":"string"}`)})
+	apply(t, c, 3, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte("v"), TTL: 60, Time: time.Now()})
+	apply(t, c, 4, &Message{Type: DropNamespace, Namespace: "ns"})
+	apply(t, c, 5, &Message{Type: Enqueue, Key: "q", Value: []byte("item")})
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing context: %v", err)
+	}
+
+	c, err = OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error reopening context: %v", err)
+	}
+	if !c.HasLease(3) {
+		t.Errorf("lease granted by set was lost on restart")
+	}
+	if entry, _ := c.Read(DefaultNamespace, "k"); entry == nil || entry.Lease != 3 {
+		t.Errorf("expected key attached to lease 3, got %+v", entry)
+	}
+	if c.HasNamespace("ns") {
+		t.Errorf("dropped namespace came back on restart")
+	}
+	if schemas, _ := c.Schemas("ns"); len(schemas) != 0 {
+		t.Errorf("schemas of dropped namespace came back on restart: %+v", schemas)
+	}
+	if item, ready, _, index := c.Peek("q"); item == nil || string(item.Value) != "item" || ready != 1 || index != 5 {
+		t.Errorf("expected one item in queue at index 5, got %+v (%d ready, index %d)", item, ready, index)
+	}
+	// entries already applied are skipped when replayed
+	data, _ := c.encode(&Message{Type: CreateNamespace, Namespace: "ns"})
+	if result := c.Apply(&raft.Log{Index: 4, Term: 1, Data: data}); result != nil || c.HasNamespace("ns") {
+		t.Errorf("expected replayed entry to be skipped, got %v", result)
+	}
+
+	// the schema is still enforced once the namespace is created again, and
+	// kept across restarts
+	apply(t, c, 6, &Message{Type: CreateNamespace, Namespace: "ns"})
+	apply(t, c, 7, &Message{Type: SetSchema, Namespace: "ns", Key: "a", Value: []byte(`{"type":"string"}`)})
+	apply(t, c, 8, &Message{Type: Revoke, Lease: 3})
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing context: %v", err)
+	}
+	c, err = OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error reopening context: %v", err)
+	}
+	defer c.Close()
+	if c.HasLease(3) {
+		t.Errorf("revoked lease came back on restart")
+	}
+	if entry, _ := c.Read(DefaultNamespace, "k"); entry != nil {
+		t.Errorf("key of revoked lease came back on restart: %+v", entry)
+	}
+	if err := c.Validate("ns", "ab", []byte("1")); err == nil {
+		t.Errorf("schema set after restart was not enforced")
+	}
+}
+
+// sink collects a snapshot in memory.
+type sink struct {
+	bytes.Buffer
+}
+
+func (s *sink) ID() string    { return "test" }
+func (s *sink) Cancel() error { return nil }
+func (s *sink) Close() error  { return nil }
+
+func TestRestoreIntoBolt(t *testing.T) {
+	source := NewContext(test.NewLogger(t))
+	apply(t, source, 1, &Message{Type: Grant, TTL: 60, Time: time.Now()})
+	apply(t, source, 2, &Message{Type: Acquire, Key: "lock", Lease: 1})
+	apply(t, source, 3, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "a", Value: []byte(`{"type":"string"}`)})
+	apply(t, source, 4, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte(`"v"`), Lease: 1})
+	snapshot, err := source.Snapshot()
+	if err != nil {
+		t.Fatalf("error taking snapshot: %v", err)
+	}
+	s := &sink{}
+	if err := snapshot.Persist(s); err != nil {
+		t.Fatalf("error persisting snapshot: %v", err)
+	}
+	snapshot.Release()
+
+	path := filepath.Join(t.TempDir(), "context.db")
+	c, err := OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error opening context: %v", err)
+	}
+	// a snapshot still being persisted keeps the replaced file open, but
+	// does not hold up the restored context
+	pending, err := c.Snapshot()
+	if err != nil {
+		t.Fatalf("error taking snapshot: %v", err)
+	}
+	restored := make(chan error, 1)
+	go func() {
+		restored <- c.Restore(io.NopCloser(&s.Buffer))
+	}()
+	for deadline := time.Now().Add(5 * time.Second); c.AppliedIndex() != 4; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected snapshot to be restored while the old file is in use")
+		}
+	}
+	if entry, _ := c.Read(DefaultNamespace, "k"); entry == nil {
+		t.Errorf("expected restored key to be readable")
+	}
+	pending.Release()
+	if err := <-restored; err != nil {
+		t.Fatalf("error restoring snapshot: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing context: %v", err)
+	}
+	c, err = OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error reopening context: %v", err)
+	}
+	defer c.Close()
+	if !c.HasLease(1) {
+		t.Errorf("restored lease was lost on restart")
+	}
+	if entry, _ := c.Read(DefaultNamespace, "k"); entry == nil || entry.Lease != 1 {
+		t.Errorf("expected restored key attached to lease 1, got %+v", entry)
+	}
+	if lock, ok := c.locks["lock"]; !ok || lock.Session != 1 {
+		t.Errorf("restored lock was lost on restart")
+	}
+	if err := c.Validate(DefaultNamespace, "ab", []byte("1")); err == nil {
+		t.Errorf("restored schema was lost on restart")
+	}
+}
+
+// seek returns the keys a storage seeks from the given one, stopping after
+// the given number of keys unless zero, along with their values or the
+// indexes of their revisions.
+func seek(s storage, namespace string, history bool, from string, limit int) []string {
+	result := []string{}
+	s.Seek(namespace, history, []byte(from), func(k []byte, v interface{}) bool {
+		switch v := v.(type) {
+		case *Entry:
+			result = append(result, string(k)+"="+string(v.Value))
+		case []Revision:
+			indexes := []string{}
+			for _, revision := range v {
+				indexes = append(indexes, strconv.FormatUint(revision.Index, 10))
+			}
+			result = append(result, string(k)+"@"+strings.Join(indexes, ","))
+		}
+		return limit > 0 && len(result) == limit
+	})
+	return result
+}
+
+func TestBoltSeek(t *testing.T) {
+	b, err := openBolt(filepath.Join(t.TempDir(), "context.db"))
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+	defer b.Close()
+	for i, key := range []string{"a", "c", "e"} {
+		b.Put(DefaultNamespace, key, &Entry{Value: []byte("1")})
+		b.Append(DefaultNamespace, key, Revision{Index: uint64(i + 1)})
+	}
+	b.Create("ns")
+	b.Put("ns", "x", &Entry{Value: []byte("1")})
+	if err := b.Commit(3); err != nil {
+		t.Fatalf("error committing changes: %v", err)
+	}
+	// buffered changes are merged with those on disk, and take precedence
+	b.Put(DefaultNamespace, "b", &Entry{Value: []byte("2")})
+	b.Put(DefaultNamespace, "c", &Entry{Value: []byte("2")})
+	b.Delete(DefaultNamespace, "e")
+	b.Put(DefaultNamespace, "f", &Entry{Value: []byte("2")})
+	b.Append(DefaultNamespace, "b", Revision{Index: 4})
+	b.Append(DefaultNamespace, "c", Revision{Index: 5})
+	b.Append(DefaultNamespace, "e", Revision{Index: 6, Deleted: true})
+	b.Append(DefaultNamespace, "f", Revision{Index: 7})
+
+	tests := []struct {
+		name    string
+		history bool
+		from    string
+		limit   int
+		want    string
+	}{
+		{"all keys", false, "", 0, "a=1 b=2 c=2 f=2"},
+		{"from disk key", false, "c", 0, "c=2 f=2"},
+		{"from buffered key", false, "b", 0, "b=2 c=2 f=2"},
+		{"from missing key", false, "d", 0, "f=2"},
+		{"past last key", false, "g", 0, ""},
+		{"stop on disk key", false, "", 1, "a=1"},
+		{"stop on buffered key", false, "", 2, "a=1 b=2"},
+		{"all revisions", true, "", 0, "a@1 b@4 c@2,5 e@3,6 f@7"},
+		{"revisions from buffered key", true, "d", 0, "e@3,6 f@7"},
+		{"stop on merged revisions", true, "b", 2, "b@4 c@2,5"},
+	}
+	check := func(s storage, history bool, from string, limit int, want string) {
+		t.Helper()
+		if got := strings.Join(seek(s, DefaultNamespace, history, from, limit), " "); got != want {
+			t.Errorf("expected '%s', got '%s'", want, got)
+		}
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check(b, test.history, test.from, test.limit, test.want)
+		})
+	}
+
+	// a dropped namespace hides the keys on disk, even once created again
+	b.Drop("ns")
+	if got := seek(b, "ns", false, "", 0); len(got) != 0 {
+		t.Errorf("expected no keys in dropped namespace, got %v", got)
+	}
+	b.Create("ns")
+	b.Put("ns", "y", &Entry{Value: []byte("2")})
+	if got := strings.Join(seek(b, "ns", false, "", 0), " "); got != "y=2" {
+		t.Errorf("expected only the new key in created namespace, got '%s'", got)
+	}
+
+	// views only see what was committed when they were taken
+	view, err := b.View()
+	if err != nil {
+		t.Fatalf("error opening view: %v", err)
+	}
+	check(view, false, "", 0, "a=1 c=1 e=1")
+	check(view, true, "", 0, "a@1 c@2 e@3")
+	view.Close()
+	if err := b.Commit(7); err != nil {
+		t.Fatalf("error committing changes: %v", err)
+	}
+	check(b, false, "", 0, "a=1 b=2 c=2 f=2")
+	check(b, true, "", 0, "a@1 b@4 c@2,5 e@3,6 f@7")
+	if got := strings.Join(seek(b, "ns", false, "", 0), " "); got != "y=2" {
+		t.Errorf("expected only the new key in created namespace, got '%s'", got)
+	}
+}
+
+func TestBoltCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "context.db")
+	b, err := openBolt(path)
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+	b.Create("ns")
+	b.Put("ns", "k", &Entry{Value: []byte("1")})
+	for index := uint64(1); index <= 3; index++ {
+		b.Append("ns", "k", Revision{Index: index, Value: []byte{byte('0' + index)}})
+	}
+	// deleted keys are dropped in turn as the history is compacted
+	b.Append("ns", "gone", Revision{Index: 2, Deleted: true})
+	b.Append("ns", "gone2", Revision{Index: 1, Deleted: true})
+	b.Extra(leaseExtra, "1", &Lease{ID: 1})
+	b.Extra(leaseExtra, "2", &Lease{ID: 2})
+	// buffered changes are not written until committed
+	if index, err := b.load(); err != nil || index != 0 {
+		t.Fatalf("expected no applied index before commit, got %d (%v)", index, err)
+	}
+	if err := b.Commit(3); err != nil {
+		t.Fatalf("error committing changes: %v", err)
+	}
+	b.Extra(leaseExtra, "1", nil)
+	b.Compact(2)
+	if err := b.Flush(); err != nil {
+		t.Fatalf("error flushing changes: %v", err)
+	}
+	// changes to missing namespaces fail, and are kept for the next commit
+	b.Put("missing", "k", &Entry{})
+	if err := b.Commit(4); err == nil || !strings.Contains(err.Error(), "namespace 'missing' not found") {
+		t.Errorf("expected commit to missing namespace to fail, got %v", err)
+	}
+	if b.Get("missing", "k") == nil {
+		t.Errorf("expected failed commit to keep buffered changes")
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	b, err = openBolt(path)
+	if err != nil {
+		t.Fatalf("error reopening storage: %v", err)
+	}
+	if index, err := b.load(); err != nil || index != 3 {
+		t.Errorf("expected applied index 3, got %d (%v)", index, err)
+	}
+	if entry := b.Get("ns", "k"); entry == nil || string(entry.Value) != "1" {
+		t.Errorf("expected committed key, got %+v", entry)
+	}
+	// compaction keeps the revision current at its index, and drops deleted
+	// keys altogether
+	if got := strings.Join(seek(b, "ns", true, "", 0), " "); got != "k@2,3" {
+		t.Errorf("expected revisions 2 and 3 after compaction, got '%s'", got)
+	}
+	if records, err := b.Extras(leaseExtra); err != nil || len(records) != 1 || records["2"] == nil {
+		t.Errorf("expected only lease 2 to be stored, got %v (%v)", records, err)
+	}
+	b.Close()
+
+	// files written before the format was recorded are refused
+	b, err = openBolt(path)
+	if err != nil {
+		t.Fatalf("error reopening storage: %v", err)
+	}
+	b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Delete(formatKey)
+	})
+	b.Close()
+	if _, err := openBolt(path); err == nil || !strings.Contains(err.Error(), "unsupported file format") {
+		t.Errorf("expected file with no format to be refused, got %v", err)
+	}
+}
+
+func TestApplyBatchToBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "context.db")
+	c, err := OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error opening context: %v", err)
+	}
+	logs := []*raft.Log{}
+	for i, message := range []*Message{
+		{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")},
+		{Type: SetSchema, Namespace: DefaultNamespace, Key: "b", Value: []byte(`{"type":"string"}`)},
+		{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("1")},
+		{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("2")},
+	} {
+		data, err := c.encode(message)
+		if err != nil {
+			t.Fatalf("error encoding message: %v", err)
+		}
+		logs = append(logs, &raft.Log{Index: uint64(i + 1), Term: 1, Type: raft.LogCommand, Data: data})
+	}
+	// configuration changes are not for the context
+	logs = append(logs, &raft.Log{Index: 5, Term: 1, Type: raft.LogConfiguration, Data: []byte{0xFF}})
+	results := c.ApplyBatch(logs)
+	if len(results) != 5 {
+		t.Fatalf("expected a result per log entry, got %d", len(results))
+	}
+	// a failed command does not stop those that follow
+	if _, ok := results[2].(error); !ok {
+		t.Errorf("expected value not matching its schema to be refused, got %+v", results[2])
+	}
+	if result, ok := results[3].(*Message); !ok || result.Index != 4 {
+		t.Errorf("expected key set at index 4, got %+v", results[3])
+	}
+	if results[4] != nil {
+		t.Errorf("expected configuration change to be skipped, got %+v", results[4])
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing context: %v", err)
+	}
+	c, err = OpenContext(path, test.NewLogger(t))
+	if err != nil {
+		t.Fatalf("error reopening context: %v", err)
+	}
+	defer c.Close()
+	if index := c.AppliedIndex(); index != 4 {
+		t.Errorf("expected applied index 4, got %d", index)
+	}
+	if revisions, _, _ := c.History(DefaultNamespace, "a"); len(revisions) != 2 {
+		t.Errorf("expected both revisions of 'a' to be stored, got %+v", revisions)
+	}
+	if schemas, _ := c.Schemas(DefaultNamespace); len(schemas) != 1 {
+		t.Errorf("expected schema to be stored, got %+v", schemas)
+	}
+	// entries already in the batch are skipped when replayed
+	if results := c.ApplyBatch(logs[:2]); results[0] != nil || results[1] != nil {
+		t.Errorf("expected replayed entries to be skipped, got %+v", results)
+	}
+}
@@ -1,128 +1,873 @@
 package distributed
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"regexp"
 	"sync"
+	"time"
 
+	"github.com/dihedron/rafter/compression"
+	"github.com/dihedron/rafter/encryption"
 	"github.com/dihedron/rafter/logging"
 	"github.com/hashicorp/raft"
 )
 
-func NewContext(l logging.Logger) *Context {
+func NewContext(l logging.Logger, options ...Option) *Context {
 	l.Info("creating new distributed context...")
-	return &Context{
-		values: map[string][]byte{},
-		logger: l,
+	values := newMemory()
+	values.Create(DefaultNamespace)
+	return newContext(values, l, options...)
+}
+
+func newContext(values storage, l logging.Logger, options ...Option) *Context {
+	c := &Context{
+		storage:   values,
+		leases:    map[uint64]*Lease{},
+		locks:     map[string]*Lock{},
+		elections: map[string]*Election{},
+		queues:    map[string]*Queue{},
+		handlers:  builtins(),
+		pending:   map[string]json.RawMessage{},
+		sessions:  newLRU(nil),
+		schemas:   map[string]map[string]*Schema{},
+		dirty:     map[extra]struct{}{},
+		maxBatch:  DefaultMaxBatch,
+		retention: DefaultRetention,
+		applied:   make(chan struct{}),
+		hub:       newHub(),
+		imports:   &imports{ids: map[string]struct{}{}},
+		logger:    l,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Entry is a value in the distributed context, along with the index
+// of the Raft log entry that last modified it, the number of times it
+// was modified since it was created, the lease it is attached to, if
+// any, the index of the log entry that created it and the size of the
+// value, which is kept when the value is left out of a read; entries are
+// shared with snapshots and must never be modified once stored.
+type Entry struct {
+	Value   []byte `json:"value,omitempty"`
+	Index   uint64 `json:"index,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	Lease   uint64 `json:"lease,omitempty"`
+	Created uint64 `json:"created,omitempty"`
+	Size    uint64 `json:"size,omitempty"`
+}
+
+// size returns the size of the value of the entry; entries stored before
+// sizes were tracked have none, but still have their value.
+func (e *Entry) size() uint64 {
+	if e.Size == 0 {
+		return uint64(len(e.Value))
 	}
+	return e.Size
 }
 
-// Context is a cluster-wide shared, distributed context.
+// Context is a cluster-wide shared, distributed context; the values of
+// each namespace and the revisions of each key since the last compaction
+// are held by its storage, either in memory or on disk. The index is the
+// one of the log entry being applied, while readers are served as of the
+// settled index, that of the last entry whose changes are complete.
 type Context struct {
-	mtx    sync.RWMutex
-	values map[string][]byte
-	logger logging.Logger
+	mtx       sync.RWMutex
+	storage   storage
+	compacted uint64
+	leases    map[uint64]*Lease
+	locks     map[string]*Lock
+	elections map[string]*Election
+	queues    map[string]*Queue
+	handlers  map[Type]*Handler
+	pending   map[string]json.RawMessage
+	sessions  *lru
+	schemas   map[string]map[string]*Schema
+	dirty     map[extra]struct{}
+	index     uint64
+	term      uint64
+	settled   uint64
+	applied   chan struct{}
+	hub       *hub
+	imports   *imports
+	keyring   *encryption.Keyring
+	codec     compression.Codec
+	threshold int
+	maxBatch  int
+	retention uint64
+	logger    logging.Logger
 }
 
-var _ raft.FSM = &Context{}
+var _ raft.BatchingFSM = &Context{}
 
 func (c *Context) Apply(l *raft.Log) interface{} {
-	var err error
+	result, changed := c.apply(l)
+	if changed {
+		c.commit()
+	}
+	return result
+}
+
+// ApplyBatch applies the commands among the given log entries in order, and
+// persists the changes they made all at once.
+func (c *Context) ApplyBatch(logs []*raft.Log) []interface{} {
+	results := make([]interface{}, len(logs))
+	changed := false
+	for i, l := range logs {
+		if l.Type != raft.LogCommand {
+			continue
+		}
+		var ok bool
+		results[i], ok = c.apply(l)
+		changed = changed || ok
+	}
+	if changed {
+		c.commit()
+	}
+	return results
+}
+
+// apply applies a log entry and tells whether it changed the state, which
+// must then be committed; entries that cannot be decoded, and those that
+// were already applied, do not.
+func (c *Context) apply(l *raft.Log) (interface{}, bool) {
 	c.logger.Trace("applying log entry: %s", logging.ToJSON(l))
-	message := &Message{}
-	if err = json.Unmarshal(l.Data, message); err != nil {
-		c.logger.Error("error unmarshalling message: %v", err)
-		return fmt.Errorf("error unmarshalling input message: %w", err)
+	message, err := Decode(l.Data)
+	if err != nil {
+		c.logger.Error("error decoding message: %v", err)
+		return fmt.Errorf("error decoding input message: %w", err), false
 	}
-	var result *Message
-	switch message.Type {
-	case Get:
-		c.mtx.RLock()
-		value := c.values[message.Key]
-		c.mtx.RUnlock()
-		result = &Message{
-			Key:   message.Key,
-			Value: []byte(value),
-			Index: l.Index,
+	c.mtx.Lock()
+	if l.Index <= c.index {
+		// already in the durable storage when the node was restarted; the
+		// term is not stored, but is known again once the last entry is
+		// replayed
+		if l.Index == c.index {
+			c.term = l.Term
 		}
-	case Set:
-		c.mtx.Lock()
-		c.values[message.Key] = message.Value
 		c.mtx.Unlock()
-		result = &Message{
-			Index: l.Index,
+		c.logger.Debug("skipping log entry at index %d (applied: %d)", l.Index, c.index)
+		return nil, false
+	}
+	c.index = l.Index
+	c.term = l.Term
+	c.mtx.Unlock()
+	handler, ok := c.handlers[message.Type]
+	if !ok {
+		c.logger.Error("unknown command type %d at index %d", message.Type, l.Index)
+		return fmt.Errorf("unknown command type %d at index %d", message.Type, l.Index), true
+	}
+	defer c.changed(handler)
+	if message.Client == "" {
+		return c.execute(l, handler, message), true
+	}
+	if outcome, ok := c.replay(message); ok {
+		c.logger.Debug("skipping request %d of client '%s' at index %d: already applied", message.Sequence, message.Client, l.Index)
+		return outcome, true
+	}
+	result := c.execute(l, handler, message)
+	c.remember(message, l, result)
+	return result, true
+}
+
+// execute applies a message with its handler.
+func (c *Context) execute(l *raft.Log, handler *Handler, message *Message) interface{} {
+	var err error
+	if handler.Decode != nil {
+		if message.Args, err = handler.Decode(message.Payload); err != nil {
+			c.logger.Error("error decoding arguments of command '%s': %v", handler.Name, err)
+			return fmt.Errorf("error decoding arguments of command '%s': %w", handler.Name, err)
 		}
-	case Remove:
-		c.mtx.Lock()
-		value := c.values[message.Key]
-		delete(c.values, message.Key)
+	}
+	if message.Namespace == "" {
+		message.Namespace = DefaultNamespace
+	}
+	if handler.Namespaced {
+		if err := c.checkNamespace(message.Namespace); err != nil {
+			return err
+		}
+	}
+	result, err := handler.Apply(c, l, message)
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// applyGet reads a key through the log.
+func (c *Context) applyGet(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.RLock()
+	entry := c.lookup(message.Namespace, message.Key)
+	c.mtx.RUnlock()
+	result := &Message{
+		Key:   message.Key,
+		Index: l.Index,
+	}
+	if entry != nil {
+		result.Value = entry.Value
+		result.ModIndex = entry.Index
+		result.Entry = entry
+	}
+	return result, nil
+}
+
+// applySet sets the value of a key, attaching it to a lease if requested.
+func (c *Context) applySet(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	if _, ok := c.leases[message.Lease]; message.Lease != 0 && !ok {
 		c.mtx.Unlock()
-		result = &Message{
-			Key:   message.Key,
-			Value: value,
-			Index: l.Index,
+		c.logger.Error("lease %d not found", message.Lease)
+		return nil, fmt.Errorf("lease %d not found", message.Lease)
+	}
+	if err := c.validate(message.Namespace, message.Key, message.Value); err != nil {
+		c.mtx.Unlock()
+		c.logger.Error("error setting key '%s': %v", message.Key, err)
+		return nil, err
+	}
+	c.put(message.Namespace, message.Key, message.Value, l.Index)
+	lease := message.Lease
+	if message.TTL > 0 {
+		// the key gets its own lease
+		c.leases[l.Index] = newLease(l.Index, message.TTL, message.Time)
+		c.touch(extra{kind: leaseExtra, id: l.Index})
+		lease = l.Index
+	}
+	if lease != 0 {
+		c.attach(Key{Namespace: message.Namespace, Name: message.Key}, lease)
+	}
+	c.mtx.Unlock()
+	c.hub.publish(Event{Index: l.Index, Type: Put, Namespace: message.Namespace, Key: message.Key, Value: message.Value})
+	return &Message{
+		Index: l.Index,
+		Lease: lease,
+	}, nil
+}
+
+// applyRemove deletes a key.
+func (c *Context) applyRemove(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	entry := c.remove(message.Namespace, message.Key)
+	c.mtx.Unlock()
+	result := &Message{
+		Key:   message.Key,
+		Index: l.Index,
+	}
+	if entry != nil {
+		result.Value = entry.Value
+		result.Entry = entry
+		c.hub.publish(Event{Index: l.Index, Type: Delete, Namespace: message.Namespace, Key: message.Key})
+	}
+	return result, nil
+}
+
+// applyList lists the keys matching a filter through the log.
+func (c *Context) applyList(l *raft.Log, message *Message) (interface{}, error) {
+	var err error
+	var re *regexp.Regexp
+	if message.Filter != "" {
+		if re, err = regexp.Compile(message.Filter); err != nil {
+			c.logger.Error("error compiling regular expression '%s': %v", message.Filter, err)
+			return nil, fmt.Errorf("error compiling regular expression '%s': %w", message.Filter, err)
 		}
-	case List:
-		var re *regexp.Regexp
-		if message.Filter != "" {
-			if re, err = regexp.Compile(message.Filter); err != nil {
-				c.logger.Error("error compiling regular expression '%s': %v", message.Filter, err)
-				return fmt.Errorf("error compiling regular expression '%s': %w", message.Filter, err)
-			}
+	}
+	c.mtx.RLock()
+	keys := c.keys(message.Namespace, re)
+	c.mtx.RUnlock()
+	return &Message{
+		Keys:  keys,
+		Index: l.Index,
+	}, nil
+}
+
+// applyClear deletes the keys matching a filter.
+func (c *Context) applyClear(l *raft.Log, message *Message) (interface{}, error) {
+	var err error
+	var re *regexp.Regexp
+	if message.Filter != "" {
+		if re, err = regexp.Compile(message.Filter); err != nil {
+			c.logger.Error("error compiling regular expression '%s': %v", message.Filter, err)
+			return nil, fmt.Errorf("error compiling regular expression '%s': %w", message.Filter, err)
 		}
-		c.mtx.RLock()
-		keys := []string{}
-		for k := range c.values {
-			if re == nil || re.Match([]byte(k)) {
-				keys = append(keys, k)
-			}
+	}
+	c.mtx.Lock()
+	removed := c.clear(message.Namespace, re)
+	c.mtx.Unlock()
+	c.hub.publish(deletions(l.Index, removed)...)
+	return &Message{
+		Removed: removed,
+		Index:   l.Index,
+	}, nil
+}
+
+// applyCompareAndSwap sets the value of a key if its precondition holds.
+func (c *Context) applyCompareAndSwap(l *raft.Log, message *Message) (interface{}, error) {
+	var result *Message
+	c.mtx.Lock()
+	entry := c.lookup(message.Namespace, message.Key)
+	if matches(entry, message) {
+		if err := c.validate(message.Namespace, message.Key, message.Value); err != nil {
+			c.mtx.Unlock()
+			c.logger.Error("error swapping key '%s': %v", message.Key, err)
+			return nil, err
 		}
-		c.mtx.RUnlock()
+		c.put(message.Namespace, message.Key, message.Value, l.Index)
 		result = &Message{
-			Keys:  keys,
-			Index: l.Index,
+			Key:       message.Key,
+			Value:     message.Value,
+			ModIndex:  l.Index,
+			Succeeded: true,
+			Entry:     c.lookup(message.Namespace, message.Key),
 		}
-	case Clear:
-		c.mtx.Lock()
-		value := c.values[message.Key]
-		c.values[message.Key] = message.Value
-		c.mtx.Unlock()
+	} else {
+		// precondition failed: report the current state of the key
 		result = &Message{
 			Key:   message.Key,
-			Value: value,
-			Index: l.Index,
+			Entry: entry,
+		}
+		if entry != nil {
+			result.Value = entry.Value
+			result.ModIndex = entry.Index
 		}
 	}
+	c.mtx.Unlock()
+	if result.Succeeded {
+		c.hub.publish(Event{Index: l.Index, Type: Put, Namespace: message.Namespace, Key: message.Key, Value: message.Value})
+	}
+	result.Index = l.Index
+	return result, nil
+}
+
+// applyGrant creates a lease.
+func (c *Context) applyGrant(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	c.leases[l.Index] = newLease(l.Index, message.TTL, message.Time)
+	c.touch(extra{kind: leaseExtra, id: l.Index})
+	c.mtx.Unlock()
+	return &Message{
+		Lease: l.Index,
+		TTL:   message.TTL,
+		Index: l.Index,
+	}, nil
+}
+
+// applyRevoke drops a lease along with its keys.
+func (c *Context) applyRevoke(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	if _, ok := c.leases[message.Lease]; !ok {
+		c.mtx.Unlock()
+		c.logger.Error("lease %d not found", message.Lease)
+		return nil, fmt.Errorf("lease %d not found", message.Lease)
+	}
+	removed := c.revoke(message.Lease)
+	c.mtx.Unlock()
+	c.hub.publish(deletions(l.Index, removed)...)
+	return &Message{
+		Lease:   message.Lease,
+		Removed: removed,
+		Index:   l.Index,
+	}, nil
+}
+
+// applyKeepAlive renews a lease.
+func (c *Context) applyKeepAlive(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	lease, ok := c.leases[message.Lease]
+	if !ok {
+		c.mtx.Unlock()
+		c.logger.Error("lease %d not found", message.Lease)
+		return nil, fmt.Errorf("lease %d not found", message.Lease)
+	}
+	lease.renew(message.Time)
+	c.touch(extra{kind: leaseExtra, id: lease.ID})
+	c.mtx.Unlock()
+	return &Message{
+		Lease: lease.ID,
+		TTL:   lease.TTL,
+		Index: l.Index,
+	}, nil
+}
+
+// applyTxn runs a transaction.
+func (c *Context) applyTxn(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	result, events, err := c.transact(message, l.Index)
+	c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("error applying transaction at index %d: %v", l.Index, err)
+		return nil, err
+	}
+	c.hub.publish(events...)
+	return result, nil
+}
+
+// applyExpire revokes the leases expired as per the leader's clock.
+func (c *Context) applyExpire(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	removed := c.expire(message.Time)
+	c.mtx.Unlock()
+	c.hub.publish(deletions(l.Index, removed)...)
+	return &Message{
+		Removed: removed,
+		Index:   l.Index,
+	}, nil
+}
+
+// applyCreateNamespace adds an empty namespace.
+func (c *Context) applyCreateNamespace(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	err := c.create(message.Namespace)
+	c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("error creating namespace: %v", err)
+		return nil, err
+	}
+	return &Message{
+		Namespace: message.Namespace,
+		Index:     l.Index,
+	}, nil
+}
+
+// applyDropNamespace removes a namespace along with its keys.
+func (c *Context) applyDropNamespace(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	removed, err := c.drop(message.Namespace)
+	c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("error dropping namespace: %v", err)
+		return nil, err
+	}
+	c.hub.publish(deletions(l.Index, removed)...)
+	return &Message{
+		Namespace: message.Namespace,
+		Removed:   removed,
+		Index:     l.Index,
+	}, nil
+}
+
+// applyCount increments a counter or allocates a block from a sequence.
+func (c *Context) applyCount(l *raft.Log, message *Message) (interface{}, error) {
+	count := c.increment
+	if message.Type == Allocate {
+		count = c.allocate
+	}
+	c.mtx.Lock()
+	result, events, err := count(message, l.Index)
+	c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("error updating counter '%s': %v", message.Key, err)
+		return nil, err
+	}
+	c.hub.publish(events...)
+	return result, nil
+}
+
+// applyEnqueue appends an item to a queue.
+func (c *Context) applyEnqueue(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	c.enqueue(message.Key, message.Value, l.Index)
+	c.mtx.Unlock()
+	return &Message{
+		Key:   message.Key,
+		Item:  l.Index,
+		Index: l.Index,
+	}, nil
+}
+
+// applyDequeue takes the first visible item of a queue.
+func (c *Context) applyDequeue(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	item := c.dequeue(message.Key, message.Time.Add(time.Duration(message.TTL)*time.Second))
+	c.mtx.Unlock()
+	result := &Message{
+		Key:   message.Key,
+		Index: l.Index,
+	}
+	if item != nil {
+		result.Succeeded = true
+		result.Item = item.ID
+		result.Value = item.Value
+		result.Number = item.Deliveries
+	}
+	return result, nil
+}
+
+// applySettle acknowledges or rejects an item in flight.
+func (c *Context) applySettle(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	err := c.settle(message.Key, message.Item, message.Type == Ack)
+	c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("error settling item %d of queue '%s': %v", message.Item, message.Key, err)
+		return nil, err
+	}
+	return &Message{
+		Key:   message.Key,
+		Item:  message.Item,
+		Index: l.Index,
+	}, nil
+}
+
+// applyRequeue makes the items past their deadline visible again.
+func (c *Context) applyRequeue(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	count := c.requeue(message.Time)
+	c.mtx.Unlock()
+	c.logger.Debug("%d queue items visible again after timeout", count)
+	return &Message{
+		Number: int64(count),
+		Index:  l.Index,
+	}, nil
+}
+
+// applyAcquire acquires a lock, or queues for it.
+func (c *Context) applyAcquire(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	lock, err := c.acquire(message.Key, message.Lease, message.Type == Acquire)
+	if err != nil {
+		c.mtx.Unlock()
+		c.logger.Error("error acquiring lock '%s': %v", message.Key, err)
+		return nil, err
+	}
+	result := &Message{
+		Key:       message.Key,
+		Lease:     lock.Session,
+		Succeeded: lock.Session == message.Lease,
+		Index:     l.Index,
+	}
+	if result.Succeeded {
+		result.Token = lock.Token
+	}
+	c.mtx.Unlock()
+	return result, nil
+}
+
+// applyRelease releases a lock, or stops waiting for it.
+func (c *Context) applyRelease(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	err := c.release(message.Key, message.Lease)
+	c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("error releasing lock '%s': %v", message.Key, err)
+		return nil, err
+	}
+	return &Message{
+		Key:   message.Key,
+		Index: l.Index,
+	}, nil
+}
+
+// applyCampaign enters a session into an election.
+func (c *Context) applyCampaign(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	election, err := c.campaign(message.Key, Candidate{Session: message.Lease, Value: message.Value})
+	if err != nil {
+		c.mtx.Unlock()
+		c.logger.Error("error campaigning in election '%s': %v", message.Key, err)
+		return nil, err
+	}
+	result := &Message{
+		Key:       message.Key,
+		Lease:     election.Leader.Session,
+		Value:     election.Leader.Value,
+		Succeeded: election.Leader.Session == message.Lease,
+		Index:     l.Index,
+	}
+	if result.Succeeded {
+		result.Token = election.Term
+	}
+	c.mtx.Unlock()
+	return result, nil
+}
 
-	data, err := json.Marshal(result)
+// applyResign steps a session down from an election.
+func (c *Context) applyResign(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	err := c.resign(message.Key, message.Lease)
+	c.mtx.Unlock()
 	if err != nil {
-		c.logger.Error("error marshalling response: %v", err)
+		c.logger.Error("error resigning from election '%s': %v", message.Key, err)
+		return nil, err
+	}
+	return &Message{
+		Key:   message.Key,
+		Index: l.Index,
+	}, nil
+}
+
+// applyCompact drops the revisions superseded before an index.
+func (c *Context) applyCompact(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	if message.Revision <= c.compacted || message.Revision > l.Index {
+		compacted := c.compacted
+		c.mtx.Unlock()
+		c.logger.Error("invalid compaction revision %d (compacted: %d, index: %d)", message.Revision, compacted, l.Index)
+		return nil, fmt.Errorf("invalid compaction revision %d (compacted: %d, index: %d)", message.Revision, compacted, l.Index)
+	}
+	c.compact(message.Revision)
+	c.mtx.Unlock()
+	c.logger.Info("revisions compacted up to index %d", message.Revision)
+	return &Message{
+		Revision: message.Revision,
+		Index:    l.Index,
+	}, nil
+}
+
+// put sets the value of a key, detaching it from its lease if any, records
+// the new revision and returns the previous entry; it must be called with
+// the lock held.
+func (c *Context) put(namespace string, key string, value []byte, index uint64) *Entry {
+	previous := c.lookup(namespace, key)
+	version, created := uint64(1), index
+	if previous != nil {
+		c.detach(Key{Namespace: namespace, Name: key})
+		version, created = previous.Version+1, previous.Created
+	}
+	c.store(namespace, key, &Entry{Value: value, Index: index, Version: version, Created: created, Size: uint64(len(value))})
+	c.record(namespace, key, Revision{Index: index, Value: value, Version: version, Created: created})
+	return previous
+}
+
+// remove deletes a key, detaching it from its lease if any, records its
+// deletion at the index being applied and returns the removed entry; it
+// must be called with the lock held.
+func (c *Context) remove(namespace string, key string) *Entry {
+	c.detach(Key{Namespace: namespace, Name: key})
+	entry := c.storage.Delete(namespace, key)
+	if entry == nil {
 		return nil
 	}
-	return data
+	c.record(namespace, key, Revision{Index: c.index, Version: entry.Version, Created: entry.Created, Deleted: true})
+	return entry
+}
+
+// lookup returns the entry for a key, or nil; it must be called with the
+// lock held.
+func (c *Context) lookup(namespace string, key string) *Entry {
+	return c.storage.Get(namespace, key)
+}
+
+// store replaces the entry for a key in an existing namespace; it must be
+// called with the lock held.
+func (c *Context) store(namespace string, key string, entry *Entry) {
+	c.storage.Put(namespace, key, entry)
+}
+
+// changed records that the state of a custom command may have been changed
+// by the log entry just applied with its handler, so that it is persisted
+// on commit.
+func (c *Context) changed(handler *Handler) {
+	if handler.Snapshot != nil && !handler.KeysOnly {
+		c.mtx.Lock()
+		c.touch(extra{kind: commandExtra, name: handler.Name})
+		c.mtx.Unlock()
+	}
+}
+
+// commit persists the changes made by the log entries applied since the
+// last commit, along with the records of the rest of the state they changed,
+// and then makes them visible to readers.
+func (c *Context) commit() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	err := c.persist()
+	if err == nil {
+		err = c.storage.Commit(c.index)
+	}
+	if err != nil {
+		// the storage no longer matches the log: better to stop and replay
+		// the entry after a restart than to diverge from the other nodes
+		c.logger.Error("error persisting log entries up to index %d: %v", c.index, err)
+		panic(fmt.Sprintf("error persisting log entries up to index %d: %v", c.index, err))
+	}
+	c.advance(c.index)
+}
+
+// advance records the index of the last applied log entry and wakes up
+// any reader waiting for it; it must be called with the lock held.
+func (c *Context) advance(index uint64) {
+	c.index = index
+	c.settled = index
+	close(c.applied)
+	c.applied = make(chan struct{})
+}
+
+// matches checks whether the current entry satisfies the precondition of
+// a compare-and-swap message.
+func matches(entry *Entry, message *Message) bool {
+	switch message.Condition {
+	case IfIndex:
+		if entry == nil {
+			return message.PrevIndex == 0
+		}
+		return entry.Index == message.PrevIndex
+	case IfValue:
+		return entry != nil && bytes.Equal(entry.Value, message.PrevValue)
+	case IfVersion:
+		if entry == nil {
+			return message.PrevVersion == 0
+		}
+		return entry.Version == message.PrevVersion
+	}
+	return false
+}
+
+// deletions returns the events for the removal of the given keys.
+func deletions(index uint64, keys []Key) []Event {
+	events := make([]Event, 0, len(keys))
+	for _, key := range keys {
+		events = append(events, Event{Index: index, Type: Delete, Namespace: key.Namespace, Key: key.Name})
+	}
+	return events
 }
 
 func (c *Context) Snapshot() (raft.FSMSnapshot, error) {
-	// Make sure that any future calls to f.Apply() don't change the snapshot.
-	data, err := json.Marshal(c.values)
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	// the view is a point-in-time copy, so any future calls to c.Apply()
+	// won't change the snapshot; leases are small, and their keys are
+	// rebuilt on restore
+	leases := make([]Lease, 0, len(c.leases))
+	for _, lease := range c.leases {
+		leases = append(leases, Lease{ID: lease.ID, TTL: lease.TTL, Expires: lease.Expires})
+	}
+	locks := make([]Lock, 0, len(c.locks))
+	for _, lock := range c.locks {
+		locks = append(locks, Lock{Name: lock.Name, Session: lock.Session, Token: lock.Token, Waiters: append([]uint64{}, lock.Waiters...)})
+	}
+	elections := make([]Election, 0, len(c.elections))
+	for _, election := range c.elections {
+		elections = append(elections, Election{Name: election.Name, Leader: election.Leader, Term: election.Term, Candidates: append([]Candidate{}, election.Candidates...)})
+	}
+	commands, err := c.snapshotCommands()
+	if err != nil {
+		c.logger.Error("error taking snapshot: %v", err)
+		return nil, err
+	}
+	view, err := c.storage.View()
 	if err != nil {
-		return nil, fmt.Errorf("error marshalling snapshot content to JSON: %w", err)
+		c.logger.Error("error taking snapshot: %v", err)
+		return nil, err
 	}
-	return &Snapshot{data: data}, nil
+	queues := make(map[string]*Queue, len(c.queues))
+	for name, queue := range c.queues {
+		queues[name] = &Queue{ready: queue.ready, inflight: queue.inflight}
+	}
+	return &Snapshot{
+		index:     c.index,
+		term:      c.term,
+		compacted: c.compacted,
+		view:      view,
+		leases:    leases,
+		locks:     locks,
+		elections: elections,
+		queues:    queues,
+		commands:  commands,
+		sessions:  c.snapshotSessions(),
+		schemas:   c.snapshotSchemas(),
+		keyring:   c.keyring,
+		codec:     c.codec,
+	}, nil
 }
 
 func (c *Context) Restore(r io.ReadCloser) error {
-	data, err := ioutil.ReadAll(r)
+	defer r.Close()
+	// the snapshot is restored into a new storage, so that the current one
+	// is left untouched if it turns out to be invalid
+	values, err := c.storage.Empty()
+	if err != nil {
+		c.logger.Error("error restoring snapshot: %v", err)
+		return err
+	}
+	var s *state
+	envelope, err := OpenEnvelope(r)
+	if err != nil {
+		values.Close()
+		c.logger.Error("error restoring snapshot: %v", err)
+		return err
+	}
+	if envelope.Info() == nil {
+		// only the snapshots taken before the format was streamed, which
+		// were neither compressed nor encrypted, have no envelope
+		c.logger.Warn("restoring legacy snapshot with no envelope, which cannot be verified")
+		s, err = restoreLegacy(envelope, values)
+	} else {
+		var plaintext io.Reader
+		plaintext, err = c.keyring.Reader(envelope)
+		if err == nil {
+			// snapshots taken without a codec have no compression header
+			plaintext, err = compression.Reader(plaintext)
+		}
+		if err == nil {
+			s, err = restore(plaintext, values)
+		}
+		if err == nil {
+			_, err = envelope.Verify(int64(s.entries))
+		} else if _, verr := envelope.Verify(-1); verr != nil {
+			// a damaged snapshot is better described by its envelope
+			err = verr
+		}
+	}
+	if err == nil {
+		// the records are written before the commands take their state
+		s.save(values)
+		err = c.restoreCommands(s.commands)
+	}
+	if err == nil {
+		err = values.Commit(s.index)
+	}
 	if err != nil {
+		values.Close()
+		c.logger.Error("error restoring snapshot: %v", err)
+		return err
+	}
+	attach(values, s.leases)
+	c.mtx.Lock()
+	previous := c.storage
+	if c.storage, err = previous.Replace(values); err != nil {
+		c.storage = previous
+		c.mtx.Unlock()
+		values.Close()
+		c.logger.Error("error restoring snapshot: %v", err)
 		return err
 	}
-	cache := map[string][]byte{}
-	if err := json.Unmarshal(data, &cache); err != nil {
-		return fmt.Errorf("error unmarshalling snapshot content from JSON: %w", err)
+	if info := envelope.Info(); info != nil {
+		c.term = info.Term
+	}
+	c.compacted = s.compacted
+	c.leases = s.leases
+	c.locks = s.locks
+	c.elections = s.elections
+	c.queues = s.queues
+	c.sessions = newLRU(s.sessions)
+	c.schemas = s.schemas
+	c.advance(s.index)
+	c.mtx.Unlock()
+	// closing a file waits for the views still reading from it, which must
+	// not hold up the context
+	if err := previous.Close(); err != nil {
+		c.logger.Warn("error closing the storage replaced by the snapshot: %v", err)
 	}
-	c.values = cache
+	// watchers cannot resume from before the snapshot
+	c.hub.reset(s.index)
+	c.logger.Info("snapshot restored at index %d (%d leases)", s.index, len(s.leases))
 	return nil
 }
+
+// attach rebuilds the set of keys attached to each lease.
+func attach(values storage, leases map[uint64]*Lease) {
+	for _, name := range values.Namespaces() {
+		values.Seek(name, false, nil, func(k []byte, v interface{}) bool {
+			if entry := v.(*Entry); entry.Lease != 0 {
+				if lease, ok := leases[entry.Lease]; ok {
+					lease.Keys[Key{Namespace: name, Name: string(k)}] = struct{}{}
+				}
+			}
+			return false
+		})
+	}
+}
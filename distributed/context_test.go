@@ -0,0 +1,160 @@
+package distributed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+	"github.com/hashicorp/raft"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   *Message
+		succeeded bool
+		value     string
+	}{
+		{"index matches", &Message{Condition: IfIndex, PrevIndex: 2}, true, "new"},
+		{"index is stale", &Message{Condition: IfIndex, PrevIndex: 1}, false, "2"},
+		{"value matches", &Message{Condition: IfValue, PrevValue: []byte("2")}, true, "new"},
+		{"value differs", &Message{Condition: IfValue, PrevValue: []byte("1")}, false, "2"},
+		{"version matches", &Message{Condition: IfVersion, PrevVersion: 2}, true, "new"},
+		{"version differs", &Message{Condition: IfVersion, PrevVersion: 1}, false, "2"},
+		{"create on existing key", &Message{Condition: IfIndex, PrevIndex: 0}, false, "2"},
+		{"no condition", &Message{}, false, "2"},
+	}
+	logger := test.NewLogger(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewContext(logger)
+			apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+			apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("2")})
+			test.message.Type = CompareAndSwap
+			test.message.Namespace = DefaultNamespace
+			test.message.Key = "a"
+			test.message.Value = []byte("new")
+			result := apply(t, c, 3, test.message)
+			if result.Succeeded != test.succeeded {
+				t.Fatalf("expected swap to succeed: %t, got %t", test.succeeded, result.Succeeded)
+			}
+			if string(result.Value) != test.value {
+				t.Errorf("expected value '%s' in result, got '%s'", test.value, result.Value)
+			}
+			entry, _ := c.Read(DefaultNamespace, "a")
+			if string(entry.Value) != test.value {
+				t.Errorf("expected value '%s', got '%s'", test.value, entry.Value)
+			}
+			// a failed swap reports the current modification index
+			if test.succeeded && (result.ModIndex != 3 || entry.Version != 3) {
+				t.Errorf("expected key modified at 3 with version 3, got %d and %d", result.ModIndex, entry.Version)
+			} else if !test.succeeded && result.ModIndex != 2 {
+				t.Errorf("expected modification index 2, got %d", result.ModIndex)
+			}
+		})
+	}
+}
+
+func TestCompareAndSwapCreate(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	// an index or version of 0 requires the key not to exist
+	for i, message := range []*Message{
+		{Condition: IfIndex, PrevIndex: 0},
+		{Condition: IfVersion, PrevVersion: 0},
+	} {
+		key := string(rune('a' + i))
+		message.Type = CompareAndSwap
+		message.Namespace = DefaultNamespace
+		message.Key = key
+		message.Value = []byte("1")
+		if result := apply(t, c, uint64(2*i+1), message); !result.Succeeded {
+			t.Errorf("expected key '%s' to be created", key)
+		}
+		if result := apply(t, c, uint64(2*i+2), message); result.Succeeded {
+			t.Errorf("expected existing key '%s' not to be created again", key)
+		}
+	}
+	// a key that does not exist has no value to match
+	result := apply(t, c, 5, &Message{Type: CompareAndSwap, Namespace: DefaultNamespace, Key: "c", Condition: IfValue, Value: []byte("1")})
+	if result.Succeeded || result.Entry != nil {
+		t.Errorf("expected swap of missing key to fail, got %+v", result)
+	}
+}
+
+// refused applies a message that is expected to fail, and returns the error.
+func refused(t *testing.T, c *Context, index uint64, message *Message) error {
+	t.Helper()
+	data, err := c.encode(message)
+	if err != nil {
+		t.Fatalf("error encoding message: %v", err)
+	}
+	err, _ = c.Apply(&raft.Log{Index: index, Term: 1, Data: data}).(error)
+	return err
+}
+
+func TestApplyResults(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	// results are typed messages carrying the index they were applied at
+	if result := apply(t, c, 2, &Message{Type: Get, Key: "a"}); result == nil || string(result.Value) != "1" || result.ModIndex != 1 || result.Index != 2 {
+		t.Errorf("expected value read at index 2, got %+v", result)
+	}
+	// failures are errors, and the commands that fail still advance the
+	// applied index
+	tests := []struct {
+		name    string
+		data    []byte
+		applied uint64
+	}{
+		{"undecodable", []byte{0xFF}, 2},
+		{"unknown type", func() []byte { data, _ := Encode(&Message{Type: Type(127)}); return data }(), 4},
+		{"unknown namespace", func() []byte { data, _ := Encode(&Message{Type: Set, Namespace: "missing", Key: "a"}); return data }(), 5},
+	}
+	for i, test := range tests {
+		if _, ok := c.Apply(&raft.Log{Index: uint64(i + 3), Term: 1, Data: test.data}).(error); !ok {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if applied := c.AppliedIndex(); applied != test.applied {
+			t.Errorf("%s: expected applied index %d, got %d", test.name, test.applied, applied)
+		}
+	}
+	// entries already applied are skipped
+	data, _ := Encode(&Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("2")})
+	if result := c.Apply(&raft.Log{Index: 1, Term: 1, Data: data}); result != nil {
+		t.Errorf("expected replayed entry to be skipped, got %+v", result)
+	}
+	if entry, _ := c.Read(DefaultNamespace, "a"); string(entry.Value) != "1" {
+		t.Errorf("expected replayed entry not to change the key, got '%s'", entry.Value)
+	}
+}
+
+func TestKeyMetadata(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	lease := apply(t, c, 1, &Message{Type: Grant, TTL: 60, Time: time.Now()}).Lease
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	apply(t, c, 3, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("22"), Lease: lease})
+	expected := Entry{Value: []byte("22"), Index: 3, Version: 2, Lease: lease, Created: 2, Size: 2}
+	if entry, _ := c.Read(DefaultNamespace, "a"); entry == nil || fmt.Sprint(*entry) != fmt.Sprint(expected) {
+		t.Errorf("expected %+v, got %+v", expected, entry)
+	}
+	// conditional writes report the metadata of the key after the swap
+	result := apply(t, c, 4, &Message{Type: CompareAndSwap, Namespace: DefaultNamespace, Key: "a", Condition: IfVersion, PrevVersion: 2, Value: []byte("333")})
+	if entry := result.Entry; entry == nil || entry.Version != 3 || entry.Created != 2 || entry.Size != 3 || entry.Lease != 0 {
+		t.Errorf("expected version 3 created at 2 with no lease after the swap, got %+v", entry)
+	}
+	// and removals those of the removed key
+	result = apply(t, c, 5, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "a"})
+	if entry := result.Entry; entry == nil || entry.Index != 4 || entry.Version != 3 {
+		t.Errorf("expected removed key at version 3, got %+v", entry)
+	}
+	// a key created again starts over
+	apply(t, c, 6, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	if entry, _ := c.Read(DefaultNamespace, "a"); entry.Version != 1 || entry.Created != 6 {
+		t.Errorf("expected recreated key at version 1 created at 6, got %+v", entry)
+	}
+	result = apply(t, c, 7, &Message{Type: Txn, Namespace: DefaultNamespace, Success: []Operation{{Type: Get, Key: "a"}}})
+	if entry := result.Results[0].Entry; entry == nil || entry.Version != 1 || entry.Created != 6 {
+		t.Errorf("expected transaction read to carry the metadata, got %+v", entry)
+	}
+}
@@ -0,0 +1,82 @@
+package distributed
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// counter returns the value of an integer key, 0 if the key does not
+// exist; it must be called with the lock held.
+func (c *Context) counter(namespace string, key string) (int64, error) {
+	entry := c.lookup(namespace, key)
+	if entry == nil {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(string(entry.Value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("key '%s' does not hold an integer: %w", key, err)
+	}
+	return value, nil
+}
+
+// increment adds the delta of the message to an integer key, unless the
+// result would fall outside the bounds of the message; the result holds
+// the new value, or the current one if the increment was refused. Like any
+// other value, the new one must match the schemas of the key. It must be
+// called with the lock held.
+func (c *Context) increment(message *Message, index uint64) (*Message, []Event, error) {
+	current, err := c.counter(message.Namespace, message.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := current + message.Delta
+	if (message.Delta > 0 && next < current) || (message.Delta < 0 && next > current) {
+		return nil, nil, fmt.Errorf("incrementing key '%s' by %d overflows", message.Key, message.Delta)
+	}
+	result := &Message{
+		Key:    message.Key,
+		Number: current,
+		Index:  index,
+	}
+	if (message.Min != nil && next < *message.Min) || (message.Max != nil && next > *message.Max) {
+		return result, nil, nil
+	}
+	value := []byte(strconv.FormatInt(next, 10))
+	if err := c.validate(message.Namespace, message.Key, value); err != nil {
+		return nil, nil, err
+	}
+	c.put(message.Namespace, message.Key, value, index)
+	result.Number = next
+	result.Succeeded = true
+	return result, []Event{{Index: index, Type: Put, Namespace: message.Namespace, Key: message.Key, Value: value}}, nil
+}
+
+// allocate reserves a block of Delta identifiers from a sequence key,
+// which holds the last identifier handed out; the result holds the first
+// identifier of the block. It must be called with the lock held.
+func (c *Context) allocate(message *Message, index uint64) (*Message, []Event, error) {
+	if message.Delta <= 0 {
+		return nil, nil, fmt.Errorf("invalid block size for sequence '%s': %d", message.Key, message.Delta)
+	}
+	last, err := c.counter(message.Namespace, message.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if last > math.MaxInt64-message.Delta {
+		return nil, nil, fmt.Errorf("sequence '%s' exhausted", message.Key)
+	}
+	value := []byte(strconv.FormatInt(last+message.Delta, 10))
+	if err := c.validate(message.Namespace, message.Key, value); err != nil {
+		return nil, nil, err
+	}
+	c.put(message.Namespace, message.Key, value, index)
+	result := &Message{
+		Key:       message.Key,
+		Number:    last + 1,
+		Delta:     message.Delta,
+		Succeeded: true,
+		Index:     index,
+	}
+	return result, []Event{{Index: index, Type: Put, Namespace: message.Namespace, Key: message.Key, Value: value}}, nil
+}
@@ -0,0 +1,75 @@
+package distributed
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestCounterBounds(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	min, max := int64(0), int64(2)
+	tests := []struct {
+		delta     int64
+		succeeded bool
+		number    int64
+	}{
+		{1, true, 1},
+		{1, true, 2},
+		// the increment is refused, and the current value returned
+		{1, false, 2},
+		{-2, true, 0},
+		{-1, false, 0},
+		{3, false, 0},
+	}
+	for i, test := range tests {
+		result := apply(t, c, uint64(i+1), &Message{Type: Increment, Namespace: DefaultNamespace, Key: "n", Delta: test.delta, Min: &min, Max: &max})
+		if result.Succeeded != test.succeeded || result.Number != test.number {
+			t.Errorf("increment %d by %d: expected %d (%t), got %d (%t)", i, test.delta, test.number, test.succeeded, result.Number, result.Succeeded)
+		}
+	}
+	// without bounds the counter can go negative
+	if result := apply(t, c, 7, &Message{Type: Increment, Namespace: DefaultNamespace, Key: "n", Delta: -5}); !result.Succeeded || result.Number != -5 {
+		t.Errorf("expected unbounded decrement to -5, got %+v", result)
+	}
+	if entry, _ := c.Read(DefaultNamespace, "n"); string(entry.Value) != "-5" {
+		t.Errorf("expected counter to be stored as '-5', got '%s'", entry.Value)
+	}
+}
+
+func TestCounterErrors(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "s", Value: []byte("x")})
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "max", Value: []byte(strconv.FormatInt(math.MaxInt64, 10))})
+	tests := []struct {
+		name    string
+		message *Message
+	}{
+		{"not an integer", &Message{Type: Increment, Key: "s", Delta: 1}},
+		{"overflow", &Message{Type: Increment, Key: "max", Delta: 1}},
+		{"empty block", &Message{Type: Allocate, Key: "q", Delta: 0}},
+		{"exhausted sequence", &Message{Type: Allocate, Key: "max", Delta: 1}},
+	}
+	for i, test := range tests {
+		test.message.Namespace = DefaultNamespace
+		if refused(t, c, uint64(i+3), test.message) == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestSequenceBlocks(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	// blocks never overlap, and the key holds the last identifier handed out
+	for i, block := range []struct{ size, first int64 }{{10, 1}, {1, 11}, {5, 12}} {
+		result := apply(t, c, uint64(i+1), &Message{Type: Allocate, Namespace: DefaultNamespace, Key: "q", Delta: block.size})
+		if result.Number != block.first || result.Delta != block.size {
+			t.Errorf("expected block of %d from %d, got %d from %d", block.size, block.first, result.Delta, result.Number)
+		}
+	}
+	if entry, _ := c.Read(DefaultNamespace, "q"); string(entry.Value) != "16" {
+		t.Errorf("expected sequence at 16, got '%s'", entry.Value)
+	}
+}
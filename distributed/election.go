@@ -0,0 +1,160 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// Candidate is a session campaigning in an election, along with the value
+// it proposes, e.g. its address.
+type Candidate struct {
+	Session uint64 `json:"session"`
+	Value   []byte `json:"value,omitempty"`
+}
+
+// Election is a named election among sessions; the leader keeps its role
+// until it resigns or its session's lease expires or is revoked, then the
+// next candidate in order of arrival takes over.
+type Election struct {
+	Name   string    `json:"name"`
+	Leader Candidate `json:"leader"`
+	// Term is the index of the Raft log entry that elected the leader.
+	Term       uint64      `json:"term"`
+	Candidates []Candidate `json:"candidates,omitempty"`
+}
+
+// campaign enters a session into an election, making it the leader if
+// there is none; a leader campaigning again updates its value. It must be
+// called with the lock held.
+func (c *Context) campaign(name string, candidate Candidate) (*Election, error) {
+	if _, ok := c.leases[candidate.Session]; !ok {
+		return nil, fmt.Errorf("session %d not found", candidate.Session)
+	}
+	election, ok := c.elections[name]
+	if !ok {
+		election = &Election{Name: name, Leader: candidate, Term: c.index}
+		c.elections[name] = election
+		c.touch(extra{kind: electionExtra, name: name})
+		return election, nil
+	}
+	c.touch(extra{kind: electionExtra, name: name})
+	if election.Leader.Session == candidate.Session {
+		election.Leader = candidate
+		return election, nil
+	}
+	election.Candidates = election.withdraw(candidate.Session)
+	election.Candidates = append(election.Candidates, candidate)
+	return election, nil
+}
+
+// resign steps a session down from leader, or withdraws its candidacy;
+// it must be called with the lock held.
+func (c *Context) resign(name string, session uint64) error {
+	election, ok := c.elections[name]
+	if ok && election.Leader.Session == session {
+		c.succeed(election)
+		return nil
+	}
+	if ok && election.running(session) {
+		election.Candidates = election.withdraw(session)
+		c.touch(extra{kind: electionExtra, name: name})
+		return nil
+	}
+	return fmt.Errorf("session %d is not running in election '%s'", session, name)
+}
+
+// succeed hands the leadership over to the first candidate, or ends the
+// election if there are none; it must be called with the lock held.
+func (c *Context) succeed(election *Election) {
+	c.touch(extra{kind: electionExtra, name: election.Name})
+	if len(election.Candidates) == 0 {
+		delete(c.elections, election.Name)
+		return
+	}
+	election.Leader, election.Candidates = election.Candidates[0], election.Candidates[1:]
+	election.Term = c.index
+}
+
+// running returns whether the session is a candidate in the election.
+func (e *Election) running(session uint64) bool {
+	for _, candidate := range e.Candidates {
+		if candidate.Session == session {
+			return true
+		}
+	}
+	return false
+}
+
+// withdraw returns the candidates without the given session.
+func (e *Election) withdraw(session uint64) []Candidate {
+	candidates := make([]Candidate, 0, len(e.Candidates))
+	for _, candidate := range e.Candidates {
+		if candidate.Session != session {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// Leader returns the leader of the named election and its term, or a
+// zero candidate if there is none, along with the index it was read at.
+func (c *Context) Leader(name string) (Candidate, uint64, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if election, ok := c.elections[name]; ok {
+		return election.Leader, election.Term, c.settled
+	}
+	return Candidate{}, 0, c.settled
+}
+
+// Elect blocks until the session leads the named election and returns its
+// term; it fails if the session is no longer running, e.g. because its
+// lease expired, or if the context is done.
+func (c *Context) Elect(ctx context.Context, name string, session uint64) (uint64, error) {
+	for {
+		c.mtx.RLock()
+		election, ok := c.elections[name]
+		var leader, term uint64
+		running := false
+		if ok {
+			leader, term, running = election.Leader.Session, election.Term, election.running(session)
+		}
+		notify := c.applied
+		c.mtx.RUnlock()
+		if leader == session {
+			return term, nil
+		}
+		if !running {
+			return 0, fmt.Errorf("session %d is no longer running in election '%s'", session, name)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("error campaigning in election '%s': %w", name, ctx.Err())
+		case <-notify:
+		}
+	}
+}
+
+// Observe blocks until the leader of the named election differs from the
+// given one, in session, value or term, and returns the new leader and its
+// term; there is no leader if the session is 0.
+func (c *Context) Observe(ctx context.Context, name string, leader Candidate, term uint64) (Candidate, uint64, error) {
+	for {
+		c.mtx.RLock()
+		current, currentTerm := Candidate{}, uint64(0)
+		if election, ok := c.elections[name]; ok {
+			current, currentTerm = election.Leader, election.Term
+		}
+		notify := c.applied
+		c.mtx.RUnlock()
+		if current.Session != leader.Session || currentTerm != term || !bytes.Equal(current.Value, leader.Value) {
+			return current, currentTerm, nil
+		}
+		select {
+		case <-ctx.Done():
+			return Candidate{}, 0, fmt.Errorf("error observing election '%s': %w", name, ctx.Err())
+		case <-notify:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestElectionHandover(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	sessions := []uint64{}
+	for index := uint64(1); index <= 3; index++ {
+		sessions = append(sessions, apply(t, c, index, &Message{Type: Grant, TTL: 60, Time: now}).Lease)
+	}
+	first, second, third := sessions[0], sessions[1], sessions[2]
+	if result := apply(t, c, 4, &Message{Type: Campaign, Key: "e", Lease: first, Value: []byte("a")}); !result.Succeeded || result.Token != 4 {
+		t.Fatalf("expected first session to lead with term 4, got %+v", result)
+	}
+	for i, session := range []uint64{second, third} {
+		result := apply(t, c, uint64(i+5), &Message{Type: Campaign, Key: "e", Lease: session, Value: []byte("b")})
+		if result.Succeeded || result.Lease != first || string(result.Value) != "a" {
+			t.Errorf("expected session %d to run behind the leader, got %+v", session, result)
+		}
+	}
+	// a leader campaigning again updates its value, keeping its term
+	apply(t, c, 7, &Message{Type: Campaign, Key: "e", Lease: first, Value: []byte("c")})
+	if leader, term, _ := c.Leader("e"); leader.Session != first || string(leader.Value) != "c" || term != 4 {
+		t.Errorf("expected first session to lead with value 'c' and term 4, got %+v and %d", leader, term)
+	}
+	// the leadership passes on in order of arrival, with a new term
+	apply(t, c, 8, &Message{Type: Resign, Key: "e", Lease: first})
+	if term, err := c.Elect(context.Background(), "e", second); err != nil || term != 8 {
+		t.Errorf("expected second session to lead with term 8, got %d (%v)", term, err)
+	}
+	// and when the leader's session ends
+	apply(t, c, 9, &Message{Type: Revoke, Lease: second})
+	if term, err := c.Elect(context.Background(), "e", third); err != nil || term != 9 {
+		t.Errorf("expected third session to lead with term 9, got %d (%v)", term, err)
+	}
+	apply(t, c, 10, &Message{Type: Resign, Key: "e", Lease: third})
+	if leader, _, _ := c.Leader("e"); leader.Session != 0 {
+		t.Errorf("expected no leader once all resigned, got %+v", leader)
+	}
+	if refused(t, c, 11, &Message{Type: Resign, Key: "e", Lease: third}) == nil {
+		t.Errorf("expected resignation from a session not running to fail")
+	}
+	if refused(t, c, 12, &Message{Type: Campaign, Key: "e", Lease: 99}) == nil {
+		t.Errorf("expected campaign by an unknown session to fail")
+	}
+}
+
+func TestElectionObserve(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	first := apply(t, c, 1, &Message{Type: Grant, TTL: 60, Time: now}).Lease
+	second := apply(t, c, 2, &Message{Type: Grant, TTL: 60, Time: now}).Lease
+	apply(t, c, 3, &Message{Type: Campaign, Key: "e", Lease: first, Value: []byte("a")})
+	apply(t, c, 4, &Message{Type: Campaign, Key: "e", Lease: second, Value: []byte("b")})
+	leader, term, _ := c.Leader("e")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.Observe(ctx, "e", leader, term); err == nil {
+		t.Errorf("expected observing to time out while the leader is unchanged")
+	}
+	done := make(chan Candidate)
+	go func() {
+		leader, _, _ := c.Observe(context.Background(), "e", leader, term)
+		done <- leader
+	}()
+	apply(t, c, 5, &Message{Type: Resign, Key: "e", Lease: first})
+	if leader := <-done; leader.Session != second || string(leader.Value) != "b" {
+		t.Errorf("expected second session to be observed as leader, got %+v", leader)
+	}
+}
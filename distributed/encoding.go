@@ -0,0 +1,227 @@
+package distributed
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dihedron/rafter/compression"
+	proto "github.com/dihedron/rafter/distributed/proto"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Format is the leading byte of a log entry, identifying its encoding.
+type Format byte
+
+const (
+	// FormatJSON is the legacy encoding, with no leading format byte: the
+	// entry is a bare JSON object.
+	FormatJSON Format = '{'
+	// FormatProto is the protobuf encoding of a Command.
+	FormatProto Format = 0x01
+	// FormatCompressed is an entry in any of the other encodings, compressed
+	// with the codec whose ID follows the format byte.
+	FormatCompressed Format = 0x02
+)
+
+// DefaultCompressionThreshold is the size above which log entries are
+// compressed, when compression is enabled.
+const DefaultCompressionThreshold = 4096
+
+// encode serialises a message into the payload of a log entry, compressing
+// it if the context has a codec and the payload is above its threshold and
+// actually shrinks; nodes can decode compressed entries whatever their own
+// settings, as long as the codec is registered.
+func (c *Context) encode(message *Message) ([]byte, error) {
+	data, err := Encode(message)
+	if err != nil || c.codec == nil || len(data) <= c.threshold {
+		return data, err
+	}
+	compressed, err := compression.Compress(c.codec, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed)+1 >= len(data) {
+		return data, nil
+	}
+	return append([]byte{byte(FormatCompressed)}, compressed...), nil
+}
+
+// Encode serialises a message into the payload of a log entry.
+func Encode(message *Message) ([]byte, error) {
+	command := &proto.Command{
+		Type:        int32(message.Type),
+		Namespace:   message.Namespace,
+		Key:         message.Key,
+		Value:       message.Value,
+		Filter:      message.Filter,
+		Condition:   int32(message.Condition),
+		PrevValue:   message.PrevValue,
+		PrevIndex:   message.PrevIndex,
+		PrevVersion: message.PrevVersion,
+		Lease:       message.Lease,
+		Ttl:         message.TTL,
+		Revision:    message.Revision,
+		Delta:       message.Delta,
+		Item:        message.Item,
+		Payload:     message.Payload,
+		Client:      message.Client,
+		Sequence:    message.Sequence,
+		Success:     fromOperations(message.Success),
+		Failure:     fromOperations(message.Failure),
+		Operations:  fromOperations(message.Operations),
+		Replace:     message.Replace,
+		Number:      message.Number,
+	}
+	if !message.Time.IsZero() {
+		command.Time = message.Time.UnixNano()
+	}
+	if message.Min != nil {
+		command.Min = &proto.Bound{Value: *message.Min}
+	}
+	if message.Max != nil {
+		command.Max = &proto.Bound{Value: *message.Max}
+	}
+	for _, comparison := range message.Comparisons {
+		command.Compare = append(command.Compare, &proto.Compare{
+			Key:      comparison.Key,
+			Target:   proto.CompareTarget(comparison.Target),
+			Operator: proto.CompareOperator(comparison.Operator),
+			Value:    comparison.Value,
+			Number:   comparison.Number,
+			Exists:   comparison.Exists,
+		})
+	}
+	data, err := protobuf.Marshal(command)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling command to protobuf: %w", err)
+	}
+	return append([]byte{byte(FormatProto)}, data...), nil
+}
+
+// Decode deserialises the payload of a log entry into a message; it
+// supports both the current and the legacy encodings.
+func Decode(data []byte) (*Message, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty log entry")
+	}
+	switch Format(data[0]) {
+	case FormatCompressed:
+		plain, err := compression.Decompress(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(plain) > 0 && Format(plain[0]) == FormatCompressed {
+			return nil, fmt.Errorf("invalid log entry: compressed more than once")
+		}
+		return Decode(plain)
+	case FormatJSON:
+		message := &Message{}
+		if err := json.Unmarshal(data, message); err != nil {
+			return nil, fmt.Errorf("error unmarshalling command from JSON: %w", err)
+		}
+		return message, nil
+	case FormatProto:
+		command := &proto.Command{}
+		if err := protobuf.Unmarshal(data[1:], command); err != nil {
+			return nil, fmt.Errorf("error unmarshalling command from protobuf: %w", err)
+		}
+		message := &Message{
+			Type:        Type(command.Type),
+			Namespace:   command.Namespace,
+			Key:         command.Key,
+			Value:       command.Value,
+			Filter:      command.Filter,
+			Condition:   Condition(command.Condition),
+			PrevValue:   command.PrevValue,
+			PrevIndex:   command.PrevIndex,
+			PrevVersion: command.PrevVersion,
+			Lease:       command.Lease,
+			TTL:         command.Ttl,
+			Revision:    command.Revision,
+			Delta:       command.Delta,
+			Item:        command.Item,
+			Payload:     command.Payload,
+			Client:      command.Client,
+			Sequence:    command.Sequence,
+			Replace:     command.Replace,
+			Number:      command.Number,
+		}
+		if command.Time != 0 {
+			message.Time = time.Unix(0, command.Time).UTC()
+		}
+		if command.Min != nil {
+			message.Min = &command.Min.Value
+		}
+		if command.Max != nil {
+			message.Max = &command.Max.Value
+		}
+		for _, compare := range command.Compare {
+			message.Comparisons = append(message.Comparisons, Comparison{
+				Key:      compare.Key,
+				Target:   Target(compare.Target),
+				Operator: Operator(compare.Operator),
+				Value:    compare.Value,
+				Number:   compare.Number,
+				Exists:   compare.Exists,
+			})
+		}
+		var err error
+		if message.Success, err = toOperations(command.Success); err != nil {
+			return nil, err
+		}
+		if message.Failure, err = toOperations(command.Failure); err != nil {
+			return nil, err
+		}
+		if message.Operations, err = toOperations(command.Operations); err != nil {
+			return nil, err
+		}
+		return message, nil
+	}
+	return nil, fmt.Errorf("unsupported log entry format: 0x%02x", data[0])
+}
+
+// fromOperations converts the operations of a transaction into their
+// protobuf representation.
+func fromOperations(operations []Operation) []*proto.Operation {
+	result := make([]*proto.Operation, 0, len(operations))
+	for _, operation := range operations {
+		result = append(result, &proto.Operation{
+			Type:  operationTypes[operation.Type],
+			Key:   operation.Key,
+			Value: operation.Value,
+		})
+	}
+	return result
+}
+
+var operationTypes = map[Type]proto.OperationType{
+	Get:    proto.OperationType_GET,
+	Set:    proto.OperationType_SET,
+	Remove: proto.OperationType_REMOVE,
+}
+
+// toOperations converts the operations of a transaction from their
+// protobuf representation.
+func toOperations(operations []*proto.Operation) ([]Operation, error) {
+	result := make([]Operation, 0, len(operations))
+	for _, operation := range operations {
+		var t Type
+		switch operation.Type {
+		case proto.OperationType_GET:
+			t = Get
+		case proto.OperationType_SET:
+			t = Set
+		case proto.OperationType_REMOVE:
+			t = Remove
+		default:
+			return nil, fmt.Errorf("invalid operation type for key '%s': %d", operation.Key, operation.Type)
+		}
+		result = append(result, Operation{
+			Type:  t,
+			Key:   operation.Key,
+			Value: operation.Value,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,151 @@
+package distributed
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/rafter/compression"
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	min, max := int64(-1), int64(10)
+	tests := []struct {
+		name    string
+		message *Message
+	}{
+		{"set", &Message{Type: Set, Namespace: "ns", Key: "k", Value: []byte("v"), Lease: 3, TTL: 60, Time: time.Unix(0, 1234567890).UTC(), Condition: IfIndex, PrevIndex: 4, Client: "c", Sequence: 5}},
+		{"counter", &Message{Type: Increment, Key: "k", Delta: -2, Min: &min, Max: &max}},
+		{"transaction", &Message{
+			Type:        Txn,
+			Comparisons: []Comparison{{Key: "a", Target: TargetVersion, Operator: Greater, Number: 2}, {Key: "b", Target: TargetExists, Exists: true}},
+			Success:     []Operation{{Type: Set, Key: "a", Value: []byte("1")}, {Type: Remove, Key: "b"}},
+			Failure:     []Operation{{Type: Get, Key: "a"}},
+			Operations:  []Operation{},
+		}},
+		{"import", &Message{Type: Import, Key: "id", Replace: true, Success: []Operation{}, Failure: []Operation{}, Operations: []Operation{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := Encode(test.message)
+			if err != nil {
+				t.Fatalf("error encoding message: %v", err)
+			}
+			if Format(data[0]) != FormatProto {
+				t.Errorf("expected protobuf format, got 0x%02x", data[0])
+			}
+			message, err := Decode(data)
+			if err != nil {
+				t.Fatalf("error decoding message: %v", err)
+			}
+			for _, operations := range []*[]Operation{&test.message.Success, &test.message.Failure, &test.message.Operations} {
+				if *operations == nil {
+					*operations = []Operation{}
+				}
+			}
+			if !reflect.DeepEqual(message, test.message) {
+				t.Errorf("expected %+v, got %+v", test.message, message)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	data, _ := json.Marshal(&Message{Type: Set, Namespace: "ns", Key: "k", Value: []byte("v")})
+	if Format(data[0]) != FormatJSON {
+		t.Fatalf("expected legacy entry to start with '{', got %q", data[0])
+	}
+	message, err := Decode(data)
+	if err != nil {
+		t.Fatalf("error decoding legacy entry: %v", err)
+	}
+	if message.Type != Set || message.Namespace != "ns" || message.Key != "k" || string(message.Value) != "v" {
+		t.Errorf("unexpected legacy message: %+v", message)
+	}
+	// legacy entries can be compressed too
+	gzip, _ := compression.Lookup("gzip")
+	compressed, _ := compression.Compress(gzip, data)
+	if message, err := Decode(append([]byte{byte(FormatCompressed)}, compressed...)); err != nil || message.Key != "k" {
+		t.Errorf("expected compressed legacy entry to be decoded, got %+v (%v)", message, err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	gzip, _ := compression.Lookup("gzip")
+	data, _ := Encode(&Message{Type: Set, Key: "k"})
+	once, _ := compression.Compress(gzip, data)
+	once = append([]byte{byte(FormatCompressed)}, once...)
+	twice, _ := compression.Compress(gzip, once)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "empty log entry"},
+		{"unknown format", []byte{0x7F}, "unsupported log entry format: 0x7f"},
+		{"invalid JSON", []byte("{"), "from JSON"},
+		{"invalid protobuf", []byte{byte(FormatProto), 0xFF}, "from protobuf"},
+		{"unknown codec", []byte{byte(FormatCompressed), 0xEE}, "unknown codec"},
+		{"compressed twice", append([]byte{byte(FormatCompressed)}, twice...), "compressed more than once"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Decode(test.data); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestEncodeThreshold(t *testing.T) {
+	gzip, _ := compression.Lookup("gzip")
+	// the size of the encoded message grows by one with each byte of value
+	base, _ := Encode(&Message{Type: Set, Key: "k", Value: bytes.Repeat([]byte("a"), 200)})
+	threshold := len(base)
+	c := NewContext(test.NewLogger(t), WithCompression(gzip, threshold))
+	random := make([]byte, 300)
+	rand.Read(random)
+	tests := []struct {
+		name       string
+		value      []byte
+		compressed bool
+	}{
+		{"below threshold", bytes.Repeat([]byte("a"), 199), false},
+		{"at threshold", bytes.Repeat([]byte("a"), 200), false},
+		{"above threshold", bytes.Repeat([]byte("a"), 201), true},
+		{"incompressible", random, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := &Message{Type: Set, Key: "k", Value: test.value}
+			plain, _ := Encode(message)
+			data, err := c.encode(message)
+			if err != nil {
+				t.Fatalf("error encoding message: %v", err)
+			}
+			if compressed := Format(data[0]) == FormatCompressed; compressed != test.compressed {
+				t.Fatalf("expected compressed to be %t for %d bytes (threshold %d), got %t", test.compressed, len(plain), threshold, compressed)
+			}
+			if test.compressed && len(data) >= len(plain) {
+				t.Errorf("expected compressed entry to be smaller than %d bytes, got %d", len(plain), len(data))
+			}
+			if !test.compressed && !bytes.Equal(data, plain) {
+				t.Errorf("expected entry not compressed to be encoded as it is")
+			}
+			decoded, err := Decode(data)
+			if err != nil || !bytes.Equal(decoded.Value, test.value) {
+				t.Errorf("expected value to be decoded, got %+v (%v)", decoded, err)
+			}
+		})
+	}
+	// without a codec, nothing is compressed
+	message := &Message{Type: Set, Key: "k", Value: bytes.Repeat([]byte("a"), 10000)}
+	if data, _ := NewContext(test.NewLogger(t)).encode(message); Format(data[0]) != FormatProto {
+		t.Errorf("expected entry not to be compressed without a codec")
+	}
+}
@@ -0,0 +1,223 @@
+package distributed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+
+	"github.com/dihedron/rafter/compression"
+	"github.com/dihedron/rafter/encryption"
+)
+
+// EnvelopeVersion is the version of the envelope snapshots are wrapped in:
+// a header with a magic number, the version, and the index and term of the
+// last log entry included in the snapshot, followed by the snapshot stream
+// and by a trailer with the number of entries in it (keys and queue items)
+// and a CRC-64 (ECMA) checksum of everything that precedes it. Snapshots
+// written before the envelope was introduced have no header, and are read
+// as they are.
+const EnvelopeVersion = 1
+
+// envelopeMagic cannot be the first byte of a snapshot stream of any other
+// kind, be it plain, compressed or encrypted.
+var envelopeMagic = []byte{0xF5, 'R', 'F', 'T', 'S', 'N', 'A', 'P'}
+
+const (
+	envelopeHeaderSize  = 8 + 2 + 8 + 8
+	envelopeTrailerSize = 8 + 8
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// SnapshotInfo is what the envelope of a snapshot tells about it.
+type SnapshotInfo struct {
+	Version uint16 `json:"version"`
+	Index   uint64 `json:"index"`
+	Term    uint64 `json:"term"`
+	Entries uint64 `json:"entries"`
+}
+
+// EnvelopeWriter wraps a snapshot stream in an envelope; it must be
+// finished, with the number of entries written, to write the trailer.
+type EnvelopeWriter struct {
+	w    io.Writer
+	hash hash.Hash64
+}
+
+// NewEnvelopeWriter writes the header of an envelope to w.
+func NewEnvelopeWriter(w io.Writer, index uint64, term uint64) (*EnvelopeWriter, error) {
+	e := &EnvelopeWriter{hash: crc64.New(crcTable)}
+	e.w = io.MultiWriter(w, e.hash)
+	header := make([]byte, envelopeHeaderSize)
+	copy(header, envelopeMagic)
+	binary.BigEndian.PutUint16(header[8:], EnvelopeVersion)
+	binary.BigEndian.PutUint64(header[10:], index)
+	binary.BigEndian.PutUint64(header[18:], term)
+	if _, err := e.w.Write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *EnvelopeWriter) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+// Finish writes the trailer of the envelope, which does not close the
+// underlying writer.
+func (e *EnvelopeWriter) Finish(entries uint64) error {
+	trailer := make([]byte, envelopeTrailerSize)
+	binary.BigEndian.PutUint64(trailer, entries)
+	if _, err := e.w.Write(trailer[:8]); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(trailer[8:], e.hash.Sum64())
+	_, err := e.w.Write(trailer[8:])
+	return err
+}
+
+// EnvelopeReader reads the snapshot stream out of an envelope, holding back
+// the trailer, which is checked by Verify once the stream is consumed.
+type EnvelopeReader struct {
+	r      *bufio.Reader
+	info   *SnapshotInfo
+	hash   hash.Hash64
+	tail   []byte
+	buffer []byte
+	eof    bool
+}
+
+// OpenEnvelope reads the header of an envelope off r; snapshots with no
+// envelope are read as they are, and have no info.
+func OpenEnvelope(r io.Reader) (*EnvelopeReader, error) {
+	e := &EnvelopeReader{r: bufio.NewReader(r)}
+	prefix, err := e.r.Peek(len(envelopeMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	}
+	if !bytes.Equal(prefix, envelopeMagic) {
+		return e, nil
+	}
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(e.r, header); err != nil {
+		return nil, fmt.Errorf("snapshot is truncated: incomplete envelope header")
+	}
+	e.info = &SnapshotInfo{
+		Version: binary.BigEndian.Uint16(header[8:]),
+		Index:   binary.BigEndian.Uint64(header[10:]),
+		Term:    binary.BigEndian.Uint64(header[18:]),
+	}
+	if e.info.Version == 0 || e.info.Version > EnvelopeVersion {
+		return nil, fmt.Errorf("unsupported snapshot envelope version: %d", e.info.Version)
+	}
+	e.hash = crc64.New(crcTable)
+	e.hash.Write(header)
+	return e, nil
+}
+
+// Info returns what the header of the envelope tells about the snapshot,
+// or nil if it has no envelope; the number of entries is only known once
+// the snapshot is verified.
+func (e *EnvelopeReader) Info() *SnapshotInfo {
+	return e.info
+}
+
+func (e *EnvelopeReader) Read(p []byte) (int, error) {
+	if e.info == nil {
+		return e.r.Read(p)
+	}
+	// the last bytes read are held back, since they may be the trailer
+	for len(e.buffer) == 0 {
+		if e.eof {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, 32*1024)
+		n, err := e.r.Read(chunk)
+		data := append(e.tail, chunk[:n]...)
+		if len(data) > envelopeTrailerSize {
+			e.buffer = data[:len(data)-envelopeTrailerSize]
+			e.tail = append([]byte{}, data[len(data)-envelopeTrailerSize:]...)
+		} else {
+			e.tail = data
+		}
+		if err == io.EOF {
+			e.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.buffer)
+	e.hash.Write(e.buffer[:n])
+	e.buffer = e.buffer[n:]
+	return n, nil
+}
+
+// Verify reads what is left of the snapshot stream and checks the trailer
+// against the given number of entries, unless negative, and against the
+// checksum of the envelope; it returns the complete info. Snapshots with no
+// envelope cannot be verified, and have no info.
+func (e *EnvelopeReader) Verify(entries int64) (*SnapshotInfo, error) {
+	if e.info == nil {
+		return nil, nil
+	}
+	if n, err := io.Copy(io.Discard, e); err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	} else if n > 0 && entries >= 0 {
+		return nil, fmt.Errorf("snapshot is corrupted: %d unexpected bytes after the last entry", n)
+	}
+	if len(e.tail) < envelopeTrailerSize {
+		return nil, fmt.Errorf("snapshot is truncated: incomplete envelope trailer")
+	}
+	e.hash.Write(e.tail[:8])
+	if sum := binary.BigEndian.Uint64(e.tail[8:]); sum != e.hash.Sum64() {
+		return nil, fmt.Errorf("snapshot is corrupted or truncated: checksum mismatch (expected %016x, got %016x)", sum, e.hash.Sum64())
+	}
+	e.info.Entries = binary.BigEndian.Uint64(e.tail)
+	if entries >= 0 && uint64(entries) != e.info.Entries {
+		return nil, fmt.Errorf("snapshot is corrupted: %d entries found, %d expected", entries, e.info.Entries)
+	}
+	return e.info, nil
+}
+
+// VerifySnapshot checks a snapshot stream against its envelope; unless the
+// snapshot is encrypted and no keyring is given, its entries are decoded
+// and counted as well, and decoded tells whether they were.
+func VerifySnapshot(r io.Reader, keyring *encryption.Keyring) (info *SnapshotInfo, decoded bool, err error) {
+	envelope, err := OpenEnvelope(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if envelope.Info() == nil {
+		return nil, false, fmt.Errorf("snapshot has no envelope, and cannot be verified")
+	}
+	plaintext, err := keyring.Reader(envelope)
+	if errors.Is(err, encryption.ErrNoKeyring) {
+		info, err = envelope.Verify(-1)
+		return info, false, err
+	}
+	if err == nil {
+		plaintext, err = compression.Reader(plaintext)
+	}
+	var s *state
+	if err == nil {
+		s, err = restore(plaintext, newMemory())
+	}
+	if err != nil {
+		if _, verr := envelope.Verify(-1); verr != nil {
+			err = verr
+		}
+		return nil, false, err
+	}
+	if info, err = envelope.Verify(int64(s.entries)); err != nil {
+		return nil, false, err
+	}
+	if s.index != info.Index {
+		return nil, false, fmt.Errorf("snapshot is corrupted: index %d in envelope, %d in content", info.Index, s.index)
+	}
+	return info, true, nil
+}
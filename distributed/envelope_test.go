@@ -0,0 +1,245 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/rafter/encryption"
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+// envelope wraps data in an envelope holding the given number of entries.
+func envelope(t *testing.T, data []byte, entries uint64) []byte {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	w, err := NewEnvelopeWriter(buffer, 7, 2)
+	if err != nil {
+		t.Fatalf("error writing envelope header: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("error writing envelope: %v", err)
+	}
+	if err := w.Finish(entries); err != nil {
+		t.Fatalf("error writing envelope trailer: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// persist takes a snapshot of a context and returns its stream.
+func persist(t *testing.T, c *Context) []byte {
+	t.Helper()
+	snapshot, err := c.Snapshot()
+	if err != nil {
+		t.Fatalf("error taking snapshot: %v", err)
+	}
+	defer snapshot.Release()
+	s := &sink{}
+	if err := snapshot.Persist(s); err != nil {
+		t.Fatalf("error persisting snapshot: %v", err)
+	}
+	return s.Bytes()
+}
+
+func TestEnvelope(t *testing.T) {
+	for _, size := range []int{0, 1, envelopeTrailerSize, 32*1024 - 1, 32 * 1024, 100 * 1024} {
+		data := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+		stream := envelope(t, data, 3)
+		if len(stream) != envelopeHeaderSize+size+envelopeTrailerSize {
+			t.Fatalf("expected envelope of %d bytes, got %d", envelopeHeaderSize+size+envelopeTrailerSize, len(stream))
+		}
+		r, err := OpenEnvelope(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatalf("error opening envelope: %v", err)
+		}
+		if info := r.Info(); info == nil || info.Version != EnvelopeVersion || info.Index != 7 || info.Term != 2 || info.Entries != 0 {
+			t.Errorf("unexpected envelope header: %+v", info)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("error reading envelope of %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("envelope of %d bytes read back as %d different bytes", size, len(got))
+		}
+		if info, err := r.Verify(3); err != nil || info.Entries != 3 {
+			t.Errorf("expected envelope of %d bytes with 3 entries to verify, got %+v (%v)", size, info, err)
+		}
+	}
+}
+
+func TestEnvelopeNone(t *testing.T) {
+	for _, data := range []string{"", "{}", `{"version":10}`} {
+		r, err := OpenEnvelope(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("error opening stream: %v", err)
+		}
+		if r.Info() != nil {
+			t.Errorf("expected stream %q to have no envelope", data)
+		}
+		if got, err := io.ReadAll(r); err != nil || string(got) != data {
+			t.Errorf("expected stream %q to be read as it is, got %q (%v)", data, got, err)
+		}
+		if info, err := r.Verify(0); info != nil || err != nil {
+			t.Errorf("expected stream %q not to be verified, got %+v (%v)", data, info, err)
+		}
+	}
+}
+
+func TestEnvelopeDamaged(t *testing.T) {
+	stream := envelope(t, []byte("snapshot"), 1)
+	damage := func(offset int, value byte) []byte {
+		damaged := append([]byte{}, stream...)
+		damaged[offset] = value
+		return damaged
+	}
+	version := func(v uint16) []byte {
+		damaged := append([]byte{}, stream...)
+		binary.BigEndian.PutUint16(damaged[8:], v)
+		return damaged
+	}
+	tests := []struct {
+		name    string
+		stream  []byte
+		entries int64
+		unread  bool
+		err     string
+	}{
+		{"intact", stream, 1, false, ""},
+		{"bad magic", damage(1, 'X'), -1, false, ""},
+		{"version 0", version(0), -1, false, "unsupported snapshot envelope version: 0"},
+		{"future version", version(EnvelopeVersion + 1), -1, false, "unsupported snapshot envelope version"},
+		{"truncated header", stream[:envelopeHeaderSize-1], -1, false, "incomplete envelope header"},
+		{"flipped index", damage(17, 1), -1, false, "checksum mismatch"},
+		{"flipped data", damage(envelopeHeaderSize, 'S'), -1, false, "checksum mismatch"},
+		{"flipped entries", damage(len(stream)-envelopeTrailerSize, 1), -1, false, "checksum mismatch"},
+		{"flipped checksum", damage(len(stream)-1, stream[len(stream)-1]^1), -1, false, "checksum mismatch"},
+		{"truncated checksum", stream[:len(stream)-1], -1, false, "checksum mismatch"},
+		{"truncated trailer", stream[:len(stream)-2], 1, false, "checksum mismatch"},
+		{"incomplete trailer", stream[:envelopeHeaderSize+envelopeTrailerSize-1], -1, false, "incomplete envelope trailer"},
+		{"extra entries", stream, 2, false, "2 entries found, 1 expected"},
+		{"unread data", stream, 1, true, "8 unexpected bytes after the last entry"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := OpenEnvelope(bytes.NewReader(test.stream))
+			if err == nil {
+				if r.Info() == nil {
+					// a stream with no envelope is read as it is
+					if test.err != "" {
+						t.Fatalf("expected stream to be read as enveloped")
+					}
+					return
+				}
+				if !test.unread {
+					io.ReadAll(r)
+				}
+				_, err = r.Verify(test.entries)
+			}
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("error verifying envelope: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	keyring, err := encryption.New("key", map[string][]byte{"key": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatalf("error creating keyring: %v", err)
+	}
+	c := NewContext(test.NewLogger(t), WithKeyring(keyring))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("2"), TTL: 60, Time: time.Now()})
+	apply(t, c, 3, &Message{Type: Enqueue, Key: "q", Value: []byte("item")})
+	stream := persist(t, c)
+
+	info, decoded, err := VerifySnapshot(bytes.NewReader(stream), keyring)
+	if err != nil || !decoded {
+		t.Fatalf("error verifying snapshot: %v (decoded: %t)", err, decoded)
+	}
+	if info.Index != 3 || info.Term != 1 || info.Entries != 3 {
+		t.Errorf("expected snapshot at index 3 and term 1 with 3 entries, got %+v", info)
+	}
+	// without the key the envelope is still checked, but entries are not
+	if info, decoded, err := VerifySnapshot(bytes.NewReader(stream), nil); err != nil || decoded || info.Entries != 3 {
+		t.Errorf("expected encrypted snapshot to be verified without decoding, got %+v (%t, %v)", info, decoded, err)
+	}
+	damaged := append([]byte{}, stream...)
+	damaged[len(damaged)/2] ^= 1
+	for _, k := range []*encryption.Keyring{keyring, nil} {
+		if _, _, err := VerifySnapshot(bytes.NewReader(damaged), k); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("expected damaged snapshot to fail the checksum, got %v", err)
+		}
+	}
+	// an envelope whose entries do not match its content
+	plain := persist(t, NewContext(test.NewLogger(t)))
+	if _, _, err := VerifySnapshot(bytes.NewReader(plain), nil); err != nil {
+		t.Fatalf("error verifying plain snapshot: %v", err)
+	}
+	r, _ := OpenEnvelope(bytes.NewReader(plain))
+	content, _ := io.ReadAll(r)
+	if _, _, err := VerifySnapshot(bytes.NewReader(envelope(t, content, 1)), nil); err == nil || !strings.Contains(err.Error(), "0 entries found, 1 expected") {
+		t.Errorf("expected snapshot with wrong number of entries to fail, got %v", err)
+	}
+	if _, _, err := VerifySnapshot(bytes.NewReader(envelope(t, content, 0)), nil); err == nil || !strings.Contains(err.Error(), "index 7 in envelope") {
+		t.Errorf("expected snapshot with wrong index to fail, got %v", err)
+	}
+	if _, _, err := VerifySnapshot(bytes.NewReader(content), nil); err == nil || !strings.Contains(err.Error(), "no envelope") {
+		t.Errorf("expected snapshot without envelope not to be verified, got %v", err)
+	}
+}
+
+func TestRestoreWithoutEnvelope(t *testing.T) {
+	source := NewContext(test.NewLogger(t))
+	apply(t, source, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	r, _ := OpenEnvelope(bytes.NewReader(persist(t, source)))
+	content, _ := io.ReadAll(r)
+	tests := []struct {
+		name   string
+		stream string
+		err    string
+	}{
+		{"legacy", `{"a":"MQ=="}`, ""},
+		{"streamed", string(content), "not in the legacy format"},
+		{"garbage", "garbage", "not in the legacy format"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewContext(source.logger)
+			err := c.Restore(io.NopCloser(strings.NewReader(test.stream)))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error restoring snapshot: %v", err)
+			}
+			if entry, _ := c.Read(DefaultNamespace, "a"); entry == nil || string(entry.Value) != "1" {
+				t.Errorf("expected legacy key to be restored, got %+v", entry)
+			}
+		})
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	for _, version := range []int{4, SnapshotVersion - 1, SnapshotVersion + 1} {
+		c := NewContext(test.NewLogger(t))
+		stream := envelope(t, []byte(fmt.Sprintf(`{"version":%d}`, version)), 0)
+		if err := c.Restore(io.NopCloser(bytes.NewReader(stream))); err == nil || !strings.Contains(err.Error(), "unsupported snapshot version") {
+			t.Errorf("expected snapshot version %d to be refused, got %v", version, err)
+		}
+	}
+}
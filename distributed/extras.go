@@ -0,0 +1,259 @@
+package distributed
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// The kinds of records making up the state of a context other than its
+// keys, which durable storages persist one by one as they change.
+const (
+	compactedExtra = "compacted"
+	leaseExtra     = "leases"
+	lockExtra      = "locks"
+	electionExtra  = "elections"
+	itemExtra      = "items"
+	commandExtra   = "commands"
+	schemaExtra    = "schemas"
+	sessionExtra   = "sessions"
+)
+
+// extra identifies a record of the state of a context other than its keys:
+// a lease or queue item by ID, a lock, election, queue, command or client
+// by name, a schema by namespace (name) and prefix (key).
+type extra struct {
+	kind string
+	name string
+	key  string
+	id   uint64
+}
+
+// touch marks a record as changed by the log entry being applied, so that
+// it is written along with it; it must be called with the lock held.
+func (c *Context) touch(e extra) {
+	c.dirty[e] = struct{}{}
+}
+
+// persist hands the records changed by the log entry being applied over to
+// the storage, if durable, as they are now; it must be called with the lock
+// held.
+func (c *Context) persist() error {
+	defer func() {
+		c.dirty = map[extra]struct{}{}
+	}()
+	if !c.storage.Durable() {
+		return nil
+	}
+	for e := range c.dirty {
+		value, err := c.resolve(e)
+		if err != nil {
+			return err
+		}
+		c.storage.Extra(e.kind, extraID(e), value)
+	}
+	return nil
+}
+
+// resolve returns the current value of a record, or nil if it is gone; it
+// must be called with the lock held.
+func (c *Context) resolve(e extra) (interface{}, error) {
+	switch e.kind {
+	case compactedExtra:
+		return c.compacted, nil
+	case leaseExtra:
+		if lease, ok := c.leases[e.id]; ok {
+			return lease, nil
+		}
+	case lockExtra:
+		if lock, ok := c.locks[e.name]; ok {
+			return lock, nil
+		}
+	case electionExtra:
+		if election, ok := c.elections[e.name]; ok {
+			return election, nil
+		}
+	case itemExtra:
+		if queue, ok := c.queues[e.name]; ok {
+			if item, ok := queue.ready.Get(id(e.id)); ok {
+				return &record{Queue: e.name, Item: item.(*Item)}, nil
+			}
+			if item, ok := queue.inflight.Get(id(e.id)); ok {
+				return &record{Queue: e.name, Item: item.(*Item)}, nil
+			}
+		}
+	case commandExtra:
+		for _, handler := range c.handlers {
+			if handler.Name == e.name && handler.Snapshot != nil {
+				state, err := handler.Snapshot()
+				if err != nil {
+					return nil, fmt.Errorf("error taking snapshot of command '%s': %w", handler.Name, err)
+				}
+				data, err := json.Marshal(state)
+				if err != nil {
+					return nil, fmt.Errorf("error marshalling state of command '%s': %w", handler.Name, err)
+				}
+				return json.RawMessage(data), nil
+			}
+		}
+		if state, ok := c.pending[e.name]; ok {
+			return state, nil
+		}
+	case schemaExtra:
+		if schema, ok := c.schemas[e.name][e.key]; ok {
+			return schema, nil
+		}
+	case sessionExtra:
+		if s, ok := c.sessions.get(e.name); ok {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+// extraID returns the ID a record is stored under among those of its kind.
+func extraID(e extra) string {
+	switch e.kind {
+	case leaseExtra:
+		return strconv.FormatUint(e.id, 10)
+	case itemExtra:
+		return e.name + "\x00" + strconv.FormatUint(e.id, 10)
+	case schemaExtra:
+		return e.name + "\x00" + e.key
+	case compactedExtra:
+		return compactedExtra
+	}
+	return e.name
+}
+
+// save hands all the records of a state over to a durable storage, e.g.
+// after it was restored from a snapshot.
+func (s *state) save(values storage) {
+	if !values.Durable() {
+		return
+	}
+	values.Extra(compactedExtra, extraID(extra{kind: compactedExtra}), s.compacted)
+	for _, lease := range s.leases {
+		values.Extra(leaseExtra, extraID(extra{kind: leaseExtra, id: lease.ID}), lease)
+	}
+	for _, lock := range s.locks {
+		values.Extra(lockExtra, extraID(extra{kind: lockExtra, name: lock.Name}), lock)
+	}
+	for _, election := range s.elections {
+		values.Extra(electionExtra, extraID(extra{kind: electionExtra, name: election.Name}), election)
+	}
+	for name, queue := range s.queues {
+		for _, items := range []*iradix.Tree{queue.ready, queue.inflight} {
+			items.Root().Walk(func(k []byte, v interface{}) bool {
+				item := v.(*Item)
+				values.Extra(itemExtra, extraID(extra{kind: itemExtra, name: name, id: item.ID}), &record{Queue: name, Item: item})
+				return false
+			})
+		}
+	}
+	for name, state := range s.commands {
+		values.Extra(commandExtra, extraID(extra{kind: commandExtra, name: name}), state)
+	}
+	for namespace, schemas := range s.schemas {
+		for prefix, schema := range schemas {
+			values.Extra(schemaExtra, extraID(extra{kind: schemaExtra, name: namespace, key: prefix}), schema)
+		}
+	}
+	for client, session := range s.sessions {
+		values.Extra(sessionExtra, extraID(extra{kind: sessionExtra, name: client}), session)
+	}
+}
+
+// load reads the state of a context other than its keys from a durable
+// storage.
+func load(values storage) (*state, error) {
+	s := &state{
+		leases:    map[uint64]*Lease{},
+		locks:     map[string]*Lock{},
+		elections: map[string]*Election{},
+		queues:    map[string]*Queue{},
+		commands:  map[string]json.RawMessage{},
+		sessions:  map[string]*session{},
+	}
+	decode := func(kind string, fn func(id string, data json.RawMessage) error) error {
+		records, err := values.Extras(kind)
+		if err != nil {
+			return err
+		}
+		for id, data := range records {
+			if err := fn(id, data); err != nil {
+				return fmt.Errorf("error unmarshalling %s record '%s': %w", kind, id, err)
+			}
+		}
+		return nil
+	}
+	schemas := []*Schema{}
+	err := decode(compactedExtra, func(_ string, data json.RawMessage) error {
+		return json.Unmarshal(data, &s.compacted)
+	})
+	if err == nil {
+		err = decode(leaseExtra, func(_ string, data json.RawMessage) error {
+			lease := &Lease{Keys: map[Key]struct{}{}}
+			err := json.Unmarshal(data, lease)
+			s.leases[lease.ID] = lease
+			return err
+		})
+	}
+	if err == nil {
+		err = decode(lockExtra, func(_ string, data json.RawMessage) error {
+			lock := &Lock{}
+			err := json.Unmarshal(data, lock)
+			s.locks[lock.Name] = lock
+			return err
+		})
+	}
+	if err == nil {
+		err = decode(electionExtra, func(_ string, data json.RawMessage) error {
+			election := &Election{}
+			err := json.Unmarshal(data, election)
+			s.elections[election.Name] = election
+			return err
+		})
+	}
+	if err == nil {
+		err = decode(itemExtra, func(_ string, data json.RawMessage) error {
+			r := &record{}
+			if err := json.Unmarshal(data, r); err != nil {
+				return err
+			}
+			restock(s.queues, r.Queue, r.Item)
+			return nil
+		})
+	}
+	if err == nil {
+		// custom commands are registered later, and get their state then
+		err = decode(commandExtra, func(name string, data json.RawMessage) error {
+			s.commands[name] = data
+			return nil
+		})
+	}
+	if err == nil {
+		err = decode(schemaExtra, func(_ string, data json.RawMessage) error {
+			schema := &Schema{}
+			schemas = append(schemas, schema)
+			return json.Unmarshal(data, schema)
+		})
+	}
+	if err == nil {
+		err = decode(sessionExtra, func(_ string, data json.RawMessage) error {
+			client := &session{}
+			err := json.Unmarshal(data, client)
+			s.sessions[client.Client] = client
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.schemas, err = restoreSchemas(schemas); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
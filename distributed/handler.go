@@ -0,0 +1,165 @@
+package distributed
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// Custom is the first type of command available to handlers registered
+// from outside the package; the types below it are reserved.
+const Custom Type = 64
+
+// Handler implements a type of command applied to the distributed context.
+type Handler struct {
+	// Name identifies the command in logs and snapshots.
+	Name string
+	// Namespaced commands operate on the keys of the message's namespace,
+	// which must exist.
+	Namespaced bool
+	// KeysOnly commands do not change the state they maintain, if any, so
+	// that durable storages need not persist it after they are applied;
+	// only the keys they change are.
+	KeysOnly bool
+	// Encode converts the arguments of a command into the payload of its
+	// log entry, and Decode converts the payload back into the Args of the
+	// message before the command is applied; both are optional, e.g. for
+	// built-in commands, whose arguments are fields of the message.
+	Encode func(args interface{}) ([]byte, error)
+	Decode func(payload []byte) (interface{}, error)
+	// Apply applies a command and returns its result, which is handed back
+	// to the caller of raft.Apply; it is called from the FSM goroutine.
+	Apply func(c *Context, l *raft.Log, message *Message) (interface{}, error)
+	// Snapshot captures the state maintained by the command, if any, when
+	// a snapshot is taken; the value is stored in the snapshot as JSON and
+	// handed back to Restore, along with nil if the snapshot has no state
+	// for the command, so that the state can be replaced.
+	Snapshot func() (interface{}, error)
+	Restore  func(data json.RawMessage) error
+}
+
+// builtins returns the handlers of the commands implemented by the
+// package.
+func builtins() map[Type]*Handler {
+	return map[Type]*Handler{
+		Get:             {Name: "get", Namespaced: true, Apply: (*Context).applyGet},
+		Set:             {Name: "set", Namespaced: true, Apply: (*Context).applySet},
+		Remove:          {Name: "remove", Namespaced: true, Apply: (*Context).applyRemove},
+		List:            {Name: "list", Namespaced: true, Apply: (*Context).applyList},
+		Clear:           {Name: "clear", Namespaced: true, Apply: (*Context).applyClear},
+		CompareAndSwap:  {Name: "compare-and-swap", Namespaced: true, Apply: (*Context).applyCompareAndSwap},
+		Grant:           {Name: "grant", Apply: (*Context).applyGrant},
+		Revoke:          {Name: "revoke", Apply: (*Context).applyRevoke},
+		KeepAlive:       {Name: "keep-alive", Apply: (*Context).applyKeepAlive},
+		Expire:          {Name: "expire", Apply: (*Context).applyExpire},
+		Txn:             {Name: "txn", Namespaced: true, Apply: (*Context).applyTxn},
+		CreateNamespace: {Name: "create-namespace", Apply: (*Context).applyCreateNamespace},
+		DropNamespace:   {Name: "drop-namespace", Apply: (*Context).applyDropNamespace},
+		Compact:         {Name: "compact", Apply: (*Context).applyCompact},
+		Acquire:         {Name: "acquire", Apply: (*Context).applyAcquire},
+		TryAcquire:      {Name: "try-acquire", Apply: (*Context).applyAcquire},
+		Release:         {Name: "release", Apply: (*Context).applyRelease},
+		Campaign:        {Name: "campaign", Apply: (*Context).applyCampaign},
+		Resign:          {Name: "resign", Apply: (*Context).applyResign},
+		Increment:       {Name: "increment", Namespaced: true, Apply: (*Context).applyCount},
+		Allocate:        {Name: "allocate", Namespaced: true, Apply: (*Context).applyCount},
+		Enqueue:         {Name: "enqueue", Apply: (*Context).applyEnqueue},
+		Dequeue:         {Name: "dequeue", Apply: (*Context).applyDequeue},
+		Ack:             {Name: "ack", Apply: (*Context).applySettle},
+		Nack:            {Name: "nack", Apply: (*Context).applySettle},
+		Requeue:         {Name: "requeue", Apply: (*Context).applyRequeue},
+		SetSchema:       {Name: "set-schema", Namespaced: true, Apply: (*Context).applySetSchema},
+		DropSchema:      {Name: "drop-schema", Namespaced: true, Apply: (*Context).applyDropSchema},
+		Batch:           {Name: "batch", Namespaced: true, Apply: (*Context).applyBatch},
+		Stage:           {Name: "stage", Apply: (*Context).applyStage},
+		Import:          {Name: "import", Apply: (*Context).applyImport},
+	}
+}
+
+// Register adds a handler for a custom type of command; it must be called
+// before the context is handed over to Raft.
+func (c *Context) Register(t Type, handler Handler) error {
+	if t < Custom {
+		return fmt.Errorf("command type %d is reserved", t)
+	}
+	if handler.Name == "" || handler.Apply == nil {
+		return fmt.Errorf("command type %d must have a name and an apply function", t)
+	}
+	if (handler.Encode == nil) != (handler.Decode == nil) {
+		return fmt.Errorf("command '%s' must have both encode and decode functions, or neither", handler.Name)
+	}
+	if (handler.Snapshot == nil) != (handler.Restore == nil) {
+		return fmt.Errorf("command '%s' must have both snapshot and restore functions, or neither", handler.Name)
+	}
+	for other, h := range c.handlers {
+		if other == t || h.Name == handler.Name {
+			return fmt.Errorf("command type %d ('%s') already registered as '%s'", t, handler.Name, h.Name)
+		}
+	}
+	if state, ok := c.pending[handler.Name]; ok && handler.Restore != nil {
+		// the state was loaded from a durable storage before registration
+		if err := handler.Restore(state); err != nil {
+			return fmt.Errorf("error restoring state of command '%s': %w", handler.Name, err)
+		}
+		delete(c.pending, handler.Name)
+	}
+	c.handlers[t] = &handler
+	c.logger.Info("command '%s' registered with type %d", handler.Name, t)
+	return nil
+}
+
+// Command encodes a command of a registered type, along with its arguments,
+// into the data of a log entry, ready to be applied with raft.Apply.
+func (c *Context) Command(t Type, args interface{}) ([]byte, error) {
+	handler, ok := c.handlers[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown command type %d", t)
+	}
+	message := &Message{Type: t}
+	if handler.Encode != nil {
+		payload, err := handler.Encode(args)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding arguments of command '%s': %w", handler.Name, err)
+		}
+		message.Payload = payload
+	}
+	return c.encode(message)
+}
+
+// snapshotCommands captures the state of the registered commands that
+// maintain one, by name.
+func (c *Context) snapshotCommands() (map[string]json.RawMessage, error) {
+	states := map[string]json.RawMessage{}
+	for _, handler := range c.handlers {
+		if handler.Snapshot == nil {
+			continue
+		}
+		state, err := handler.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("error taking snapshot of command '%s': %w", handler.Name, err)
+		}
+		if states[handler.Name], err = json.Marshal(state); err != nil {
+			return nil, fmt.Errorf("error marshalling state of command '%s': %w", handler.Name, err)
+		}
+	}
+	return states, nil
+}
+
+// restoreCommands hands the state in a snapshot over to the registered
+// commands that maintain one.
+func (c *Context) restoreCommands(states map[string]json.RawMessage) error {
+	for _, handler := range c.handlers {
+		if handler.Restore == nil {
+			continue
+		}
+		if err := handler.Restore(states[handler.Name]); err != nil {
+			return fmt.Errorf("error restoring state of command '%s': %w", handler.Name, err)
+		}
+		delete(states, handler.Name)
+	}
+	for name := range states {
+		c.logger.Warn("snapshot has state for unknown command '%s'", name)
+	}
+	return nil
+}
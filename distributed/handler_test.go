@@ -0,0 +1,97 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+	"github.com/hashicorp/raft"
+)
+
+// adder is a custom command that adds its argument to a running total,
+// which it keeps in snapshots.
+func adder(total *int) Handler {
+	return Handler{
+		Name:   "add",
+		Encode: func(args interface{}) ([]byte, error) { return []byte(strconv.Itoa(args.(int))), nil },
+		Decode: func(payload []byte) (interface{}, error) { return strconv.Atoi(string(payload)) },
+		Apply: func(c *Context, l *raft.Log, message *Message) (interface{}, error) {
+			*total += message.Args.(int)
+			return &Message{Number: int64(*total), Index: l.Index}, nil
+		},
+		Snapshot: func() (interface{}, error) { return *total, nil },
+		Restore: func(data json.RawMessage) error {
+			*total = 0
+			if data == nil {
+				return nil
+			}
+			return json.Unmarshal(data, total)
+		},
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	var total int
+	if err := c.Register(Custom, adder(&total)); err != nil {
+		t.Fatalf("error registering command: %v", err)
+	}
+	apply := func(c *Context, l *raft.Log, message *Message) (interface{}, error) { return nil, nil }
+	tests := []struct {
+		name    string
+		kind    Type
+		handler Handler
+		err     string
+	}{
+		{"reserved type", Set, Handler{Name: "x", Apply: apply}, "reserved"},
+		{"no name", Custom + 1, Handler{Apply: apply}, "must have a name"},
+		{"no apply", Custom + 1, Handler{Name: "x"}, "must have a name"},
+		{"encode only", Custom + 1, Handler{Name: "x", Apply: apply, Encode: func(interface{}) ([]byte, error) { return nil, nil }}, "encode and decode"},
+		{"restore only", Custom + 1, Handler{Name: "x", Apply: apply, Restore: func(json.RawMessage) error { return nil }}, "snapshot and restore"},
+		{"taken type", Custom, Handler{Name: "x", Apply: apply}, "already registered"},
+		{"taken name", Custom + 1, Handler{Name: "add", Apply: apply}, "already registered"},
+	}
+	for _, test := range tests {
+		if err := c.Register(test.kind, test.handler); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+	}
+	if _, err := c.Command(Custom+1, 1); err == nil {
+		t.Errorf("expected encoding a command of an unknown type to fail")
+	}
+}
+
+func TestCustomCommand(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	var total int
+	c.Register(Custom, adder(&total))
+	for index, args := range []int{2, 3} {
+		data, err := c.Command(Custom, args)
+		if err != nil {
+			t.Fatalf("error encoding command: %v", err)
+		}
+		c.Apply(&raft.Log{Index: uint64(index + 1), Term: 1, Data: data})
+	}
+	if total != 5 {
+		t.Fatalf("expected a total of 5, got %d", total)
+	}
+	// the state of the command travels with snapshots
+	stream := persist(t, c)
+	other := NewContext(test.NewLogger(t))
+	var restored int
+	other.Register(Custom, adder(&restored))
+	if err := other.Restore(io.NopCloser(bytes.NewReader(stream))); err != nil {
+		t.Fatalf("error restoring snapshot: %v", err)
+	}
+	if restored != 5 {
+		t.Errorf("expected a restored total of 5, got %d", restored)
+	}
+	// a command whose payload cannot be decoded fails
+	if refused(t, c, 3, &Message{Type: Custom, Payload: []byte("x")}) == nil {
+		t.Errorf("expected command with an invalid payload to fail")
+	}
+}
@@ -0,0 +1,159 @@
+package distributed
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dihedron/rafter/logging"
+	"github.com/hashicorp/raft"
+)
+
+// Lease is a time-bound grant that keys can be attached to; when the
+// lease expires or is revoked, all of its keys are removed.
+type Lease struct {
+	// ID is the index of the Raft log entry that granted the lease.
+	ID uint64 `json:"id"`
+	// TTL is the time to live of the lease, in seconds.
+	TTL int64 `json:"ttl"`
+	// Expires is the time at which the lease expires, as per the clock
+	// of the leader that committed the last grant or keep-alive.
+	Expires time.Time `json:"expires"`
+	// Keys is the set of keys attached to the lease; it is not stored in
+	// snapshots, since it can be rebuilt from the entries.
+	Keys map[Key]struct{} `json:"-"`
+}
+
+func newLease(id uint64, ttl int64, now time.Time) *Lease {
+	lease := &Lease{
+		ID:   id,
+		TTL:  ttl,
+		Keys: map[Key]struct{}{},
+	}
+	lease.renew(now)
+	return lease
+}
+
+func (l *Lease) renew(now time.Time) {
+	l.Expires = now.Add(time.Duration(l.TTL) * time.Second)
+}
+
+// HasLease returns whether the given lease is currently known to the
+// local replica.
+func (c *Context) HasLease(id uint64) bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	_, ok := c.leases[id]
+	return ok
+}
+
+// Expired returns whether any lease has expired as of the given time;
+// the leader uses it to decide whether to commit an expiry entry.
+func (c *Context) Expired(now time.Time) bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	for _, lease := range c.leases {
+		if !lease.Expires.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// attach binds a key to a lease, detaching it from any previous one; it
+// must be called with the lock held.
+func (c *Context) attach(key Key, id uint64) {
+	c.detach(key)
+	if lease, ok := c.leases[id]; ok {
+		if entry := c.lookup(key.Namespace, key.Name); entry != nil {
+			lease.Keys[key] = struct{}{}
+			attached := *entry
+			attached.Lease = id
+			c.store(key.Namespace, key.Name, &attached)
+		}
+	}
+}
+
+// detach removes a key from the set of keys of its lease, if any; the
+// caller is responsible for replacing or removing the entry; it must be
+// called with the lock held.
+func (c *Context) detach(key Key) {
+	if entry := c.lookup(key.Namespace, key.Name); entry != nil && entry.Lease != 0 {
+		if lease, ok := c.leases[entry.Lease]; ok {
+			delete(lease.Keys, key)
+		}
+	}
+}
+
+// revoke drops a lease along with all its keys, releasing the locks and
+// elections held by it as a session, and returns the removed keys in
+// order; it must be called with the lock held.
+func (c *Context) revoke(id uint64) []Key {
+	lease, ok := c.leases[id]
+	if !ok {
+		return nil
+	}
+	keys := make([]Key, 0, len(lease.Keys))
+	for key := range lease.Keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Namespace != keys[j].Namespace {
+			return keys[i].Namespace < keys[j].Namespace
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	for _, key := range keys {
+		c.remove(key.Namespace, key.Name)
+	}
+	c.abandon(id)
+	delete(c.leases, id)
+	c.touch(extra{kind: leaseExtra, id: id})
+	return keys
+}
+
+// expire revokes all leases that have expired as of the given time, and
+// returns the removed keys; it must be called with the lock held.
+func (c *Context) expire(now time.Time) []Key {
+	ids := []uint64{}
+	for id, lease := range c.leases {
+		if !lease.Expires.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	keys := []Key{}
+	for _, id := range ids {
+		c.logger.Debug("lease %d expired", id)
+		keys = append(keys, c.revoke(id)...)
+	}
+	return keys
+}
+
+// ExpireLeases commits an expiry entry when any lease has expired as per
+// the local clock; it must only be called on the leader, so that expiry
+// is driven by a single clock and applied identically on all replicas.
+func ExpireLeases(c *Context, r *raft.Raft, l logging.Logger) error {
+	now := time.Now()
+	if !c.Expired(now) {
+		return nil
+	}
+	message := &Message{
+		Type: Expire,
+		Time: now,
+	}
+	data, err := c.encode(message)
+	if err != nil {
+		l.Error("error encoding Expire message: %v", err)
+		return err
+	}
+	f := r.Apply(data, time.Second)
+	if err := f.Error(); err != nil {
+		l.Error("error applying Expire message to cluster: %v", err)
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		l.Error("received error from FSM: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestLeaseExpiry(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	lease := apply(t, c, 1, &Message{Type: Grant, TTL: 10, Time: now}).Lease
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1"), Lease: lease})
+	// a key with a TTL gets a lease of its own
+	own := apply(t, c, 3, &Message{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("2"), TTL: 5, Time: now}).Lease
+	if own != 3 {
+		t.Fatalf("expected key to get its own lease 3, got %d", own)
+	}
+	if c.Expired(now.Add(4 * time.Second)) {
+		t.Errorf("expected no lease to be expired before its TTL")
+	}
+	// expiry follows the leader's clock as recorded in the log
+	if !c.Expired(now.Add(5 * time.Second)) {
+		t.Errorf("expected lease %d to be expired after its TTL", own)
+	}
+	apply(t, c, 4, &Message{Type: KeepAlive, Lease: lease, Time: now.Add(8 * time.Second)})
+	result := apply(t, c, 5, &Message{Type: Expire, Time: now.Add(15 * time.Second)})
+	if len(result.Removed) != 1 || result.Removed[0].Name != "b" {
+		t.Errorf("expected only key 'b' to expire, got %v", result.Removed)
+	}
+	if c.HasLease(own) || !c.HasLease(lease) {
+		t.Errorf("expected only lease %d to be left", lease)
+	}
+	result = apply(t, c, 6, &Message{Type: Expire, Time: now.Add(18 * time.Second)})
+	if len(result.Removed) != 1 || result.Removed[0].Name != "a" {
+		t.Errorf("expected key 'a' to expire after its lease was renewed, got %v", result.Removed)
+	}
+	if entry, _ := c.Read(DefaultNamespace, "a"); entry != nil || c.HasLease(lease) {
+		t.Errorf("expected key and lease to be gone, got %+v", entry)
+	}
+	if refused(t, c, 7, &Message{Type: KeepAlive, Lease: lease, Time: now}) == nil {
+		t.Errorf("expected keep-alive of expired lease to fail")
+	}
+}
+
+func TestLeaseRevoke(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	lease := apply(t, c, 1, &Message{Type: Grant, TTL: 60, Time: now}).Lease
+	for i, key := range []string{"b", "a"} {
+		apply(t, c, uint64(i+2), &Message{Type: Set, Namespace: DefaultNamespace, Key: key, Value: []byte("1"), Lease: lease})
+	}
+	// a key written again without the lease is detached from it
+	apply(t, c, 4, &Message{Type: Set, Namespace: DefaultNamespace, Key: "c", Value: []byte("1"), Lease: lease})
+	apply(t, c, 5, &Message{Type: Set, Namespace: DefaultNamespace, Key: "c", Value: []byte("2")})
+	result := apply(t, c, 6, &Message{Type: Revoke, Lease: lease})
+	if len(result.Removed) != 2 || result.Removed[0].Name != "a" || result.Removed[1].Name != "b" {
+		t.Errorf("expected keys 'a' and 'b' to be removed in order, got %v", result.Removed)
+	}
+	if entry, _ := c.Read(DefaultNamespace, "c"); entry == nil || string(entry.Value) != "2" {
+		t.Errorf("expected detached key to survive the lease, got %+v", entry)
+	}
+	if refused(t, c, 7, &Message{Type: Revoke, Lease: lease}) == nil {
+		t.Errorf("expected revoking a revoked lease to fail")
+	}
+	if refused(t, c, 8, &Message{Type: Set, Namespace: DefaultNamespace, Key: "d", Value: []byte("1"), Lease: lease}) == nil {
+		t.Errorf("expected setting a key with a revoked lease to fail")
+	}
+}
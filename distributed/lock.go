@@ -0,0 +1,145 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+)
+
+// Lock is a named mutex held by a session, i.e. a lease that the client
+// keeps alive; when the session's lease expires or is revoked, the lock
+// passes on to the next waiting session.
+type Lock struct {
+	Name string `json:"name"`
+	// Session is the lease of the holder.
+	Session uint64 `json:"session"`
+	// Token is the index of the Raft log entry that gave the lock to the
+	// holder; it grows with every acquisition, so it can be used as a
+	// fencing token.
+	Token uint64 `json:"token"`
+	// Waiters are the sessions waiting for the lock, in order of arrival.
+	Waiters []uint64 `json:"waiters,omitempty"`
+}
+
+// acquire gives the lock to the session if it is free, or queues the
+// session if wait is set, and returns the lock; it must be called with
+// the lock held.
+func (c *Context) acquire(name string, session uint64, wait bool) (*Lock, error) {
+	if _, ok := c.leases[session]; !ok {
+		return nil, fmt.Errorf("session %d not found", session)
+	}
+	lock, ok := c.locks[name]
+	if !ok {
+		lock = &Lock{Name: name, Session: session, Token: c.index}
+		c.locks[name] = lock
+		c.touch(extra{kind: lockExtra, name: name})
+		return lock, nil
+	}
+	if wait && lock.Session != session && !lock.waiting(session) {
+		lock.Waiters = append(lock.Waiters, session)
+		c.touch(extra{kind: lockExtra, name: name})
+	}
+	return lock, nil
+}
+
+// release gives up the lock if the session holds it, or stops waiting for
+// it otherwise; it must be called with the lock held.
+func (c *Context) release(name string, session uint64) error {
+	lock, ok := c.locks[name]
+	if ok && lock.Session == session {
+		c.handover(lock)
+		return nil
+	}
+	if ok && lock.waiting(session) {
+		lock.Waiters = lock.dequeue(session)
+		c.touch(extra{kind: lockExtra, name: name})
+		return nil
+	}
+	return fmt.Errorf("lock '%s' is not held by session %d", name, session)
+}
+
+// abandon releases all locks held or waited for by a session whose lease
+// is gone, and withdraws it from all elections; it must be called with the
+// lock held.
+func (c *Context) abandon(session uint64) {
+	for _, election := range c.elections {
+		if election.running(session) {
+			election.Candidates = election.withdraw(session)
+			c.touch(extra{kind: electionExtra, name: election.Name})
+		}
+		if election.Leader.Session == session {
+			c.logger.Debug("leader of election '%s' resigned as session %d ended", election.Name, session)
+			c.succeed(election)
+		}
+	}
+	for _, lock := range c.locks {
+		if lock.waiting(session) {
+			lock.Waiters = lock.dequeue(session)
+			c.touch(extra{kind: lockExtra, name: lock.Name})
+		}
+		if lock.Session == session {
+			c.logger.Debug("lock '%s' released as session %d ended", lock.Name, session)
+			c.handover(lock)
+		}
+	}
+}
+
+// handover passes the lock on to the first waiter, or frees it if there
+// are none; it must be called with the lock held.
+func (c *Context) handover(lock *Lock) {
+	c.touch(extra{kind: lockExtra, name: lock.Name})
+	if len(lock.Waiters) == 0 {
+		delete(c.locks, lock.Name)
+		return
+	}
+	lock.Session, lock.Waiters = lock.Waiters[0], lock.Waiters[1:]
+	lock.Token = c.index
+}
+
+// waiting returns whether the session is queued for the lock.
+func (l *Lock) waiting(session uint64) bool {
+	for _, waiter := range l.Waiters {
+		if waiter == session {
+			return true
+		}
+	}
+	return false
+}
+
+// dequeue returns the waiters without the given session.
+func (l *Lock) dequeue(session uint64) []uint64 {
+	waiters := make([]uint64, 0, len(l.Waiters))
+	for _, waiter := range l.Waiters {
+		if waiter != session {
+			waiters = append(waiters, waiter)
+		}
+	}
+	return waiters
+}
+
+// Await blocks until the session holds the named lock and returns its
+// fencing token; it fails if the session stops waiting for the lock, e.g.
+// because its lease expired, or if the context is done.
+func (c *Context) Await(ctx context.Context, name string, session uint64) (uint64, error) {
+	for {
+		c.mtx.RLock()
+		lock, ok := c.locks[name]
+		var holder, token uint64
+		waiting := false
+		if ok {
+			holder, token, waiting = lock.Session, lock.Token, lock.waiting(session)
+		}
+		notify := c.applied
+		c.mtx.RUnlock()
+		if holder == session {
+			return token, nil
+		}
+		if !waiting {
+			return 0, fmt.Errorf("session %d is no longer waiting for lock '%s'", session, name)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("error waiting for lock '%s': %w", name, ctx.Err())
+		case <-notify:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestLockHandover(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	sessions := []uint64{}
+	for index := uint64(1); index <= 3; index++ {
+		sessions = append(sessions, apply(t, c, index, &Message{Type: Grant, TTL: 60, Time: now}).Lease)
+	}
+	first, second, third := sessions[0], sessions[1], sessions[2]
+	if result := apply(t, c, 4, &Message{Type: Acquire, Key: "l", Lease: first}); !result.Succeeded || result.Token != 4 {
+		t.Fatalf("expected first session to get the lock with token 4, got %+v", result)
+	}
+	// a try does not queue the session, an acquisition does
+	if result := apply(t, c, 5, &Message{Type: TryAcquire, Key: "l", Lease: third}); result.Succeeded || result.Lease != first {
+		t.Errorf("expected try to fail while the first session holds the lock, got %+v", result)
+	}
+	for i, session := range []uint64{second, third} {
+		if result := apply(t, c, uint64(i+6), &Message{Type: Acquire, Key: "l", Lease: session}); result.Succeeded {
+			t.Errorf("expected session %d to wait for the lock", session)
+		}
+	}
+	// the lock passes on in order of arrival, with a new fencing token
+	apply(t, c, 8, &Message{Type: Release, Key: "l", Lease: first})
+	token, err := c.Await(context.Background(), "l", second)
+	if err != nil || token != 8 {
+		t.Errorf("expected second session to get the lock with token 8, got %d (%v)", token, err)
+	}
+	// the lock passes on as well when its holder's session ends
+	apply(t, c, 9, &Message{Type: Revoke, Lease: second})
+	if token, err := c.Await(context.Background(), "l", third); err != nil || token != 9 {
+		t.Errorf("expected third session to get the lock with token 9, got %d (%v)", token, err)
+	}
+	apply(t, c, 10, &Message{Type: Release, Key: "l", Lease: third})
+	if result := apply(t, c, 11, &Message{Type: TryAcquire, Key: "l", Lease: first}); !result.Succeeded || result.Token != 11 {
+		t.Errorf("expected freed lock to be acquired with token 11, got %+v", result)
+	}
+	if refused(t, c, 12, &Message{Type: Release, Key: "l", Lease: third}) == nil {
+		t.Errorf("expected release by a session not holding the lock to fail")
+	}
+	if refused(t, c, 13, &Message{Type: Acquire, Key: "l", Lease: 99}) == nil {
+		t.Errorf("expected acquisition by an unknown session to fail")
+	}
+}
+
+func TestLockAwait(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	holder := apply(t, c, 1, &Message{Type: Grant, TTL: 60, Time: now}).Lease
+	waiter := apply(t, c, 2, &Message{Type: Grant, TTL: 60, Time: now}).Lease
+	apply(t, c, 3, &Message{Type: Acquire, Key: "l", Lease: holder})
+	apply(t, c, 4, &Message{Type: Acquire, Key: "l", Lease: waiter})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Await(ctx, "l", waiter); err == nil {
+		t.Errorf("expected waiting to time out while the lock is held")
+	}
+	// a waiter whose session ends stops waiting
+	done := make(chan error)
+	go func() {
+		_, err := c.Await(context.Background(), "l", waiter)
+		done <- err
+	}()
+	apply(t, c, 5, &Message{Type: Revoke, Lease: waiter})
+	if err := <-done; err == nil {
+		t.Errorf("expected waiting to fail once the session ended")
+	}
+}
@@ -1,5 +1,10 @@
 package distributed
 
+import (
+	"fmt"
+	"time"
+)
+
 type Type int8
 
 const (
@@ -8,17 +13,100 @@ const (
 	Remove
 	List
 	Clear
+	CompareAndSwap
+	Grant
+	Revoke
+	KeepAlive
+	Expire
+	Txn
+	CreateNamespace
+	DropNamespace
+	Compact
+	Acquire
+	TryAcquire
+	Release
+	Campaign
+	Resign
+	Increment
+	Allocate
+	Enqueue
+	Dequeue
+	Ack
+	Nack
+	Requeue
+	SetSchema
+	DropSchema
+	Batch
+	Stage
+	Import
 )
 
 func (t Type) String() string {
-	return []string{"GET", "SET", "DEL", "LST", "CLR"}[t]
+	if t >= Custom {
+		return fmt.Sprintf("C%02d", t-Custom)
+	}
+	if t < 0 || int(t) >= len(types) {
+		return fmt.Sprintf("T%02d", int(t))
+	}
+	return types[t]
 }
 
+var types = []string{"GET", "SET", "DEL", "LST", "CLR", "CAS", "GRT", "RVK", "KAL", "EXP", "TXN", "NSC", "NSD", "CMP", "ACQ", "TRY", "REL", "CPG", "RSG", "INC", "SEQ", "ENQ", "DEQ", "ACK", "NAK", "RQU", "SCS", "SCD", "BAT", "STG", "IMP"}
+
+// Condition is the kind of precondition checked by a compare-and-swap.
+type Condition int8
+
+const (
+	// IfIndex requires the key's modification index to match; an index of
+	// 0 requires that the key does not exist yet.
+	IfIndex Condition = iota + 1
+	// IfValue requires the key's current value to match.
+	IfValue
+	// IfVersion requires the key's version to match; a version of 0
+	// requires that the key does not exist yet.
+	IfVersion
+)
+
 type Message struct {
-	Type   Type     `json:"type"`
-	Key    string   `json:"key,omitempty"`
-	Value  []byte   `json:"value,omitempty"`
-	Filter string   `json:"filter,omitempty"`
-	Keys   []string `json:"keys,omitempty"`
-	Index  uint64   `json:"index,omitempty"`
+	Type        Type         `json:"type"`
+	Namespace   string       `json:"namespace,omitempty"`
+	Key         string       `json:"key,omitempty"`
+	Value       []byte       `json:"value,omitempty"`
+	Filter      string       `json:"filter,omitempty"`
+	Keys        []string     `json:"keys,omitempty"`
+	Index       uint64       `json:"index,omitempty"`
+	Condition   Condition    `json:"condition,omitempty"`
+	PrevValue   []byte       `json:"prev_value,omitempty"`
+	PrevIndex   uint64       `json:"prev_index,omitempty"`
+	PrevVersion uint64       `json:"prev_version,omitempty"`
+	ModIndex    uint64       `json:"mod_index,omitempty"`
+	Succeeded   bool         `json:"succeeded,omitempty"`
+	Lease       uint64       `json:"lease,omitempty"`
+	TTL         int64        `json:"ttl,omitempty"`
+	Time        time.Time    `json:"time,omitempty"`
+	Comparisons []Comparison `json:"comparisons,omitempty"`
+	Success     []Operation  `json:"success,omitempty"`
+	Failure     []Operation  `json:"failure,omitempty"`
+	Operations  []Operation  `json:"operations,omitempty"`
+	Results     []*Message   `json:"results,omitempty"`
+	Removed     []Key        `json:"removed,omitempty"`
+	Revision    uint64       `json:"revision,omitempty"`
+	Token       uint64       `json:"token,omitempty"`
+	Delta       int64        `json:"delta,omitempty"`
+	Min         *int64       `json:"min,omitempty"`
+	Max         *int64       `json:"max,omitempty"`
+	Number      int64        `json:"number,omitempty"`
+	Item        uint64       `json:"item,omitempty"`
+	Replace     bool         `json:"replace,omitempty"`
+	// Entry is the key a Get, Remove or CompareAndSwap operated on, for
+	// its metadata.
+	Entry *Entry `json:"entry,omitempty"`
+	// Payload holds the encoded arguments of custom commands, and Args the
+	// arguments decoded by the command's handler.
+	Payload []byte      `json:"payload,omitempty"`
+	Args    interface{} `json:"-"`
+	// Client and Sequence identify a request, so that it is applied only
+	// once however many times it is retried.
+	Client   string `json:"client,omitempty"`
+	Sequence uint64 `json:"sequence,omitempty"`
 }
@@ -0,0 +1,82 @@
+package distributed
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultNamespace is the namespace of requests that do not specify one;
+// it always exists and cannot be dropped.
+const DefaultNamespace = "default"
+
+// Key identifies a key in a namespace.
+type Key struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// HasNamespace returns whether the given namespace exists.
+func (c *Context) HasNamespace(namespace string) bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.storage.HasNamespace(namespace)
+}
+
+// Namespaces returns the names of all namespaces in order, along with the
+// index they were read at.
+func (c *Context) Namespaces() ([]string, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return visible(c.storage.Namespaces()), c.settled
+}
+
+// checkNamespace returns an error if the namespace does not exist.
+func (c *Context) checkNamespace(namespace string) error {
+	if !c.HasNamespace(namespace) {
+		c.logger.Error("namespace '%s' not found", namespace)
+		return fmt.Errorf("namespace '%s' not found", namespace)
+	}
+	return nil
+}
+
+// create adds an empty namespace; it must be called with the lock held.
+func (c *Context) create(namespace string) error {
+	if staged(namespace) {
+		return fmt.Errorf("namespace '%s' is reserved", namespace)
+	}
+	if c.storage.HasNamespace(namespace) {
+		return fmt.Errorf("namespace '%s' already exists", namespace)
+	}
+	c.storage.Create(namespace)
+	return nil
+}
+
+// drop removes a namespace along with all its keys, and returns the
+// removed keys; it must be called with the lock held.
+func (c *Context) drop(namespace string) ([]Key, error) {
+	if namespace == DefaultNamespace {
+		return nil, fmt.Errorf("namespace '%s' cannot be dropped", namespace)
+	}
+	if !c.storage.HasNamespace(namespace) {
+		return nil, fmt.Errorf("namespace '%s' not found", namespace)
+	}
+	keys := c.clear(namespace, nil)
+	c.storage.Drop(namespace)
+	for prefix := range c.schemas[namespace] {
+		c.touch(extra{kind: schemaExtra, name: namespace, key: prefix})
+	}
+	delete(c.schemas, namespace)
+	return keys, nil
+}
+
+// clear removes the keys of a namespace that match the given regular
+// expression (all keys if nil), and returns them; it must be called with
+// the lock held.
+func (c *Context) clear(namespace string, re *regexp.Regexp) []Key {
+	keys := []Key{}
+	for _, name := range c.keys(namespace, re) {
+		c.remove(namespace, name)
+		keys = append(keys, Key{Namespace: namespace, Name: name})
+	}
+	return keys
+}
@@ -0,0 +1,58 @@
+package distributed
+
+import (
+	"fmt"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: CreateNamespace, Namespace: "ns"})
+	// the same key is independent in each namespace
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	apply(t, c, 3, &Message{Type: Set, Namespace: "ns", Key: "a", Value: []byte("2")})
+	apply(t, c, 4, &Message{Type: Set, Namespace: "ns", Key: "b", Value: []byte("3")})
+	if entry, _ := c.Read(DefaultNamespace, "a"); string(entry.Value) != "1" {
+		t.Errorf("expected value '1' in the default namespace, got '%s'", entry.Value)
+	}
+	if namespaces, _ := c.Namespaces(); fmt.Sprint(namespaces) != "[default ns]" {
+		t.Errorf("expected namespaces in order, got %v", namespaces)
+	}
+	s, _, _ := c.Watch(0)
+	defer s.Cancel()
+	result := apply(t, c, 5, &Message{Type: DropNamespace, Namespace: "ns"})
+	if len(result.Removed) != 2 {
+		t.Errorf("expected the keys of the namespace to be removed, got %v", result.Removed)
+	}
+	for _, key := range []string{"a", "b"} {
+		if event := <-s.Events; event.Type != Delete || event.Namespace != "ns" || event.Key != key {
+			t.Errorf("expected deletion of 'ns/%s', got %+v", key, event)
+		}
+	}
+	if entry, _ := c.Read(DefaultNamespace, "a"); entry == nil {
+		t.Errorf("expected the default namespace to be untouched")
+	}
+}
+
+func TestNamespaceErrors(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: CreateNamespace, Namespace: "ns"})
+	tests := []struct {
+		name    string
+		message *Message
+	}{
+		{"create existing", &Message{Type: CreateNamespace, Namespace: "ns"}},
+		{"create reserved", &Message{Type: CreateNamespace, Namespace: staging("x", "ns")}},
+		{"drop default", &Message{Type: DropNamespace, Namespace: DefaultNamespace}},
+		{"drop missing", &Message{Type: DropNamespace, Namespace: "missing"}},
+		{"set in missing", &Message{Type: Set, Namespace: "missing", Key: "a"}},
+		{"remove in missing", &Message{Type: Remove, Namespace: "missing", Key: "a"}},
+	}
+	for i, test := range tests {
+		if refused(t, c, uint64(i+2), test.message) == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
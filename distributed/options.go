@@ -0,0 +1,45 @@
+package distributed
+
+import (
+	"github.com/dihedron/rafter/compression"
+	"github.com/dihedron/rafter/encryption"
+)
+
+// Option is the type for functional options of a context.
+type Option func(*Context)
+
+// WithKeyring encrypts the snapshots of the context with the given keyring,
+// along with its keys and values when they are stored on disk.
+func WithKeyring(keyring *encryption.Keyring) Option {
+	return func(c *Context) {
+		c.keyring = keyring
+	}
+}
+
+// WithCompression compresses the snapshots of the context with the given
+// codec, along with the log entries it encodes whose size is above the
+// threshold; a nil codec disables compression.
+func WithCompression(codec compression.Codec, threshold int) Option {
+	return func(c *Context) {
+		c.codec = codec
+		c.threshold = threshold
+	}
+}
+
+// WithRetention sets the number of log entries whose revisions are kept for
+// reads at past revisions, older ones being compacted by the leader; zero
+// keeps them until compacted explicitly. Only the leader's setting matters.
+func WithRetention(entries uint64) Option {
+	return func(c *Context) {
+		c.retention = entries
+	}
+}
+
+// WithMaxBatch sets the maximum number of items in a batch request; larger
+// batches are refused before they reach the log, and imports are staged and
+// applied in batches of at most that many keys.
+func WithMaxBatch(size int) Option {
+	return func(c *Context) {
+		c.maxBatch = size
+	}
+}
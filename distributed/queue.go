@@ -0,0 +1,208 @@
+package distributed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dihedron/rafter/logging"
+	iradix "github.com/hashicorp/go-immutable-radix"
+	"github.com/hashicorp/raft"
+)
+
+// Item is an element of a queue; items are shared with snapshots and must
+// never be modified once stored.
+type Item struct {
+	// ID is the index of the Raft log entry that enqueued the item; items
+	// are delivered in order of ID.
+	ID    uint64 `json:"id"`
+	Value []byte `json:"value,omitempty"`
+	// Deliveries is the number of times the item was dequeued.
+	Deliveries int64 `json:"deliveries,omitempty"`
+	// Deadline is the time at which an item that was dequeued and not yet
+	// acknowledged becomes visible again, as per the clock of the leader
+	// that committed the dequeue; it is zero for visible items.
+	Deadline time.Time `json:"deadline"`
+}
+
+// Queue is a FIFO queue; its visible items and the items in flight, i.e.
+// dequeued but not acknowledged yet, are kept in immutable radix trees
+// keyed by item ID, so that snapshots can hold on to their roots.
+type Queue struct {
+	ready    *iradix.Tree
+	inflight *iradix.Tree
+}
+
+func newQueue() *Queue {
+	return &Queue{ready: iradix.New(), inflight: iradix.New()}
+}
+
+// id returns the key of an item in the queue's trees.
+func id(item uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, item)
+	return key
+}
+
+// queue returns the named queue, creating it if needed; it must be called
+// with the lock held.
+func (c *Context) queue(name string) *Queue {
+	queue, ok := c.queues[name]
+	if !ok {
+		queue = newQueue()
+		c.queues[name] = queue
+	}
+	return queue
+}
+
+// tidy drops the named queue if it is empty; it must be called with the
+// lock held.
+func (c *Context) tidy(name string) {
+	if queue, ok := c.queues[name]; ok && queue.ready.Len() == 0 && queue.inflight.Len() == 0 {
+		delete(c.queues, name)
+	}
+}
+
+// enqueue appends an item to the named queue; it must be called with the
+// lock held.
+func (c *Context) enqueue(name string, value []byte, index uint64) {
+	queue := c.queue(name)
+	queue.ready, _, _ = queue.ready.Insert(id(index), &Item{ID: index, Value: value})
+	c.touch(extra{kind: itemExtra, name: name, id: index})
+}
+
+// dequeue takes the first visible item of the named queue, if any, and
+// hides it until the deadline; it must be called with the lock held.
+func (c *Context) dequeue(name string, deadline time.Time) *Item {
+	queue, ok := c.queues[name]
+	if !ok {
+		return nil
+	}
+	key, value, ok := queue.ready.Root().Minimum()
+	if !ok {
+		return nil
+	}
+	item := *value.(*Item)
+	item.Deliveries++
+	item.Deadline = deadline
+	queue.ready, _, _ = queue.ready.Delete(key)
+	queue.inflight, _, _ = queue.inflight.Insert(key, &item)
+	c.touch(extra{kind: itemExtra, name: name, id: item.ID})
+	return &item
+}
+
+// settle removes an item in flight from the named queue, either dropping
+// it (ack) or making it visible again in its original position (nack); it
+// must be called with the lock held.
+func (c *Context) settle(name string, item uint64, ack bool) error {
+	queue, ok := c.queues[name]
+	if !ok {
+		return fmt.Errorf("queue '%s' not found", name)
+	}
+	inflight, value, ok := queue.inflight.Delete(id(item))
+	if !ok {
+		return fmt.Errorf("item %d of queue '%s' is not in flight", item, name)
+	}
+	queue.inflight = inflight
+	c.touch(extra{kind: itemExtra, name: name, id: item})
+	if !ack {
+		visible := *value.(*Item)
+		visible.Deadline = time.Time{}
+		queue.ready, _, _ = queue.ready.Insert(id(item), &visible)
+	}
+	c.tidy(name)
+	return nil
+}
+
+// requeue makes the items in flight whose deadline has passed as of the
+// given time visible again, and returns their number; it must be called
+// with the lock held.
+func (c *Context) requeue(now time.Time) int {
+	names := make([]string, 0, len(c.queues))
+	for name := range c.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	count := 0
+	for _, name := range names {
+		queue := c.queues[name]
+		queue.inflight.Root().Walk(func(k []byte, v interface{}) bool {
+			if item := *v.(*Item); !item.Deadline.After(now) {
+				item.Deadline = time.Time{}
+				queue.inflight, _, _ = queue.inflight.Delete(k)
+				queue.ready, _, _ = queue.ready.Insert(k, &item)
+				c.touch(extra{kind: itemExtra, name: name, id: item.ID})
+				count++
+			}
+			return false
+		})
+	}
+	return count
+}
+
+// Peek returns the first visible item of the named queue, or nil, along
+// with the number of visible items and items in flight, and the index they
+// were read at.
+func (c *Context) Peek(name string) (*Item, int, int, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	queue, ok := c.queues[name]
+	if !ok {
+		return nil, 0, 0, c.settled
+	}
+	var item *Item
+	if _, value, ok := queue.ready.Root().Minimum(); ok {
+		item = value.(*Item)
+	}
+	return item, queue.ready.Len(), queue.inflight.Len(), c.settled
+}
+
+// Overdue returns whether any item in flight has passed its deadline as
+// of the given time; the leader uses it to decide whether to commit a
+// requeue entry.
+func (c *Context) Overdue(now time.Time) bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	overdue := false
+	for _, queue := range c.queues {
+		queue.inflight.Root().Walk(func(k []byte, v interface{}) bool {
+			overdue = !v.(*Item).Deadline.After(now)
+			return overdue
+		})
+		if overdue {
+			break
+		}
+	}
+	return overdue
+}
+
+// RequeueItems commits a requeue entry when any item in flight has passed
+// its deadline as per the local clock; it must only be called on the
+// leader, so that timeouts are driven by a single clock and applied
+// identically on all replicas.
+func RequeueItems(c *Context, r *raft.Raft, l logging.Logger) error {
+	now := time.Now()
+	if !c.Overdue(now) {
+		return nil
+	}
+	message := &Message{
+		Type: Requeue,
+		Time: now,
+	}
+	data, err := c.encode(message)
+	if err != nil {
+		l.Error("error encoding Requeue message: %v", err)
+		return err
+	}
+	f := r.Apply(data, time.Second)
+	if err := f.Error(); err != nil {
+		l.Error("error applying Requeue message to cluster: %v", err)
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		l.Error("received error from FSM: %v", err)
+		return err
+	}
+	return nil
+}
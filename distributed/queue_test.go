@@ -0,0 +1,59 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestQueueRequeue(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, value := range []string{"a", "b"} {
+		apply(t, c, uint64(i+1), &Message{Type: Enqueue, Key: "q", Value: []byte(value)})
+	}
+	first := apply(t, c, 3, &Message{Type: Dequeue, Key: "q", TTL: 10, Time: now})
+	if !first.Succeeded || string(first.Value) != "a" || first.Number != 1 {
+		t.Fatalf("expected first item on its first delivery, got %+v", first)
+	}
+	if item, ready, inflight, _ := c.Peek("q"); string(item.Value) != "b" || ready != 1 || inflight != 1 {
+		t.Errorf("expected 'b' to be visible with 'a' in flight, got %+v (%d, %d)", item, ready, inflight)
+	}
+	// items in flight become visible again at their deadline, as per the
+	// leader's clock, in their original position
+	if c.Overdue(now.Add(9 * time.Second)) {
+		t.Errorf("expected no item to be overdue before its deadline")
+	}
+	if !c.Overdue(now.Add(10 * time.Second)) {
+		t.Errorf("expected item to be overdue at its deadline")
+	}
+	if result := apply(t, c, 4, &Message{Type: Requeue, Time: now.Add(10 * time.Second)}); result.Number != 1 {
+		t.Errorf("expected 1 item requeued, got %d", result.Number)
+	}
+	again := apply(t, c, 5, &Message{Type: Dequeue, Key: "q", TTL: 10, Time: now.Add(10 * time.Second)})
+	if again.Item != first.Item || again.Number != 2 {
+		t.Errorf("expected first item on its second delivery, got %+v", again)
+	}
+	// a nack makes the item visible right away, an ack drops it
+	apply(t, c, 6, &Message{Type: Nack, Key: "q", Item: again.Item})
+	again = apply(t, c, 7, &Message{Type: Dequeue, Key: "q", TTL: 10, Time: now.Add(10 * time.Second)})
+	if again.Item != first.Item || again.Number != 3 {
+		t.Errorf("expected first item on its third delivery, got %+v", again)
+	}
+	apply(t, c, 8, &Message{Type: Ack, Key: "q", Item: again.Item})
+	if refused(t, c, 9, &Message{Type: Ack, Key: "q", Item: again.Item}) == nil {
+		t.Errorf("expected acknowledging an item twice to fail")
+	}
+	if result := apply(t, c, 10, &Message{Type: Requeue, Time: now.Add(time.Hour)}); result.Number != 0 {
+		t.Errorf("expected acknowledged item not to be requeued, got %d", result.Number)
+	}
+	last := apply(t, c, 11, &Message{Type: Dequeue, Key: "q", TTL: 10, Time: now})
+	apply(t, c, 12, &Message{Type: Ack, Key: "q", Item: last.Item})
+	if result := apply(t, c, 13, &Message{Type: Dequeue, Key: "q", TTL: 10, Time: now}); result.Succeeded {
+		t.Errorf("expected empty queue, got %+v", result)
+	}
+	if _, ok := c.queues["q"]; ok {
+		t.Errorf("expected empty queue to be dropped")
+	}
+}
@@ -0,0 +1,112 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+// RangeQuery selects the keys of a namespace in lexicographic order,
+// either by prefix or in the [Start, End) interval; an empty End means
+// up to the last key.
+type RangeQuery struct {
+	Prefix string
+	Start  string
+	End    string
+	// Limit is the maximum number of keys returned (0 means no limit).
+	Limit int
+	// Token is the continuation token returned by a previous query.
+	Token string
+	// KeysOnly omits the values from the returned pairs.
+	KeysOnly bool
+	// CountOnly only counts the keys in range, ignoring the limit.
+	CountOnly bool
+	// Revision is the index to read the keys at (0 means the latest).
+	Revision uint64
+}
+
+// KeyValue is a key along with its entry.
+type KeyValue struct {
+	Key   string
+	Entry *Entry
+}
+
+// RangeResult holds the pairs in range, their count and the continuation
+// token to fetch the next page, empty if there are no more keys.
+type RangeResult struct {
+	Pairs []KeyValue
+	Count int
+	Token string
+	Index uint64
+}
+
+// Range returns the keys of a namespace in the local state that fall in
+// the given range, in lexicographic order.
+func (c *Context) Range(namespace string, query RangeQuery) (*RangeResult, error) {
+	if query.Prefix != "" && (query.Start != "" || query.End != "") {
+		return nil, fmt.Errorf("a range cannot have both a prefix and an interval")
+	}
+	from := []byte(query.Start)
+	if query.Prefix != "" {
+		from = []byte(query.Prefix)
+	}
+	if query.Token != "" {
+		next, err := base64.RawURLEncoding.DecodeString(query.Token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid continuation token '%s': %w", query.Token, err)
+		}
+		if bytes.Compare(next, from) > 0 {
+			from = next
+		}
+	}
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d", query.Limit)
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if !c.storage.HasNamespace(namespace) {
+		return nil, fmt.Errorf("namespace '%s' not found", namespace)
+	}
+	if query.Revision != 0 {
+		if err := c.checkRevision(query.Revision); err != nil {
+			return nil, err
+		}
+	}
+	result := &RangeResult{
+		Index: c.settled,
+	}
+	// past keys are only found in the history
+	c.storage.Seek(namespace, query.Revision != 0, from, func(k []byte, v interface{}) bool {
+		if query.Prefix != "" && !bytes.HasPrefix(k, []byte(query.Prefix)) {
+			return true
+		}
+		if query.End != "" && bytes.Compare(k, []byte(query.End)) >= 0 {
+			return true
+		}
+		if query.Revision != 0 {
+			if v = at(v.([]Revision), query.Revision); v.(*Entry) == nil {
+				return false
+			}
+		}
+		if query.CountOnly {
+			result.Count++
+			return false
+		}
+		if query.Limit > 0 && result.Count == query.Limit {
+			// there is at least one more key: resume from here
+			result.Token = base64.RawURLEncoding.EncodeToString(k)
+			return true
+		}
+		pair := KeyValue{Key: string(k)}
+		if entry := v.(*Entry); query.KeysOnly {
+			pair.Entry = &Entry{Index: entry.Index, Version: entry.Version, Lease: entry.Lease, Created: entry.Created, Size: entry.size()}
+		} else {
+			pair.Entry = entry
+		}
+		result.Pairs = append(result.Pairs, pair)
+		result.Count++
+		return false
+	})
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package distributed
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+// pages runs a range query to completion, following its continuation
+// tokens, and returns the keys of each page.
+func pages(t *testing.T, c *Context, query RangeQuery) []string {
+	t.Helper()
+	result := []string{}
+	for {
+		page, err := c.Range(DefaultNamespace, query)
+		if err != nil {
+			t.Fatalf("error querying range: %v", err)
+		}
+		keys := []string{}
+		for _, pair := range page.Pairs {
+			keys = append(keys, pair.Key)
+		}
+		result = append(result, strings.Join(keys, ","))
+		if page.Token == "" {
+			return result
+		}
+		query.Token = page.Token
+	}
+}
+
+func TestRangePages(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	for i, key := range []string{"a", "b/1", "b/2", "b/3", "c", "d"} {
+		apply(t, c, uint64(i+1), &Message{Type: Set, Namespace: DefaultNamespace, Key: key, Value: []byte(key)})
+	}
+	tests := []struct {
+		name     string
+		query    RangeQuery
+		expected string
+	}{
+		{"all", RangeQuery{}, "[a,b/1,b/2,b/3,c,d]"},
+		{"pages", RangeQuery{Limit: 2}, "[a,b/1 b/2,b/3 c,d]"},
+		{"prefix", RangeQuery{Prefix: "b/", Limit: 2}, "[b/1,b/2 b/3]"},
+		{"interval", RangeQuery{Start: "b/2", End: "d", Limit: 2}, "[b/2,b/3 c]"},
+		{"open interval", RangeQuery{Start: "c"}, "[c,d]"},
+		{"exact pages", RangeQuery{Prefix: "b/", Limit: 3}, "[b/1,b/2,b/3]"},
+		{"empty", RangeQuery{Prefix: "x"}, "[]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(pages(t, c, test.query)); got != test.expected {
+			t.Errorf("%s: expected pages %s, got %s", test.name, test.expected, got)
+		}
+	}
+	// a token never moves the range before its start
+	first, _ := c.Range(DefaultNamespace, RangeQuery{Limit: 1})
+	if got := fmt.Sprint(pages(t, c, RangeQuery{Start: "c", Token: first.Token})); got != "[c,d]" {
+		t.Errorf("expected token before the start to be ignored, got %s", got)
+	}
+	if result, _ := c.Range(DefaultNamespace, RangeQuery{Prefix: "b/", Limit: 1, CountOnly: true}); result.Count != 3 || result.Token != "" {
+		t.Errorf("expected a count of 3 ignoring the limit, got %d", result.Count)
+	}
+}
+
+func TestRangeRevision(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("2")})
+	apply(t, c, 3, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "a"})
+	apply(t, c, 4, &Message{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("3")})
+	result, err := c.Range(DefaultNamespace, RangeQuery{Revision: 2})
+	if err != nil {
+		t.Fatalf("error querying range at revision 2: %v", err)
+	}
+	if len(result.Pairs) != 2 || string(result.Pairs[1].Entry.Value) != "2" {
+		t.Errorf("expected both keys as of revision 2, got %+v", result.Pairs)
+	}
+	if got := fmt.Sprint(pages(t, c, RangeQuery{Revision: 3, Limit: 1})); got != "[b]" {
+		t.Errorf("expected only 'b' as of revision 3, got %s", got)
+	}
+}
+
+func TestRangeErrors(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	tests := []struct {
+		name      string
+		namespace string
+		query     RangeQuery
+	}{
+		{"prefix and interval", DefaultNamespace, RangeQuery{Prefix: "a", Start: "a"}},
+		{"invalid token", DefaultNamespace, RangeQuery{Token: "!"}},
+		{"negative limit", DefaultNamespace, RangeQuery{Limit: -1}},
+		{"missing namespace", "missing", RangeQuery{}},
+		{"future revision", DefaultNamespace, RangeQuery{Revision: 2}},
+	}
+	for _, test := range tests {
+		if _, err := c.Range(test.namespace, test.query); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
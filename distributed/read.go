@@ -0,0 +1,190 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// DefaultReadTimeout is how long a linearizable read waits for the local
+// state to catch up when the request has no deadline.
+const DefaultReadTimeout = 5 * time.Second
+
+// Consistency is the consistency level of a read.
+type Consistency int8
+
+const (
+	// Linearizable reads are answered by the leader after confirming its
+	// leadership with a quorum and applying all committed entries.
+	Linearizable Consistency = iota
+	// LeaderLocal reads are answered from the leader's local state without
+	// confirming its leadership; they may be stale across a partition.
+	LeaderLocal
+	// Stale reads are answered from the local state of any node.
+	Stale
+)
+
+var consistencies = []string{"linearizable", "leader-local", "stale"}
+
+func (c Consistency) String() string {
+	if c < 0 || int(c) >= len(consistencies) {
+		return fmt.Sprintf("unknown(%d)", c)
+	}
+	return consistencies[c]
+}
+
+// AppliedIndex returns the index of the last log entry applied to the
+// local state.
+func (c *Context) AppliedIndex() uint64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.settled
+}
+
+// Read returns the entry for the given key in the local state, along with
+// the index it was read at.
+func (c *Context) Read(namespace string, key string) (*Entry, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.lookup(namespace, key), c.settled
+}
+
+// ReadMany returns the entries for the given keys in the local state, nil
+// for the keys that do not exist, along with the index they were all read
+// at.
+func (c *Context) ReadMany(namespace string, keys []string) ([]*Entry, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	entries := make([]*Entry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, c.lookup(namespace, key))
+	}
+	return entries, c.settled
+}
+
+// Keys returns the keys of a namespace in the local state that match the
+// given regular expression (all keys if nil), in order, along with the
+// index they were read at.
+func (c *Context) Keys(namespace string, re *regexp.Regexp) ([]string, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.keys(namespace, re), c.settled
+}
+
+// keys must be called with the lock held.
+func (c *Context) keys(namespace string, re *regexp.Regexp) []string {
+	keys := []string{}
+	c.storage.Seek(namespace, false, nil, func(k []byte, v interface{}) bool {
+		if re == nil || re.Match(k) {
+			keys = append(keys, string(k))
+		}
+		return false
+	})
+	return keys
+}
+
+// readiness records the last term in which the local state was known to
+// hold all the entries committed by the leaders of the previous terms.
+type readiness struct {
+	mtx  sync.Mutex
+	term uint64
+}
+
+// barrier makes sure that the local state can serve a read at the given
+// consistency level; for linearizable reads it records the commit index,
+// confirms the leadership with a quorum and then waits until the entries up
+// to the commit index have been applied, without writing to the log.
+func (r RPCInterface) barrier(ctx context.Context, consistency Consistency) error {
+	switch consistency {
+	case Stale:
+		return nil
+	case LeaderLocal:
+		if r.raft.State() != raft.Leader {
+			return raft.ErrNotLeader
+		}
+		return nil
+	case Linearizable:
+		stats := r.raft.Stats()
+		term, err := strconv.ParseUint(stats["term"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid raft term '%s': %w", stats["term"], err)
+		}
+		index, err := strconv.ParseUint(stats["commit_index"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid raft commit index '%s': %w", stats["commit_index"], err)
+		}
+		if err := r.ready(ctx, term); err != nil {
+			return err
+		}
+		// a deposed leader fails here, since it cannot reach a quorum
+		if err := r.raft.VerifyLeader().Error(); err != nil {
+			return err
+		}
+		return r.catchUp(ctx, index)
+	}
+	return fmt.Errorf("unsupported consistency level: %d", consistency)
+}
+
+// ready makes sure that the local state holds all the entries committed in
+// the previous terms, which a new leader only knows once the entries of its
+// own term are applied: the first linearizable read of each term waits for
+// a barrier, while those that follow do not touch the log. Entries of the
+// current term are only acknowledged once applied by the leader, so those
+// still on their way to the local state are concurrent with the read.
+func (r RPCInterface) ready(ctx context.Context, term uint64) error {
+	r.readiness.mtx.Lock()
+	defer r.readiness.mtx.Unlock()
+	if r.readiness.term >= term {
+		return nil
+	}
+	timeout, err := readTimeout(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.raft.Barrier(timeout).Error(); err != nil {
+		return fmt.Errorf("error waiting for the entries of previous terms to be applied: %w", err)
+	}
+	r.readiness.term = term
+	return nil
+}
+
+// catchUp waits until the log entries up to the given index have been applied
+// by Raft; no-ops and barriers never reach the local state, which is why the
+// applied index of Raft is used rather than that of the context.
+func (r RPCInterface) catchUp(ctx context.Context, index uint64) error {
+	timeout, err := readTimeout(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for applied := r.raft.AppliedIndex(); applied < index; applied = r.raft.AppliedIndex() {
+		select {
+		case <-deadline.C:
+			return fmt.Errorf("error waiting for index %d to be applied (applied: %d): %w", index, applied, context.DeadlineExceeded)
+		case <-ctx.Done():
+			return fmt.Errorf("error waiting for index %d to be applied (applied: %d): %w", index, applied, ctx.Err())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// readTimeout returns how long a linearizable read may wait, as told by the
+// deadline of the request, if any.
+func readTimeout(ctx context.Context) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return DefaultReadTimeout, nil
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return 0, ctx.Err()
+	}
+	return timeout, nil
+}
@@ -0,0 +1,151 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dihedron/rafter/logging"
+	"github.com/hashicorp/raft"
+)
+
+// ErrRevisionCompacted is returned when reading at a revision that is older
+// than the last compaction.
+var ErrRevisionCompacted = errors.New("requested revision has been compacted")
+
+// DefaultRetention is the default number of log entries whose revisions are
+// kept; the leader proposes the compaction of older ones.
+const DefaultRetention = 10000
+
+// Revision is the state of a key as written by the log entry at Index; a
+// deleted revision records the removal of the key.
+type Revision struct {
+	Index   uint64 `json:"index"`
+	Value   []byte `json:"value,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	Created uint64 `json:"created,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// History returns the revisions of a key that have not been compacted, the
+// oldest first, along with the compaction index and the index they were
+// read at.
+func (c *Context) History(namespace string, key string) ([]Revision, uint64, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.revisions(namespace, key), c.compacted, c.settled
+}
+
+// ReadAt returns the entry for the given key as of the given revision, along
+// with the index it was read at.
+func (c *Context) ReadAt(namespace string, key string, revision uint64) (*Entry, uint64, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if err := c.checkRevision(revision); err != nil {
+		return nil, c.settled, err
+	}
+	return at(c.revisions(namespace, key), revision), c.settled, nil
+}
+
+// revisions returns the revisions of a key; it must be called with the lock
+// held, and the returned slice must not be modified.
+func (c *Context) revisions(namespace string, key string) []Revision {
+	return c.storage.Revisions(namespace, key)
+}
+
+// checkRevision returns an error if the given revision cannot be read; it
+// must be called with the lock held.
+func (c *Context) checkRevision(revision uint64) error {
+	if revision < c.compacted {
+		return fmt.Errorf("error reading at revision %d (compacted: %d): %w", revision, c.compacted, ErrRevisionCompacted)
+	}
+	if revision > c.settled {
+		return fmt.Errorf("revision %d has not been applied yet (applied: %d)", revision, c.settled)
+	}
+	return nil
+}
+
+// record appends a revision to the history of a key; it must be called
+// with the lock held.
+func (c *Context) record(namespace string, key string, revision Revision) {
+	c.storage.Append(namespace, key, revision)
+}
+
+// compact drops the revisions that were superseded before the given index,
+// keeping the one still current at that index unless it is a deletion, so
+// that reads at any revision from index onwards are unaffected; it must be
+// called with the lock held.
+func (c *Context) compact(index uint64) {
+	c.storage.Compact(index)
+	c.compacted = index
+	c.touch(extra{kind: compactedExtra})
+}
+
+// Retained returns the index before which revisions fall outside the
+// retention window once twice as many have accumulated, so that each
+// compaction drops a whole window, and whether that is the case; the
+// leader uses it to decide whether to commit a compaction entry.
+func (c *Context) Retained() (uint64, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.retention == 0 || c.index < c.compacted+2*c.retention {
+		return 0, false
+	}
+	return c.index - c.retention, true
+}
+
+// CompactRevisions commits the compaction of the revisions older than the
+// retention window; it must only be called on the leader. Compactions go
+// through the log rather than being decided on apply, so that the state of
+// all replicas depends on the log alone and not on their own settings.
+func CompactRevisions(c *Context, r *raft.Raft, l logging.Logger) error {
+	revision, ok := c.Retained()
+	if !ok {
+		return nil
+	}
+	message := &Message{
+		Type:     Compact,
+		Revision: revision,
+	}
+	data, err := c.encode(message)
+	if err != nil {
+		l.Error("error encoding Compact message: %v", err)
+		return err
+	}
+	f := r.Apply(data, time.Second)
+	if err := f.Error(); err != nil {
+		l.Error("error applying Compact message to cluster: %v", err)
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		l.Error("received error from FSM: %v", err)
+		return err
+	}
+	return nil
+}
+
+// prune returns the number of revisions of a key, the oldest, that do not
+// survive a compaction at the given index; all of them are dropped if the
+// key was deleted before index.
+func prune(revisions []Revision, index uint64) int {
+	// the first revision still visible at index
+	i := sort.Search(len(revisions), func(i int) bool { return revisions[i].Index > index }) - 1
+	if i >= 0 && revisions[i].Deleted {
+		i++
+	}
+	if i <= 0 {
+		return 0
+	}
+	return i
+}
+
+// at returns the entry described by the last revision written at or before
+// the given index, or nil if the key did not exist at that point.
+func at(revisions []Revision, index uint64) *Entry {
+	i := sort.Search(len(revisions), func(i int) bool { return revisions[i].Index > index }) - 1
+	if i < 0 || revisions[i].Deleted {
+		return nil
+	}
+	return &Entry{Value: revisions[i].Value, Index: revisions[i].Index, Version: revisions[i].Version, Created: revisions[i].Created, Size: uint64(len(revisions[i].Value))}
+}
@@ -0,0 +1,95 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestRetentionThroughLog(t *testing.T) {
+	// replicas with different retention settings hold the same history
+	leader := NewContext(test.NewLogger(t), WithRetention(2))
+	follower := NewContext(test.NewLogger(t), WithRetention(0))
+	for index := uint64(1); index <= 4; index++ {
+		message := &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte(fmt.Sprint(index))}
+		apply(t, leader, index, message)
+		apply(t, follower, index, message)
+	}
+	if revisions, compacted, _ := leader.History(DefaultNamespace, "a"); len(revisions) != 4 || compacted != 0 {
+		t.Fatalf("expected no compaction on apply, got %d revisions compacted at %d", len(revisions), compacted)
+	}
+	revision, ok := leader.Retained()
+	if !ok || revision != 2 {
+		t.Fatalf("expected compaction to be due at 2, got %d (%t)", revision, ok)
+	}
+	if _, ok := follower.Retained(); ok {
+		t.Errorf("expected no compaction to be due without retention")
+	}
+	for _, c := range []*Context{leader, follower} {
+		apply(t, c, 5, &Message{Type: Compact, Revision: revision})
+		if revisions, compacted, _ := c.History(DefaultNamespace, "a"); len(revisions) != 3 || compacted != 2 {
+			t.Errorf("expected 3 revisions compacted at 2, got %d compacted at %d", len(revisions), compacted)
+		}
+	}
+	if _, ok := leader.Retained(); ok {
+		t.Errorf("expected no compaction to be due right after one")
+	}
+}
+
+func TestHistoryAndCompact(t *testing.T) {
+	contexts := map[string]func(t *testing.T) *Context{
+		"memory": func(t *testing.T) *Context { return NewContext(test.NewLogger(t)) },
+		"bolt": func(t *testing.T) *Context {
+			c, err := OpenContext(filepath.Join(t.TempDir(), "fsm.db"), test.NewLogger(t))
+			if err != nil {
+				t.Fatalf("error opening context: %v", err)
+			}
+			t.Cleanup(func() { c.Close() })
+			return c
+		},
+	}
+	for name, open := range contexts {
+		t.Run(name, func(t *testing.T) {
+			c := open(t)
+			apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+			apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("1")})
+			apply(t, c, 3, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("2")})
+			apply(t, c, 4, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "b"})
+			apply(t, c, 5, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("3")})
+			revisions, _, _ := c.History(DefaultNamespace, "a")
+			if len(revisions) != 3 || revisions[1].Index != 3 || revisions[1].Version != 2 || revisions[1].Created != 1 {
+				t.Fatalf("expected 3 revisions of 'a', got %+v", revisions)
+			}
+			if revisions, _, _ := c.History(DefaultNamespace, "b"); len(revisions) != 2 || !revisions[1].Deleted {
+				t.Errorf("expected 'b' to be created and deleted, got %+v", revisions)
+			}
+			for revision, expected := range map[uint64]string{1: "1", 2: "1", 3: "2", 5: "3"} {
+				if entry, _, err := c.ReadAt(DefaultNamespace, "a", revision); err != nil || string(entry.Value) != expected {
+					t.Errorf("expected '%s' at revision %d, got %+v (%v)", expected, revision, entry, err)
+				}
+			}
+			// the revisions still current at the compaction index are kept
+			apply(t, c, 6, &Message{Type: Compact, Revision: 4})
+			if revisions, compacted, _ := c.History(DefaultNamespace, "a"); len(revisions) != 2 || revisions[0].Index != 3 || compacted != 4 {
+				t.Errorf("expected revisions of 'a' from 3 compacted at 4, got %+v compacted at %d", revisions, compacted)
+			}
+			if revisions, _, _ := c.History(DefaultNamespace, "b"); len(revisions) != 0 {
+				t.Errorf("expected deleted key to be dropped, got %+v", revisions)
+			}
+			if entry, _, err := c.ReadAt(DefaultNamespace, "a", 4); err != nil || string(entry.Value) != "2" {
+				t.Errorf("expected '2' at the compaction index, got %+v (%v)", entry, err)
+			}
+			if _, _, err := c.ReadAt(DefaultNamespace, "a", 3); !errors.Is(err, ErrRevisionCompacted) {
+				t.Errorf("expected reading before the compaction to fail, got %v", err)
+			}
+			for i, revision := range []uint64{4, 3, 10} {
+				if refused(t, c, uint64(i+7), &Message{Type: Compact, Revision: revision}) == nil {
+					t.Errorf("expected compaction at %d to fail", revision)
+				}
+			}
+		})
+	}
+}
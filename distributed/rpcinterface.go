@@ -2,228 +2,1257 @@ package distributed
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/Jille/raft-grpc-leader-rpc/rafterrors"
 	proto "github.com/dihedron/rafter/distributed/proto"
 	"github.com/dihedron/rafter/logging"
 	"github.com/hashicorp/raft"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// DefaultWithdrawTimeout is how long a session that stops waiting for a lock
+// or an election has to be taken out of the queue of waiters.
+const DefaultWithdrawTimeout = 5 * time.Second
+
 type RPCInterface struct {
 	proto.UnimplementedContextServer
-	cache  *Context
-	raft   *raft.Raft
-	logger logging.Logger
+	cache     *Context
+	raft      *raft.Raft
+	readiness *readiness
+	logger    logging.Logger
 }
 
 func NewRPCInterface(c *Context, r *raft.Raft, l logging.Logger) *RPCInterface {
 	return &RPCInterface{
-		cache:  c,
-		raft:   r,
-		logger: l,
+		cache:     c,
+		raft:      r,
+		readiness: &readiness{},
+		logger:    l,
+	}
+}
+
+// apply commits a message to the cluster and returns the typed result of
+// applying it to the distributed context, along with the index of the log
+// entry; if the request was already applied, as told by the client ID and
+// sequence number in its metadata, the result and the index are those of
+// the first time.
+func (r RPCInterface) apply(ctx context.Context, message *Message) (*Message, uint64, error) {
+	identify(ctx, message)
+	r.logger.Debug("message received: %s", logging.ToJSON(message))
+	data, err := r.cache.encode(message)
+	if err != nil {
+		r.logger.Error("error encoding %s message: %v", message.Type, err)
+		return nil, 0, err
+	}
+
+	// the entry may wait to be enqueued no longer than the request lasts
+	timeout := time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining <= 0 {
+			return nil, 0, context.DeadlineExceeded
+		} else if remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	// only the errors of Raft itself, such as a change of leadership, are
+	// worth retrying: those of the FSM come again however many times the
+	// request is retried, and so do those of requests already applied
+	f := r.raft.Apply(data, timeout)
+	if err := f.Error(); err != nil {
+		r.logger.Error("error applying %s message to cluster: %v", message.Type, err)
+		return nil, 0, rafterrors.MarkRetriable(err)
 	}
+
+	switch response := f.Response().(type) {
+	case error:
+		r.logger.Error("received error from FSM: %v", response)
+		return nil, 0, response
+	case *Message:
+		return response, f.Index(), nil
+	case *outcome:
+		r.logger.Debug("request %d of client '%s' already applied at index %d", message.Sequence, message.Client, response.Index)
+		if response.Error != "" {
+			return nil, 0, errors.New(response.Error)
+		}
+		return response.Response, response.Index, nil
+	}
+	return nil, 0, fmt.Errorf("nil response")
 }
 
 func (r RPCInterface) Get(ctx context.Context, request *proto.GetRequest) (*proto.GetResponse, error) {
+	consistency := Consistency(request.Consistency)
+	namespace := namespaceOf(request.Namespace)
+	r.logger.Debug("get request received for key '%s' in namespace '%s' (consistency: %s)", request.Key, namespace, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s read of key '%s': %v", consistency, request.Key, err)
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	entry, index := r.cache.Read(namespace, request.Key)
+	if request.Revision != 0 {
+		var err error
+		if entry, index, err = r.cache.ReadAt(namespace, request.Key, request.Revision); err != nil {
+			r.logger.Error("error reading key '%s' at revision %d: %v", request.Key, request.Revision, err)
+			return nil, err
+		}
+	}
+	response := &proto.GetResponse{
+		Key:   request.Key,
+		Index: index,
+	}
+	if entry != nil {
+		response.Value = entry.Value
+		response.ModIndex = entry.Index
+		response.Metadata = metadataOf(entry)
+	}
+	return response, nil
+}
+
+func (r RPCInterface) Set(ctx context.Context, request *proto.SetRequest) (*proto.SetResponse, error) {
+	if request.Ttl < 0 {
+		return nil, fmt.Errorf("invalid time to live for key '%s': %d", request.Key, request.Ttl)
+	}
+	if request.Ttl > 0 && request.Lease != 0 {
+		return nil, fmt.Errorf("key '%s' cannot have both a time to live and a lease", request.Key)
+	}
+	if request.Lease != 0 && !r.cache.HasLease(request.Lease) {
+		return nil, fmt.Errorf("lease %d not found", request.Lease)
+	}
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if err := r.cache.Validate(namespace, request.Key, request.Value); err != nil {
+		return nil, err
+	}
 	message := &Message{
-		Type: Get,
-		Key:  request.Key,
+		Type:      Set,
+		Namespace: namespace,
+		Key:       request.Key,
+		Value:     request.Value,
+		TTL:       request.Ttl,
+		Lease:     request.Lease,
+		Time:      time.Now(),
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
 	}
+	return &proto.SetResponse{
+		Index: index,
+		Lease: result.Lease,
+	}, nil
+}
 
-	r.logger.Debug("message received: %s", logging.ToJSON(message))
-	data, err := json.Marshal(message)
+func (r RPCInterface) Remove(ctx context.Context, request *proto.RemoveRequest) (*proto.RemoveResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      Remove,
+		Namespace: namespace,
+		Key:       request.Key,
+	}
+	result, index, err := r.apply(ctx, message)
 	if err != nil {
-		r.logger.Error("error marshalling Get message to JSON: %v", err)
 		return nil, err
 	}
+	return &proto.RemoveResponse{
+		Key:      result.Key,
+		Value:    result.Value,
+		Index:    index,
+		Metadata: metadataOf(result.Entry),
+	}, nil
+}
 
-	f := r.raft.Apply(data, time.Second)
-	if err := f.Error(); err != nil {
-		r.logger.Error("error applying Get message to cluster: %v", err)
+func (r RPCInterface) List(ctx context.Context, request *proto.ListRequest) (*proto.ListResponse, error) {
+	var re *regexp.Regexp
+	if request.Filter != "" {
+		// perform sanity check on regexp before reading
+		var err error
+		if re, err = regexp.Compile(request.Filter); err != nil {
+			return nil, err
+		}
+	}
+	consistency := Consistency(request.Consistency)
+	namespace := namespaceOf(request.Namespace)
+	r.logger.Debug("list request received with filter '%s' in namespace '%s' (consistency: %s)", request.Filter, namespace, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s list: %v", consistency, err)
 		return nil, rafterrors.MarkRetriable(err)
 	}
-	if f.Response() != nil {
-		switch response := f.Response().(type) {
-		case error:
-			r.logger.Error("received error from FSM: %v", response)
-			return nil, rafterrors.MarkRetriable(response)
-		case []byte:
-			message := &Message{}
-			if err := json.Unmarshal(response, message); err != nil {
-				r.logger.Error("error unmarshalling response to Get message from cluster: %v", err)
-				return nil, rafterrors.MarkRetriable(err)
-			}
-			return &proto.GetResponse{
-				Key:   request.Key,
-				Value: message.Value,
-				Index: f.Index(),
-			}, nil
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	keys, index := r.cache.Keys(namespace, re)
+	return &proto.ListResponse{
+		Keys:  keys,
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Range(ctx context.Context, request *proto.RangeRequest) (*proto.RangeResponse, error) {
+	query := RangeQuery{
+		Prefix:    request.GetPrefix(),
+		Limit:     int(request.Limit),
+		Token:     request.Token,
+		KeysOnly:  request.KeysOnly,
+		CountOnly: request.CountOnly,
+		Revision:  request.Revision,
+	}
+	if interval := request.GetInterval(); interval != nil {
+		query.Start = interval.Start
+		query.End = interval.End
+	}
+	consistency := Consistency(request.Consistency)
+	namespace := namespaceOf(request.Namespace)
+	r.logger.Debug("range request received in namespace '%s' (consistency: %s)", namespace, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s range: %v", consistency, err)
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	result, err := r.cache.Range(namespace, query)
+	if err != nil {
+		r.logger.Error("error serving range: %v", err)
+		return nil, err
+	}
+	response := &proto.RangeResponse{
+		Count: int64(result.Count),
+		Token: result.Token,
+		Index: result.Index,
+	}
+	for _, pair := range result.Pairs {
+		response.Pairs = append(response.Pairs, &proto.KeyValue{
+			Key:      pair.Key,
+			Value:    pair.Entry.Value,
+			ModIndex: pair.Entry.Index,
+			Metadata: metadataOf(pair.Entry),
+		})
+	}
+	return response, nil
+}
+
+func (r RPCInterface) History(ctx context.Context, request *proto.HistoryRequest) (*proto.HistoryResponse, error) {
+	consistency := Consistency(request.Consistency)
+	namespace := namespaceOf(request.Namespace)
+	r.logger.Debug("history request received for key '%s' in namespace '%s' (consistency: %s)", request.Key, namespace, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s history of key '%s': %v", consistency, request.Key, err)
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	revisions, compacted, index := r.cache.History(namespace, request.Key)
+	response := &proto.HistoryResponse{
+		Compacted: compacted,
+		Index:     index,
+	}
+	for _, revision := range revisions {
+		response.Revisions = append(response.Revisions, &proto.Revision{
+			Index:   revision.Index,
+			Value:   revision.Value,
+			Version: revision.Version,
+			Deleted: revision.Deleted,
+		})
+	}
+	return response, nil
+}
+
+func (r RPCInterface) Compact(ctx context.Context, request *proto.CompactRequest) (*proto.CompactResponse, error) {
+	if request.Revision == 0 || request.Revision > r.cache.AppliedIndex() {
+		return nil, fmt.Errorf("invalid compaction revision: %d", request.Revision)
+	}
+	message := &Message{
+		Type:     Compact,
+		Revision: request.Revision,
+	}
+	_, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.CompactResponse{
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Clear(ctx context.Context, request *proto.ClearRequest) (*proto.ClearResponse, error) {
+	if request.Filter != "" {
+		// perform sanity check on regexp before sending to FSM
+		if _, err := regexp.Compile(request.Filter); err != nil {
+			return nil, err
 		}
 	}
-	return nil, rafterrors.MarkRetriable(fmt.Errorf("nil response"))
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      Clear,
+		Namespace: namespace,
+		Filter:    request.Filter,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ClearResponse{
+		Keys:  names(result.Removed),
+		Index: index,
+	}, nil
 }
 
-func (r RPCInterface) Set(ctx context.Context, request *proto.SetRequest) (*proto.SetResponse, error) {
+func (r RPCInterface) CompareAndSwap(ctx context.Context, request *proto.CompareAndSwapRequest) (*proto.CompareAndSwapResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
 	message := &Message{
-		Type:  Set,
-		Key:   request.Key,
+		Type:      CompareAndSwap,
+		Namespace: namespace,
+		Key:       request.Key,
+		Value:     request.Value,
+	}
+	switch expected := request.Expected.(type) {
+	case *proto.CompareAndSwapRequest_PrevIndex:
+		message.Condition = IfIndex
+		message.PrevIndex = expected.PrevIndex
+	case *proto.CompareAndSwapRequest_PrevValue:
+		message.Condition = IfValue
+		message.PrevValue = expected.PrevValue
+	case *proto.CompareAndSwapRequest_PrevVersion:
+		message.Condition = IfVersion
+		message.PrevVersion = expected.PrevVersion
+	default:
+		return nil, fmt.Errorf("no precondition specified for key '%s'", request.Key)
+	}
+	if err := r.cache.Validate(namespace, request.Key, request.Value); err != nil {
+		return nil, err
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.CompareAndSwapResponse{
+		Key:       result.Key,
+		Succeeded: result.Succeeded,
+		Value:     result.Value,
+		ModIndex:  result.ModIndex,
+		Index:     index,
+		Metadata:  metadataOf(result.Entry),
+	}, nil
+}
+
+func (r RPCInterface) Grant(ctx context.Context, request *proto.GrantRequest) (*proto.GrantResponse, error) {
+	if request.Ttl <= 0 {
+		return nil, fmt.Errorf("invalid time to live for lease: %d", request.Ttl)
+	}
+	message := &Message{
+		Type: Grant,
+		TTL:  request.Ttl,
+		Time: time.Now(),
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.GrantResponse{
+		Lease: result.Lease,
+		Ttl:   result.TTL,
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Revoke(ctx context.Context, request *proto.RevokeRequest) (*proto.RevokeResponse, error) {
+	if !r.cache.HasLease(request.Lease) {
+		return nil, fmt.Errorf("lease %d not found", request.Lease)
+	}
+	message := &Message{
+		Type:  Revoke,
+		Lease: request.Lease,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RevokeResponse{
+		Keys:  toKeys(result.Removed),
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) KeepAlive(ctx context.Context, request *proto.KeepAliveRequest) (*proto.KeepAliveResponse, error) {
+	if !r.cache.HasLease(request.Lease) {
+		return nil, fmt.Errorf("lease %d not found", request.Lease)
+	}
+	message := &Message{
+		Type:  KeepAlive,
+		Lease: request.Lease,
+		Time:  time.Now(),
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.KeepAliveResponse{
+		Lease: result.Lease,
+		Ttl:   result.TTL,
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Increment(ctx context.Context, request *proto.IncrementRequest) (*proto.IncrementResponse, error) {
+	if request.Min != nil && request.Max != nil && request.Min.Value > request.Max.Value {
+		return nil, fmt.Errorf("invalid bounds for key '%s': [%d, %d]", request.Key, request.Min.Value, request.Max.Value)
+	}
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      Increment,
+		Namespace: namespace,
+		Key:       request.Key,
+		Delta:     request.Delta,
+	}
+	if request.Min != nil {
+		message.Min = &request.Min.Value
+	}
+	if request.Max != nil {
+		message.Max = &request.Max.Value
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.IncrementResponse{
+		Succeeded: result.Succeeded,
+		Value:     result.Number,
+		Index:     index,
+	}, nil
+}
+
+func (r RPCInterface) Allocate(ctx context.Context, request *proto.AllocateRequest) (*proto.AllocateResponse, error) {
+	if request.Count <= 0 {
+		return nil, fmt.Errorf("invalid block size for sequence '%s': %d", request.Key, request.Count)
+	}
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      Allocate,
+		Namespace: namespace,
+		Key:       request.Key,
+		Delta:     request.Count,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.AllocateResponse{
+		First: result.Number,
+		Last:  result.Number + result.Delta - 1,
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Enqueue(ctx context.Context, request *proto.EnqueueRequest) (*proto.EnqueueResponse, error) {
+	message := &Message{
+		Type:  Enqueue,
+		Key:   request.Queue,
 		Value: request.Value,
 	}
-	r.logger.Debug("message received: %s", logging.ToJSON(message))
-	data, err := json.Marshal(message)
+	result, index, err := r.apply(ctx, message)
 	if err != nil {
-		r.logger.Error("error marshalling Set message to JSON: %v", err)
 		return nil, err
 	}
+	return &proto.EnqueueResponse{
+		Item:  result.Item,
+		Index: index,
+	}, nil
+}
 
-	f := r.raft.Apply(data, time.Second)
-	if err := f.Error(); err != nil {
-		r.logger.Error("error applying Set message to cluster: %v", err)
+func (r RPCInterface) Dequeue(ctx context.Context, request *proto.DequeueRequest) (*proto.DequeueResponse, error) {
+	if request.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid visibility timeout for queue '%s': %d", request.Queue, request.Timeout)
+	}
+	message := &Message{
+		Type: Dequeue,
+		Key:  request.Queue,
+		TTL:  request.Timeout,
+		Time: time.Now(),
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DequeueResponse{
+		Found:      result.Succeeded,
+		Item:       result.Item,
+		Value:      result.Value,
+		Deliveries: result.Number,
+		Index:      index,
+	}, nil
+}
+
+func (r RPCInterface) Ack(ctx context.Context, request *proto.SettleRequest) (*proto.SettleResponse, error) {
+	return r.settle(ctx, Ack, request)
+}
+
+func (r RPCInterface) Nack(ctx context.Context, request *proto.SettleRequest) (*proto.SettleResponse, error) {
+	return r.settle(ctx, Nack, request)
+}
+
+func (r RPCInterface) settle(ctx context.Context, t Type, request *proto.SettleRequest) (*proto.SettleResponse, error) {
+	message := &Message{
+		Type: t,
+		Key:  request.Queue,
+		Item: request.Item,
+	}
+	_, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.SettleResponse{
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Peek(ctx context.Context, request *proto.PeekRequest) (*proto.PeekResponse, error) {
+	consistency := Consistency(request.Consistency)
+	r.logger.Debug("peek request received for queue '%s' (consistency: %s)", request.Queue, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s peek of queue '%s': %v", consistency, request.Queue, err)
 		return nil, rafterrors.MarkRetriable(err)
 	}
-	if f.Response() != nil {
-		switch response := f.Response().(type) {
-		case error:
-			r.logger.Error("received error from FSM: %v", response)
-			return nil, rafterrors.MarkRetriable(response)
-		case []byte:
-			message := &Message{}
-			if err := json.Unmarshal(response, message); err != nil {
-				r.logger.Error("error unmarshalling response to Set message from cluster: %v", err)
-				return nil, rafterrors.MarkRetriable(err)
-			}
-			return &proto.SetResponse{
-				Index: f.Index(),
-			}, nil
-		}
+	item, length, inflight, index := r.cache.Peek(request.Queue)
+	response := &proto.PeekResponse{
+		Length:   int64(length),
+		InFlight: int64(inflight),
+		Index:    index,
+	}
+	if item != nil {
+		response.Found = true
+		response.Item = item.ID
+		response.Value = item.Value
+	}
+	return response, nil
+}
+
+func (r RPCInterface) Lock(ctx context.Context, request *proto.LockRequest) (*proto.LockResponse, error) {
+	if !r.cache.HasLease(request.Session) {
+		return nil, fmt.Errorf("session %d not found", request.Session)
+	}
+	message := &Message{
+		Type:  Acquire,
+		Key:   request.Name,
+		Lease: request.Session,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	if result.Succeeded {
+		return &proto.LockResponse{
+			Token: result.Token,
+			Index: index,
+		}, nil
 	}
+	r.logger.Debug("session %d waiting for lock '%s' held by session %d", request.Session, request.Name, result.Lease)
+	token, err := r.cache.Await(ctx, request.Name, request.Session)
+	if err != nil {
+		r.logger.Error("error waiting for lock '%s': %v", request.Name, err)
+		// stop waiting, or give the lock up if it was acquired meanwhile
+		message.Type = Release
+		r.withdraw(message)
+		return nil, err
+	}
+	return &proto.LockResponse{
+		Token: token,
+		Index: r.cache.AppliedIndex(),
+	}, nil
+}
 
-	return nil, rafterrors.MarkRetriable(fmt.Errorf("nil response"))
+// withdraw applies the message that takes a session out of a wait its client
+// gave up on; the context of the request is likely over, so the message gets
+// one of its own. Should it fail, the session keeps waiting until it is
+// released or its lease expires.
+func (r RPCInterface) withdraw(message *Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultWithdrawTimeout)
+	defer cancel()
+	if _, _, err := r.apply(ctx, message); err != nil {
+		r.logger.Warn("error withdrawing session %d from '%s': %v", message.Lease, message.Key, err)
+	}
 }
 
-func (r RPCInterface) Remove(ctx context.Context, request *proto.RemoveRequest) (*proto.RemoveResponse, error) {
+func (r RPCInterface) TryLock(ctx context.Context, request *proto.LockRequest) (*proto.TryLockResponse, error) {
+	if !r.cache.HasLease(request.Session) {
+		return nil, fmt.Errorf("session %d not found", request.Session)
+	}
 	message := &Message{
-		Type: Remove,
-		Key:  request.Key,
+		Type:  TryAcquire,
+		Key:   request.Name,
+		Lease: request.Session,
 	}
-	r.logger.Debug("message received: %s", logging.ToJSON(message))
-	data, err := json.Marshal(message)
+	result, index, err := r.apply(ctx, message)
 	if err != nil {
-		r.logger.Error("error marshalling Remove message to JSON: %v", err)
 		return nil, err
 	}
+	return &proto.TryLockResponse{
+		Acquired: result.Succeeded,
+		Token:    result.Token,
+		Holder:   result.Lease,
+		Index:    index,
+	}, nil
+}
 
-	f := r.raft.Apply(data, time.Second)
-	if err := f.Error(); err != nil {
-		r.logger.Error("error applying Set message to cluster: %v", err)
+func (r RPCInterface) Unlock(ctx context.Context, request *proto.UnlockRequest) (*proto.UnlockResponse, error) {
+	message := &Message{
+		Type:  Release,
+		Key:   request.Name,
+		Lease: request.Session,
+	}
+	_, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.UnlockResponse{
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Campaign(ctx context.Context, request *proto.CampaignRequest) (*proto.CampaignResponse, error) {
+	if !r.cache.HasLease(request.Session) {
+		return nil, fmt.Errorf("session %d not found", request.Session)
+	}
+	message := &Message{
+		Type:  Campaign,
+		Key:   request.Name,
+		Value: request.Value,
+		Lease: request.Session,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	if result.Succeeded {
+		return &proto.CampaignResponse{
+			Term:  result.Token,
+			Index: index,
+		}, nil
+	}
+	r.logger.Debug("session %d campaigning in election '%s' led by session %d", request.Session, request.Name, result.Lease)
+	term, err := r.cache.Elect(ctx, request.Name, request.Session)
+	if err != nil {
+		r.logger.Error("error campaigning in election '%s': %v", request.Name, err)
+		// withdraw, or step down if elected meanwhile
+		message.Type = Resign
+		r.withdraw(message)
+		return nil, err
+	}
+	return &proto.CampaignResponse{
+		Term:  term,
+		Index: r.cache.AppliedIndex(),
+	}, nil
+}
+
+func (r RPCInterface) Resign(ctx context.Context, request *proto.ResignRequest) (*proto.ResignResponse, error) {
+	message := &Message{
+		Type:  Resign,
+		Key:   request.Name,
+		Lease: request.Session,
+	}
+	_, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ResignResponse{
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) Leader(ctx context.Context, request *proto.LeaderRequest) (*proto.LeaderResponse, error) {
+	consistency := Consistency(request.Consistency)
+	r.logger.Debug("leader request received for election '%s' (consistency: %s)", request.Name, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s read of election '%s': %v", consistency, request.Name, err)
 		return nil, rafterrors.MarkRetriable(err)
 	}
+	leader, term, index := r.cache.Leader(request.Name)
+	return &proto.LeaderResponse{
+		Name:    request.Name,
+		Session: leader.Session,
+		Value:   leader.Value,
+		Term:    term,
+		Index:   index,
+	}, nil
+}
 
-	if f.Response() != nil {
-		switch response := f.Response().(type) {
-		case error:
-			r.logger.Error("received error from FSM: %v", response)
-			return nil, rafterrors.MarkRetriable(response)
-		case []byte:
-			message := &Message{}
-			if err := json.Unmarshal(response, message); err != nil {
-				r.logger.Error("error unmarshalling response to Remove message from cluster: %v", err)
-				return nil, rafterrors.MarkRetriable(err)
-			}
-			return &proto.RemoveResponse{
-				Key:   message.Key,
-				Value: message.Value,
-				Index: f.Index(),
-			}, nil
+func (r RPCInterface) Observe(request *proto.ObserveRequest, stream proto.Context_ObserveServer) error {
+	r.logger.Debug("observe request received for election '%s'", request.Name)
+	leader, term, index := r.cache.Leader(request.Name)
+	for {
+		err := stream.Send(&proto.LeaderResponse{
+			Name:    request.Name,
+			Session: leader.Session,
+			Value:   leader.Value,
+			Term:    term,
+			Index:   index,
+		})
+		if err != nil {
+			r.logger.Error("error sending leader of election '%s': %v", request.Name, err)
+			return err
+		}
+		if leader, term, err = r.cache.Observe(stream.Context(), request.Name, leader, term); err != nil {
+			r.logger.Debug("observer of election '%s' gone: %v", request.Name, err)
+			return nil
+		}
+		index = r.cache.AppliedIndex()
+	}
+}
+
+func (r RPCInterface) Watch(request *proto.WatchRequest, stream proto.Context_WatchServer) error {
+	match := func(key string) bool { return true }
+	switch selector := request.Selector.(type) {
+	case *proto.WatchRequest_Key:
+		match = func(key string) bool { return key == selector.Key }
+	case *proto.WatchRequest_Prefix:
+		match = func(key string) bool { return strings.HasPrefix(key, selector.Prefix) }
+	case *proto.WatchRequest_Regex:
+		re, err := regexp.Compile(selector.Regex)
+		if err != nil {
+			return err
+		}
+		match = re.MatchString
+	}
+
+	namespace := namespaceOf(request.Namespace)
+	subscription, backlog, err := r.cache.Watch(request.StartIndex)
+	if err != nil {
+		r.logger.Error("error watching from index %d: %v", request.StartIndex, err)
+		if errors.Is(err, ErrCompacted) {
+			return status.Errorf(codes.OutOfRange, "%v: %d", err, request.StartIndex)
 		}
+		return err
 	}
+	defer subscription.Cancel()
 
-	return nil, rafterrors.MarkRetriable(fmt.Errorf("nil response"))
+	last := request.StartIndex
+	send := func(event Event) error {
+		last = event.Index
+		if event.Namespace != namespace || !match(event.Key) {
+			return nil
+		}
+		return stream.Send(&proto.WatchResponse{
+			Index:     event.Index,
+			Type:      proto.EventType(event.Type),
+			Namespace: event.Namespace,
+			Key:       event.Key,
+			Value:     event.Value,
+		})
+	}
+	for _, event := range backlog {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				r.logger.Warn("watcher lagging behind at index %d, dropped", last)
+				// the start index is inclusive, so that the events at the
+				// last index that were not sent yet are not lost
+				return status.Errorf(codes.ResourceExhausted, "watcher lagging behind, resume from index %d", last)
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
 }
 
-func (r RPCInterface) List(ctx context.Context, request *proto.ListRequest) (*proto.ListResponse, error) {
-	if request.Filter != "" {
-		// perform sanity check on regexp before sending to FSM
-		if _, err := regexp.Compile(request.Filter); err != nil {
+func (r RPCInterface) Txn(ctx context.Context, request *proto.TxnRequest) (*proto.TxnResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      Txn,
+		Namespace: namespace,
+	}
+	for _, compare := range request.Compare {
+		if _, ok := proto.CompareTarget_name[int32(compare.Target)]; !ok {
+			return nil, fmt.Errorf("invalid comparison target for key '%s': %d", compare.Key, compare.Target)
+		}
+		if _, ok := proto.CompareOperator_name[int32(compare.Operator)]; !ok {
+			return nil, fmt.Errorf("invalid comparison operator for key '%s': %d", compare.Key, compare.Operator)
+		}
+		message.Comparisons = append(message.Comparisons, Comparison{
+			Key:      compare.Key,
+			Target:   Target(compare.Target),
+			Operator: Operator(compare.Operator),
+			Value:    compare.Value,
+			Number:   compare.Number,
+			Exists:   compare.Exists,
+		})
+	}
+	var err error
+	if message.Success, err = toOperations(request.Success); err != nil {
+		return nil, err
+	}
+	if message.Failure, err = toOperations(request.Failure); err != nil {
+		return nil, err
+	}
+	// either branch may be chosen, so both must be valid
+	for _, operation := range append(append([]Operation{}, message.Success...), message.Failure...) {
+		if operation.Type != Set {
+			continue
+		}
+		if err := r.cache.Validate(namespace, operation.Key, operation.Value); err != nil {
 			return nil, err
 		}
 	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*proto.OperationResult, 0, len(result.Results))
+	for _, r := range result.Results {
+		results = append(results, &proto.OperationResult{
+			Type:     operationTypes[r.Type],
+			Key:      r.Key,
+			Value:    r.Value,
+			ModIndex: r.ModIndex,
+			Metadata: metadataOf(r.Entry),
+		})
+	}
+	return &proto.TxnResponse{
+		Succeeded: result.Succeeded,
+		Results:   results,
+		Index:     index,
+	}, nil
+}
+
+func (r RPCInterface) CreateNamespace(ctx context.Context, request *proto.CreateNamespaceRequest) (*proto.CreateNamespaceResponse, error) {
+	if request.Namespace == "" {
+		return nil, fmt.Errorf("no namespace specified")
+	}
+	if r.cache.HasNamespace(request.Namespace) {
+		return nil, fmt.Errorf("namespace '%s' already exists", request.Namespace)
+	}
 	message := &Message{
-		Type:   List,
-		Filter: request.Filter,
+		Type:      CreateNamespace,
+		Namespace: request.Namespace,
 	}
-	r.logger.Debug("message received: %s", logging.ToJSON(message))
-	data, err := json.Marshal(message)
+	_, index, err := r.apply(ctx, message)
 	if err != nil {
-		r.logger.Error("error marshalling List message to JSON: %v", err)
 		return nil, err
 	}
+	return &proto.CreateNamespaceResponse{
+		Index: index,
+	}, nil
+}
 
-	f := r.raft.Apply(data, time.Second)
-	if err := f.Error(); err != nil {
-		r.logger.Error("error applying List message to cluster: %v", err)
+func (r RPCInterface) DropNamespace(ctx context.Context, request *proto.DropNamespaceRequest) (*proto.DropNamespaceResponse, error) {
+	if request.Namespace == "" || request.Namespace == DefaultNamespace {
+		return nil, fmt.Errorf("namespace '%s' cannot be dropped", DefaultNamespace)
+	}
+	if err := r.cache.checkNamespace(request.Namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      DropNamespace,
+		Namespace: request.Namespace,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DropNamespaceResponse{
+		Keys:  names(result.Removed),
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) ListNamespaces(ctx context.Context, request *proto.ListNamespacesRequest) (*proto.ListNamespacesResponse, error) {
+	consistency := Consistency(request.Consistency)
+	r.logger.Debug("list namespaces request received (consistency: %s)", consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s list of namespaces: %v", consistency, err)
 		return nil, rafterrors.MarkRetriable(err)
 	}
+	namespaces, index := r.cache.Namespaces()
+	return &proto.ListNamespacesResponse{
+		Namespaces: namespaces,
+		Index:      index,
+	}, nil
+}
 
-	if f.Response() != nil {
-		switch response := f.Response().(type) {
-		case error:
-			r.logger.Error("received error from FSM: %v", response)
-			return nil, rafterrors.MarkRetriable(response)
-		case []byte:
-			message := &Message{}
-			if err := json.Unmarshal(response, message); err != nil {
-				r.logger.Error("error unmarshalling response to List message from cluster: %v", err)
-				return nil, rafterrors.MarkRetriable(err)
-			}
-			return &proto.ListResponse{
-				Keys:  message.Keys,
-				Index: f.Index(),
-			}, nil
+func (r RPCInterface) SetSchema(ctx context.Context, request *proto.SetSchemaRequest) (*proto.SetSchemaResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if _, err := CompileSchema([]byte(request.Schema)); err != nil {
+		return nil, fmt.Errorf("error registering schema of prefix '%s': %w", request.Prefix, err)
+	}
+	message := &Message{
+		Type:      SetSchema,
+		Namespace: namespace,
+		Key:       request.Prefix,
+		Value:     []byte(request.Schema),
+	}
+	_, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.SetSchemaResponse{
+		Index: index,
+	}, nil
+}
+
+func (r RPCInterface) DropSchema(ctx context.Context, request *proto.DropSchemaRequest) (*proto.DropSchemaResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:      DropSchema,
+		Namespace: namespace,
+		Key:       request.Prefix,
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DropSchemaResponse{
+		Dropped: result.Succeeded,
+		Index:   index,
+	}, nil
+}
+
+func (r RPCInterface) ListSchemas(ctx context.Context, request *proto.ListSchemasRequest) (*proto.ListSchemasResponse, error) {
+	consistency := Consistency(request.Consistency)
+	namespace := namespaceOf(request.Namespace)
+	r.logger.Debug("list schemas request received (namespace: %s, consistency: %s)", namespace, consistency)
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s list of schemas: %v", consistency, err)
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	schemas, index := r.cache.Schemas(namespace)
+	response := &proto.ListSchemasResponse{
+		Schemas: make([]*proto.Schema, 0, len(schemas)),
+		Index:   index,
+	}
+	for _, schema := range schemas {
+		response.Schemas = append(response.Schemas, &proto.Schema{
+			Prefix: schema.Prefix,
+			Schema: string(schema.Source),
+			Index:  schema.Index,
+		})
+	}
+	return response, nil
+}
+
+func (r RPCInterface) MultiGet(ctx context.Context, request *proto.MultiGetRequest) (*proto.MultiGetResponse, error) {
+	consistency := Consistency(request.Consistency)
+	namespace := namespaceOf(request.Namespace)
+	r.logger.Debug("multi-get request received for %d keys in namespace '%s' (consistency: %s)", len(request.Keys), namespace, consistency)
+	if err := r.cache.checkBatch(len(request.Keys)); err != nil {
+		return nil, err
+	}
+	if err := r.barrier(ctx, consistency); err != nil {
+		r.logger.Error("error serving %s read of %d keys: %v", consistency, len(request.Keys), err)
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	entries, index := r.cache.ReadMany(namespace, request.Keys)
+	response := &proto.MultiGetResponse{
+		Results: make([]*proto.BatchResult, 0, len(entries)),
+		Index:   index,
+	}
+	for i, entry := range entries {
+		result := &proto.BatchResult{Key: request.Keys[i]}
+		if entry != nil {
+			result.Value = entry.Value
+			result.Found = true
+			result.ModIndex = entry.Index
+			result.Metadata = metadataOf(entry)
 		}
+		response.Results = append(response.Results, result)
 	}
+	return response, nil
+}
 
-	return nil, rafterrors.MarkRetriable(fmt.Errorf("nil response"))
+func (r RPCInterface) MultiSet(ctx context.Context, request *proto.MultiSetRequest) (*proto.MultiSetResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkBatch(len(request.Items)); err != nil {
+		return nil, err
+	}
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	message := &Message{
+		Type:       Batch,
+		Namespace:  namespace,
+		Operations: make([]Operation, 0, len(request.Items)),
+	}
+	for _, item := range request.Items {
+		if err := r.cache.Validate(namespace, item.Key, item.Value); err != nil {
+			return nil, err
+		}
+		message.Operations = append(message.Operations, Operation{Type: Set, Key: item.Key, Value: item.Value})
+	}
+	result, index, err := r.apply(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.MultiSetResponse{
+		Results: toBatchResults(result.Results),
+		Index:   index,
+	}, nil
 }
 
-func (r RPCInterface) Clear(ctx context.Context, request *proto.ClearRequest) (*proto.ClearResponse, error) {
+func (r RPCInterface) MultiRemove(ctx context.Context, request *proto.MultiRemoveRequest) (*proto.MultiRemoveResponse, error) {
+	namespace := namespaceOf(request.Namespace)
+	if err := r.cache.checkBatch(len(request.Keys)); err != nil {
+		return nil, err
+	}
+	if err := r.cache.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
 	message := &Message{
-		Type:   Clear,
-		Filter: request.Filter,
+		Type:       Batch,
+		Namespace:  namespace,
+		Operations: make([]Operation, 0, len(request.Keys)),
 	}
-	r.logger.Debug("message received: %s", logging.ToJSON(message))
-	data, err := json.Marshal(message)
+	for _, key := range request.Keys {
+		message.Operations = append(message.Operations, Operation{Type: Remove, Key: key})
+	}
+	result, index, err := r.apply(ctx, message)
 	if err != nil {
-		r.logger.Error("error marshalling Clear message to JSON: %v", err)
 		return nil, err
 	}
+	return &proto.MultiRemoveResponse{
+		Results: toBatchResults(result.Results),
+		Index:   index,
+	}, nil
+}
 
-	f := r.raft.Apply(data, time.Second)
-	if err := f.Error(); err != nil {
-		r.logger.Error("error applying Clear message to cluster: %v", err)
-		return nil, rafterrors.MarkRetriable(err)
+func (r RPCInterface) Export(request *proto.ExportRequest, stream proto.Context_ExportServer) error {
+	consistency := Consistency(request.Consistency)
+	r.logger.Debug("export request received for prefix '%s' (consistency: %s)", request.Prefix, consistency)
+	if err := r.barrier(stream.Context(), consistency); err != nil {
+		r.logger.Error("error serving %s export: %v", consistency, err)
+		return rafterrors.MarkRetriable(err)
+	}
+	var namespaces []string
+	if !request.AllNamespaces {
+		namespace := namespaceOf(request.Namespace)
+		if err := r.cache.checkNamespace(namespace); err != nil {
+			return err
+		}
+		namespaces = []string{namespace}
+	}
+	// the keys are read from a single view of the storage, so that the
+	// export is consistent without holding the lock until it is over
+	err := r.cache.Export(namespaces, request.Prefix, func(index uint64, namespace string, key string, entry *Entry) error {
+		return stream.Send(&proto.ExportResponse{
+			Index:     index,
+			Namespace: namespace,
+			Key:       key,
+			Value:     entry.Value,
+			Metadata:  metadataOf(entry),
+		})
+	})
+	if err != nil {
+		r.logger.Error("error exporting keys with prefix '%s': %v", request.Prefix, err)
 	}
+	return err
+}
 
-	if f.Response() != nil {
-		switch response := f.Response().(type) {
-		case error:
-			r.logger.Error("received error from FSM: %v", response)
-			return nil, rafterrors.MarkRetriable(response)
-		case []byte:
-			message := &Message{}
-			if err := json.Unmarshal(response, message); err != nil {
-				r.logger.Error("error unmarshalling response to Clear message from cluster: %v", err)
-				return nil, rafterrors.MarkRetriable(err)
+// Import stages the keys it receives in hidden namespaces, and applies them
+// once the stream is over, so that nothing is imported unless all the keys
+// are received; they are applied in batches of at most the maximum batch
+// size, the first of which removes all the keys in replace mode, so that
+// no log entry grows with the size of the import. The staged keys are
+// dropped if the import fails, or by the leader if it is abandoned.
+func (r RPCInterface) Import(stream proto.Context_ImportServer) error {
+	var (
+		response = &proto.ImportResponse{}
+		batch    *Message
+		mode     proto.ImportMode
+		stored   uint64
+		first    = true
+	)
+	buffer := make([]byte, 8)
+	if _, err := rand.Read(buffer); err != nil {
+		return fmt.Errorf("error generating import ID: %w", err)
+	}
+	id := hex.EncodeToString(buffer)
+	r.cache.imports.begin(id)
+	defer r.cache.imports.end(id)
+	// the requests of the stream share its metadata, so they are applied
+	// without it, lest they be taken for retries of one another
+	ctx := metadata.NewIncomingContext(stream.Context(), metadata.MD{})
+	apply := func(message *Message) (*Message, uint64, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		return r.apply(ctx, message)
+	}
+	fail := func(err error) error {
+		if stored > 0 {
+			// the stream may be over, so the staged keys are dropped
+			// regardless of its context
+			if _, _, err := r.apply(context.Background(), &Message{Type: Stage, Key: id}); err != nil {
+				r.logger.Warn("error dropping keys staged for import: %v", err)
 			}
-			return &proto.ClearResponse{
-				Index: f.Index(),
-			}, nil
 		}
+		r.logger.Error("import stopped after %d keys: %v", stored, err)
+		return fmt.Errorf("import stopped after %d keys: %w", stored, err)
+	}
+	flush := func() error {
+		if batch == nil {
+			return nil
+		}
+		if _, _, err := apply(batch); err != nil {
+			return err
+		}
+		stored += uint64(len(batch.Operations))
+		batch = nil
+		return nil
 	}
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+		if first {
+			first = false
+			mode = request.Mode
+		} else if request.Mode != mode {
+			return fail(fmt.Errorf("import mode changed from %s to %s", mode, request.Mode))
+		}
+		namespace := namespaceOf(request.Namespace)
+		if staged(namespace) {
+			return fail(fmt.Errorf("namespace '%s' is reserved", namespace))
+		}
+		if batch != nil && (batch.Namespace != namespace || (r.cache.maxBatch > 0 && len(batch.Operations) >= r.cache.maxBatch)) {
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+		// values are checked early, and again when the import is applied
+		if err := r.cache.Validate(namespace, request.Key, request.Value); err != nil {
+			return fail(err)
+		}
+		if batch == nil {
+			batch = &Message{Type: Stage, Key: id, Namespace: namespace}
+		}
+		batch.Operations = append(batch.Operations, Operation{Type: Set, Key: request.Key, Value: request.Value})
+	}
+	if first {
+		// nothing to import
+		return stream.SendAndClose(response)
+	}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	replace := mode == proto.ImportMode_REPLACE
+	for done := false; !done; {
+		result, index, err := apply(&Message{Type: Import, Key: id, Replace: replace, Number: int64(r.cache.maxBatch)})
+		if err != nil {
+			return fail(err)
+		}
+		replace = false
+		done = result.Succeeded
+		response.Index = index
+		response.Imported += uint64(result.Number)
+		response.Removed += uint64(len(result.Removed))
+	}
+	r.logger.Info("%d keys imported (%d removed) at index %d", response.Imported, response.Removed, response.Index)
+	return stream.SendAndClose(response)
+}
+
+// toBatchResults converts the results of a batch into their protobuf
+// representation.
+func toBatchResults(results []*Message) []*proto.BatchResult {
+	converted := make([]*proto.BatchResult, 0, len(results))
+	for _, result := range results {
+		converted = append(converted, &proto.BatchResult{
+			Key:      result.Key,
+			Value:    result.Value,
+			Found:    result.Succeeded,
+			ModIndex: result.ModIndex,
+			Metadata: metadataOf(result.Entry),
+		})
+	}
+	return converted
+}
 
-	return nil, rafterrors.MarkRetriable(fmt.Errorf("nil response"))
+// metadataOf returns the metadata of an entry, or nil if there is none.
+func metadataOf(entry *Entry) *proto.KeyMetadata {
+	if entry == nil {
+		return nil
+	}
+	return &proto.KeyMetadata{
+		CreateIndex: entry.Created,
+		ModIndex:    entry.Index,
+		Version:     entry.Version,
+		Size:        entry.size(),
+		Lease:       entry.Lease,
+	}
+}
+
+// namespaceOf returns the namespace of a request, defaulting to the
+// default namespace if none is specified.
+func namespaceOf(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
+
+// names returns the names of the given keys.
+func names(keys []Key) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key.Name)
+	}
+	return result
+}
+
+// toKeys converts the given keys into their protobuf representation.
+func toKeys(keys []Key) []*proto.Key {
+	result := make([]*proto.Key, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &proto.Key{Namespace: key.Namespace, Name: key.Name})
+	}
+	return result
 }
@@ -0,0 +1,198 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/raft"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Schema is a JSON Schema that the values of the keys with a prefix in a
+// namespace must satisfy, along with the index of the log entry that
+// registered it; values are checked when they are set, and a key must
+// satisfy the schemas of all the prefixes it has.
+type Schema struct {
+	Namespace string          `json:"namespace"`
+	Prefix    string          `json:"prefix"`
+	Source    json.RawMessage `json:"schema"`
+	Index     uint64          `json:"index"`
+	compiled  *jsonschema.Schema
+}
+
+// CompileSchema checks that a JSON Schema is valid, and compiles it; schemas
+// cannot refer to remote documents and formats are not asserted, so that
+// all nodes get the same result.
+func CompileSchema(source []byte) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("schemas cannot refer to '%s': only local references are allowed", url)
+	}
+	if err := compiler.AddResource("rafter:///schema.json", bytes.NewReader(source)); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	schema, err := compiler.Compile("rafter:///schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return schema, nil
+}
+
+// Schemas returns the schemas registered in a namespace by prefix, in
+// order, along with the index they were read at.
+func (c *Context) Schemas(namespace string) ([]*Schema, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	schemas := []*Schema{}
+	for _, prefix := range c.prefixes(namespace) {
+		schemas = append(schemas, c.schemas[namespace][prefix])
+	}
+	return schemas, c.settled
+}
+
+// Validate checks a value against the schemas of the prefixes of a key,
+// before it is submitted to the log.
+func (c *Context) Validate(namespace string, key string, value []byte) error {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.validate(namespace, key, value)
+}
+
+// prefixes returns the prefixes with a schema in a namespace, in order; it
+// must be called with the lock held.
+func (c *Context) prefixes(namespace string) []string {
+	prefixes := make([]string, 0, len(c.schemas[namespace]))
+	for prefix := range c.schemas[namespace] {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// validate checks a value against the schemas of the prefixes of a key, in
+// order; it must be called with the lock held.
+func (c *Context) validate(namespace string, key string, value []byte) error {
+	var (
+		document interface{}
+		parsed   bool
+	)
+	for _, prefix := range c.prefixes(namespace) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if !parsed {
+			decoder := json.NewDecoder(bytes.NewReader(value))
+			decoder.UseNumber()
+			err := decoder.Decode(&document)
+			if err == nil && decoder.More() {
+				err = fmt.Errorf("unexpected data after the JSON value")
+			}
+			if err != nil {
+				return fmt.Errorf("value of key '%s' is not valid JSON, as required by the schema of prefix '%s': %v", key, prefix, err)
+			}
+			parsed = true
+		}
+		if err := c.schemas[namespace][prefix].compiled.Validate(document); err != nil {
+			return fmt.Errorf("value of key '%s' does not match the schema of prefix '%s': %s", key, prefix, violations(err))
+		}
+	}
+	return nil
+}
+
+// violations describes the innermost causes of a validation error.
+func violations(err error) string {
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err.Error()
+	}
+	causes := []string{}
+	var walk func(ve *jsonschema.ValidationError)
+	walk = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			causes = append(causes, fmt.Sprintf("at '%s': %s", ve.InstanceLocation, ve.Message))
+		}
+		for _, cause := range ve.Causes {
+			walk(cause)
+		}
+	}
+	walk(ve)
+	return strings.Join(causes, "; ")
+}
+
+// applySetSchema registers the schema of a prefix, replacing the previous
+// one if any; keys already stored are not checked.
+func (c *Context) applySetSchema(l *raft.Log, message *Message) (interface{}, error) {
+	compiled, err := CompileSchema(message.Value)
+	if err != nil {
+		c.logger.Error("error registering schema of prefix '%s': %v", message.Key, err)
+		return nil, err
+	}
+	c.mtx.Lock()
+	if _, ok := c.schemas[message.Namespace]; !ok {
+		c.schemas[message.Namespace] = map[string]*Schema{}
+	}
+	c.schemas[message.Namespace][message.Key] = &Schema{
+		Namespace: message.Namespace,
+		Prefix:    message.Key,
+		Source:    json.RawMessage(message.Value),
+		Index:     l.Index,
+		compiled:  compiled,
+	}
+	c.touch(extra{kind: schemaExtra, name: message.Namespace, key: message.Key})
+	c.mtx.Unlock()
+	return &Message{
+		Key:   message.Key,
+		Index: l.Index,
+	}, nil
+}
+
+// applyDropSchema removes the schema of a prefix.
+func (c *Context) applyDropSchema(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	_, ok := c.schemas[message.Namespace][message.Key]
+	delete(c.schemas[message.Namespace], message.Key)
+	c.touch(extra{kind: schemaExtra, name: message.Namespace, key: message.Key})
+	if len(c.schemas[message.Namespace]) == 0 {
+		delete(c.schemas, message.Namespace)
+	}
+	c.mtx.Unlock()
+	return &Message{
+		Key:       message.Key,
+		Succeeded: ok,
+		Index:     l.Index,
+	}, nil
+}
+
+// snapshotSchemas returns the schemas of all namespaces, which are never
+// modified once registered; it must be called with the lock held.
+func (c *Context) snapshotSchemas() []*Schema {
+	schemas := []*Schema{}
+	for _, namespace := range c.schemas {
+		for _, schema := range namespace {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+// restoreSchemas compiles the schemas of a snapshot.
+func restoreSchemas(schemas []*Schema) (map[string]map[string]*Schema, error) {
+	restored := map[string]map[string]*Schema{}
+	for _, schema := range schemas {
+		compiled, err := CompileSchema(schema.Source)
+		if err != nil {
+			return nil, fmt.Errorf("error restoring schema of prefix '%s' in namespace '%s': %w", schema.Prefix, schema.Namespace, err)
+		}
+		schema.compiled = compiled
+		if _, ok := restored[schema.Namespace]; !ok {
+			restored[schema.Namespace] = map[string]*Schema{}
+		}
+		restored[schema.Namespace][schema.Prefix] = schema
+	}
+	return restored, nil
+}
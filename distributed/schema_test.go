@@ -0,0 +1,81 @@
+package distributed
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestSchemaValidation(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: CreateNamespace, Namespace: "ns"})
+	apply(t, c, 2, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "user/", Value: []byte(`{"type":"object","required":["name"]}`)})
+	apply(t, c, 3, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "user/admin/", Value: []byte(`{"properties":{"level":{"type":"integer"}}}`)})
+	tests := []struct {
+		name      string
+		namespace string
+		key       string
+		value     string
+		err       string
+	}{
+		{"valid", DefaultNamespace, "user/1", `{"name":"a"}`, ""},
+		{"missing property", DefaultNamespace, "user/1", `{}`, "does not match the schema of prefix 'user/'"},
+		{"not JSON", DefaultNamespace, "user/1", `name`, "not valid JSON"},
+		{"trailing data", DefaultNamespace, "user/1", `{"name":"a"} {}`, "not valid JSON"},
+		// keys must satisfy the schemas of all their prefixes
+		{"nested valid", DefaultNamespace, "user/admin/1", `{"name":"a","level":1}`, ""},
+		{"nested violation", DefaultNamespace, "user/admin/1", `{"name":"a","level":1.5}`, "schema of prefix 'user/admin/'"},
+		{"outer violation", DefaultNamespace, "user/admin/1", `{"level":1}`, "schema of prefix 'user/'"},
+		{"no prefix", DefaultNamespace, "other", `name`, ""},
+		{"other namespace", "ns", "user/1", `name`, ""},
+	}
+	for i, test := range tests {
+		message := &Message{Type: Set, Namespace: test.namespace, Key: test.key, Value: []byte(test.value)}
+		err := c.Validate(test.namespace, test.key, []byte(test.value))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			apply(t, c, uint64(i+4), message)
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+		// values are checked again when they are applied
+		if refused(t, c, uint64(i+4), message) == nil {
+			t.Errorf("%s: expected the value to be refused when applied", test.name)
+		}
+	}
+}
+
+func TestSchemaLifecycle(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	for i, source := range []string{`{"type":`, `{"$ref":"https://example.com/schema.json"}`} {
+		if refused(t, c, uint64(i+1), &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "a", Value: []byte(source)}) == nil {
+			t.Errorf("expected schema %s to be refused", source)
+		}
+	}
+	apply(t, c, 3, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "a", Value: []byte(`{"type":"string"}`)})
+	// schemas travel with snapshots
+	other := NewContext(test.NewLogger(t))
+	if err := other.Restore(io.NopCloser(bytes.NewReader(persist(t, c)))); err != nil {
+		t.Fatalf("error restoring snapshot: %v", err)
+	}
+	if schemas, _ := other.Schemas(DefaultNamespace); len(schemas) != 1 || schemas[0].Prefix != "a" || schemas[0].Index != 3 {
+		t.Errorf("expected schema of prefix 'a' to be restored, got %+v", schemas)
+	}
+	if other.Validate(DefaultNamespace, "a", []byte("1")) == nil {
+		t.Errorf("expected restored schema to be enforced")
+	}
+	if result := apply(t, c, 4, &Message{Type: DropSchema, Namespace: DefaultNamespace, Key: "a"}); !result.Succeeded {
+		t.Errorf("expected schema to be dropped")
+	}
+	if result := apply(t, c, 5, &Message{Type: DropSchema, Namespace: DefaultNamespace, Key: "a"}); result.Succeeded {
+		t.Errorf("expected dropping a missing schema to report it")
+	}
+	apply(t, c, 6, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+}
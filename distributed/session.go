@@ -0,0 +1,292 @@
+package distributed
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// ClientMetadata and SequenceMetadata are the keys of the gRPC metadata
+	// identifying a request, so that retries are applied only once.
+	ClientMetadata   = "rafter-client-id"
+	SequenceMetadata = "rafter-sequence"
+)
+
+const (
+	// SessionWindow is the number of results kept for each client; requests
+	// older than that cannot be told apart from new ones, and are refused.
+	SessionWindow = 128
+	// MaxSessions is the number of clients whose results are kept; when it
+	// is exceeded, the client that was seen least recently is forgotten.
+	MaxSessions = 10000
+	// SessionTTL is how long the results of a client are kept after it was
+	// last seen.
+	SessionTTL = 24 * time.Hour
+)
+
+// Session numbers the requests of a client, so that the cluster applies
+// them only once however many times they are retried.
+type Session struct {
+	id       string
+	sequence uint64
+}
+
+// NewSession creates a session with a random client ID.
+func NewSession() *Session {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("error generating client ID: %v", err))
+	}
+	return &Session{id: hex.EncodeToString(id)}
+}
+
+// ID returns the client ID of the session.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// UnaryClientInterceptor gives each call the client ID and the next
+// sequence number; it must come before any retry interceptor in the chain,
+// so that retries keep the same sequence number.
+func (s *Session) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		sequence := atomic.AddUint64(&s.sequence, 1)
+		ctx = metadata.AppendToOutgoingContext(ctx, ClientMetadata, s.id, SequenceMetadata, strconv.FormatUint(sequence, 10))
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// identify sets the client ID and sequence number of a message from the
+// metadata of the request, if any.
+func identify(ctx context.Context, message *Message) {
+	message.Client, message.Sequence = "", 0
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return
+	}
+	clients, sequences := md.Get(ClientMetadata), md.Get(SequenceMetadata)
+	if len(clients) == 0 || len(sequences) == 0 {
+		return
+	}
+	sequence, err := strconv.ParseUint(sequences[0], 10, 64)
+	if err != nil || sequence == 0 || clients[0] == "" {
+		return
+	}
+	message.Client, message.Sequence = clients[0], sequence
+}
+
+// session holds the results of the latest requests of a client by sequence
+// number, the highest sequence number whose result was dropped to make room,
+// the index of the last log entry the client was seen at and the time its
+// session expires, as per the clock of the leader that committed it.
+type session struct {
+	Client  string              `json:"client"`
+	Seen    uint64              `json:"seen"`
+	Expires time.Time           `json:"expires"`
+	Floor   uint64              `json:"floor,omitempty"`
+	Results map[uint64]*outcome `json:"results"`
+}
+
+// outcome is the result of applying a request, and the index it was
+// applied at.
+type outcome struct {
+	Index    uint64   `json:"index"`
+	Response *Message `json:"response,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// cached returns the response kept to answer retries: all the fields the
+// RPC layer reads, values included, so that a retry gets the same answer as
+// the first attempt, but none of the arguments of the request, which some
+// handlers echo back.
+func cached(response *Message) *Message {
+	if response == nil {
+		return nil
+	}
+	c := &Message{
+		Type:        response.Type,
+		Namespace:   response.Namespace,
+		Key:         response.Key,
+		Value:       response.Value,
+		Keys:        response.Keys,
+		Index:       response.Index,
+		PrevValue:   response.PrevValue,
+		PrevIndex:   response.PrevIndex,
+		PrevVersion: response.PrevVersion,
+		ModIndex:    response.ModIndex,
+		Succeeded:   response.Succeeded,
+		Lease:       response.Lease,
+		TTL:         response.TTL,
+		Removed:     response.Removed,
+		Revision:    response.Revision,
+		Token:       response.Token,
+		Delta:       response.Delta,
+		Number:      response.Number,
+		Item:        response.Item,
+		Entry:       response.Entry,
+	}
+	for _, result := range response.Results {
+		c.Results = append(c.Results, cached(result))
+	}
+	return c
+}
+
+// clone returns a copy of the session that is not affected by future
+// requests; outcomes are never modified, and are shared.
+func (s *session) clone() *session {
+	results := make(map[uint64]*outcome, len(s.Results))
+	for sequence, outcome := range s.Results {
+		results[sequence] = outcome
+	}
+	return &session{Client: s.Client, Seen: s.Seen, Expires: s.Expires, Floor: s.Floor, Results: results}
+}
+
+// lru holds the sessions of the clients in order of when they were last
+// seen, so that the one seen least recently is found in constant time.
+type lru struct {
+	sessions map[string]*list.Element
+	order    *list.List
+}
+
+// newLRU returns the given sessions in order of when they were last seen.
+func newLRU(sessions map[string]*session) *lru {
+	sorted := make([]*session, 0, len(sessions))
+	for _, s := range sessions {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Seen < sorted[j].Seen })
+	l := &lru{sessions: map[string]*list.Element{}, order: list.New()}
+	for _, s := range sorted {
+		l.put(s)
+	}
+	return l
+}
+
+// get returns the session of a client, if any.
+func (l *lru) get(client string) (*session, bool) {
+	if element, ok := l.sessions[client]; ok {
+		return element.Value.(*session), true
+	}
+	return nil, false
+}
+
+// put adds a session, or moves it, to the end of the list as the one seen
+// most recently.
+func (l *lru) put(s *session) {
+	if element, ok := l.sessions[s.Client]; ok {
+		l.order.MoveToBack(element)
+		return
+	}
+	l.sessions[s.Client] = l.order.PushBack(s)
+}
+
+// remove drops the session of a client.
+func (l *lru) remove(client string) {
+	if element, ok := l.sessions[client]; ok {
+		l.order.Remove(element)
+		delete(l.sessions, client)
+	}
+}
+
+// oldest returns the session seen least recently, or nil.
+func (l *lru) oldest() *session {
+	if element := l.order.Front(); element != nil {
+		return element.Value.(*session)
+	}
+	return nil
+}
+
+// replay returns the outcome of a request that was already applied; requests
+// too old to tell get an error.
+func (c *Context) replay(message *Message) (*outcome, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	s, ok := c.sessions.get(message.Client)
+	if !ok {
+		return nil, false
+	}
+	if outcome, ok := s.Results[message.Sequence]; ok {
+		return outcome, true
+	}
+	if message.Sequence <= s.Floor {
+		return &outcome{Error: fmt.Sprintf("request %d of client '%s' is too old to be deduplicated", message.Sequence, message.Client)}, true
+	}
+	return nil, false
+}
+
+// remember records the result of applying a request as the log entry l,
+// unless it is neither a message nor an error; the sessions that expired
+// as of the time the entry was appended are forgotten first.
+func (c *Context) remember(message *Message, l *raft.Log, result interface{}) {
+	o := &outcome{Index: l.Index}
+	switch result := result.(type) {
+	case *Message:
+		o.Response = cached(result)
+	case error:
+		o.Error = result.Error()
+	default:
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !l.AppendedAt.IsZero() {
+		// sessions expire in the order they were last seen, near enough
+		for s := c.sessions.oldest(); s != nil && !s.Expires.After(l.AppendedAt); s = c.sessions.oldest() {
+			c.forget(s)
+		}
+	}
+	s, ok := c.sessions.get(message.Client)
+	if !ok {
+		s = &session{Client: message.Client, Results: map[uint64]*outcome{}}
+	}
+	s.Seen = l.Index
+	if !l.AppendedAt.IsZero() {
+		s.Expires = l.AppendedAt.Add(SessionTTL)
+	}
+	c.sessions.put(s)
+	if len(c.sessions.sessions) > MaxSessions {
+		c.forget(c.sessions.oldest())
+	}
+	s.Results[message.Sequence] = o
+	if len(s.Results) > SessionWindow {
+		oldest := message.Sequence
+		for sequence := range s.Results {
+			if sequence < oldest {
+				oldest = sequence
+			}
+		}
+		delete(s.Results, oldest)
+		if oldest > s.Floor {
+			s.Floor = oldest
+		}
+	}
+	c.touch(extra{kind: sessionExtra, name: s.Client})
+}
+
+// forget drops the session of a client; it must be called with the lock
+// held.
+func (c *Context) forget(s *session) {
+	c.sessions.remove(s.Client)
+	c.touch(extra{kind: sessionExtra, name: s.Client})
+}
+
+// snapshotSessions copies the sessions for a snapshot; it must be called
+// with the lock held.
+func (c *Context) snapshotSessions() []*session {
+	sessions := make([]*session, 0, len(c.sessions.sessions))
+	for element := c.sessions.order.Front(); element != nil; element = element.Next() {
+		sessions = append(sessions, element.Value.(*session).clone())
+	}
+	return sessions
+}
@@ -0,0 +1,140 @@
+package distributed
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	test "github.com/dihedron/rafter/logging/testing"
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// request applies a message from a client as the log entry at the given
+// index, appended at the given time.
+func request(t *testing.T, c *Context, index uint64, at time.Time, client string, sequence uint64, message *Message) interface{} {
+	t.Helper()
+	message.Client, message.Sequence = client, sequence
+	data, err := c.encode(message)
+	if err != nil {
+		t.Fatalf("error encoding message: %v", err)
+	}
+	return c.Apply(&raft.Log{Index: index, Term: 1, Data: data, AppendedAt: at})
+}
+
+func TestSessionReplay(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	request(t, c, 1, now, "a", 1, &Message{Type: Enqueue, Key: "q", Value: []byte("item")})
+	first, ok := request(t, c, 2, now, "a", 2, &Message{Type: Dequeue, Key: "q", TTL: 60, Time: now}).(*Message)
+	if !ok || first.Item != 1 {
+		t.Fatalf("expected item 1 to be dequeued, got %+v", first)
+	}
+	retry, ok := request(t, c, 3, now, "a", 2, &Message{Type: Dequeue, Key: "q", TTL: 60, Time: now}).(*outcome)
+	if !ok {
+		t.Fatalf("expected retried request to be replayed")
+	}
+	if retry.Index != 2 || retry.Response.Item != 1 || string(retry.Response.Value) != "item" {
+		t.Errorf("expected first response at index 2, got %+v", retry.Response)
+	}
+}
+
+func TestSessionReplayAllocate(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	first, ok := request(t, c, 1, now, "a", 1, &Message{Type: Allocate, Namespace: DefaultNamespace, Key: "seq", Delta: 10}).(*Message)
+	if !ok {
+		t.Fatalf("expected block to be allocated, got %+v", first)
+	}
+	retry, ok := request(t, c, 2, now, "a", 1, &Message{Type: Allocate, Namespace: DefaultNamespace, Key: "seq", Delta: 10}).(*outcome)
+	if !ok {
+		t.Fatalf("expected retried allocation to be replayed")
+	}
+	if retry.Response.Number != first.Number || retry.Response.Delta != first.Delta || first.Delta != 10 {
+		t.Errorf("expected retry to get block %d+%d, got %d+%d", first.Number, first.Delta, retry.Response.Number, retry.Response.Delta)
+	}
+	// the next allocation is not affected by the retry
+	next, ok := request(t, c, 3, now, "a", 2, &Message{Type: Allocate, Namespace: DefaultNamespace, Key: "seq", Delta: 10}).(*Message)
+	if !ok || next.Number != first.Number+10 {
+		t.Errorf("expected next block to start at %d, got %+v", first.Number+10, next)
+	}
+}
+
+func TestSessionReplayRemoved(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	request(t, c, 1, now, "a", 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte("v")})
+	request(t, c, 2, now, "a", 2, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "k"})
+	retry, ok := request(t, c, 3, now, "a", 2, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "k"}).(*outcome)
+	if !ok {
+		t.Fatalf("expected retried removal to be replayed")
+	}
+	if retry.Response.Entry == nil || string(retry.Response.Entry.Value) != "v" {
+		t.Errorf("expected retry to get the removed entry, got %+v", retry.Response)
+	}
+	// errors are replayed as they are
+	request(t, c, 4, now, "a", 3, &Message{Type: DropNamespace, Namespace: "missing"})
+	failed, ok := request(t, c, 5, now, "a", 3, &Message{Type: DropNamespace, Namespace: "missing"}).(*outcome)
+	if !ok || failed.Error == "" {
+		t.Errorf("expected error to be replayed, got %+v", failed)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	now := time.Now()
+	request(t, c, 1, now, "a", 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte("1")})
+	request(t, c, 2, now.Add(time.Minute), "b", 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte("2")})
+	// the session of a is the only one to expire
+	request(t, c, 3, now.Add(SessionTTL), "c", 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte("3")})
+	if _, ok := c.sessions.get("a"); ok {
+		t.Errorf("expected session of a to expire")
+	}
+	if _, ok := c.sessions.get("b"); !ok {
+		t.Errorf("expected session of b to be kept")
+	}
+	if s := c.sessions.oldest(); s == nil || s.Client != "b" {
+		t.Errorf("expected b to be the session seen least recently, got %+v", s)
+	}
+	// once expired, a request is applied again
+	if _, ok := request(t, c, 4, now.Add(SessionTTL), "a", 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "k", Value: []byte("1")}).(*Message); !ok {
+		t.Errorf("expected request of expired session to be applied again")
+	}
+}
+
+func TestSessionInterceptor(t *testing.T) {
+	s := NewSession()
+	sequences := []string{}
+	// the last interceptor stands in for the server, which is unavailable
+	// on the first two attempts of each call
+	server := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if clients := md.Get(ClientMetadata); len(clients) != 1 || clients[0] != s.ID() {
+			t.Errorf("expected client ID '%s', got %v", s.ID(), clients)
+		}
+		sequences = append(sequences, strings.Join(md.Get(SequenceMetadata), ","))
+		if len(sequences)%3 != 0 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	}
+	conn, err := grpc.Dial("passthrough:///unused", grpc.WithInsecure(),
+		grpc.WithChainUnaryInterceptor(s.UnaryClientInterceptor(), grpc_retry.UnaryClientInterceptor(grpc_retry.WithMax(3)), server))
+	if err != nil {
+		t.Fatalf("error dialing: %v", err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		if err := conn.Invoke(context.Background(), "/rafter.Context/Set", nil, nil); err != nil {
+			t.Fatalf("expected call to succeed on retry, got %v", err)
+		}
+	}
+	if strings.Join(sequences, " ") != "1 1 1 2 2 2" {
+		t.Errorf("expected the retries of each call to keep its sequence number, got %v", sequences)
+	}
+}
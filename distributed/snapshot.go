@@ -1,17 +1,155 @@
 package distributed
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 
+	"github.com/dihedron/rafter/compression"
+	"github.com/dihedron/rafter/encryption"
+	iradix "github.com/hashicorp/go-immutable-radix"
 	"github.com/hashicorp/raft"
 )
 
+// SnapshotVersion is the version of the snapshot format: a header object
+// followed by one object per key, as newline-delimited JSON; keys are
+// grouped by namespace, and the namespace is omitted for the default one.
+// Each key carries its revisions, and deleted keys whose revisions have
+// not been compacted yet have no entry. Queue items follow the keys, one
+// object per item. The header holds the state of custom commands, the
+// deduplication sessions of the clients and the schemas of the prefixes.
+// The whole stream is compressed if the context has a codec, and then
+// encrypted if it has a keyring; the result is wrapped in an envelope,
+// whose own version is EnvelopeVersion.
+const SnapshotVersion = 10
+
+// Snapshot is a point-in-time view of the distributed context.
 type Snapshot struct {
-	data []byte
+	index     uint64
+	term      uint64
+	compacted uint64
+	view      storage
+	leases    []Lease
+	locks     []Lock
+	elections []Election
+	queues    map[string]*Queue
+	commands  map[string]json.RawMessage
+	sessions  []*session
+	schemas   []*Schema
+	keyring   *encryption.Keyring
+	codec     compression.Codec
+}
+
+// header is the first object in a snapshot stream.
+type header struct {
+	Version    int                        `json:"version"`
+	Index      uint64                     `json:"index,omitempty"`
+	Compacted  uint64                     `json:"compacted,omitempty"`
+	Namespaces []string                   `json:"namespaces,omitempty"`
+	Leases     []Lease                    `json:"leases,omitempty"`
+	Locks      []Lock                     `json:"locks,omitempty"`
+	Elections  []Election                 `json:"elections,omitempty"`
+	Commands   map[string]json.RawMessage `json:"commands,omitempty"`
+	Sessions   []*session                 `json:"sessions,omitempty"`
+	Schemas    []*Schema                  `json:"schemas,omitempty"`
+}
+
+// record is either a key, its entry and its revisions, or a queue item in
+// a snapshot stream.
+type record struct {
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key,omitempty"`
+	*Entry
+	Revisions []Revision `json:"revisions,omitempty"`
+	Queue     string     `json:"queue,omitempty"`
+	Item      *Item      `json:"item,omitempty"`
+}
+
+// state is the content of a snapshot other than its keys, which are
+// restored straight into a storage.
+type state struct {
+	index     uint64
+	compacted uint64
+	leases    map[uint64]*Lease
+	locks     map[string]*Lock
+	elections map[string]*Election
+	queues    map[string]*Queue
+	commands  map[string]json.RawMessage
+	sessions  map[string]*session
+	schemas   map[string]map[string]*Schema
+	entries   uint64
 }
 
 func (s *Snapshot) Persist(sink raft.SnapshotSink) error {
-	_, err := sink.Write(s.data)
+	names := s.view.Namespaces()
+	// snapshots are compressed before they are encrypted, since ciphertext
+	// does not compress, and enveloped last so that they can be verified
+	// without decrypting them
+	envelope, err := NewEnvelopeWriter(sink, s.index, s.term)
+	var out io.WriteCloser
+	if err == nil {
+		out, err = s.keyring.Writer(envelope)
+	}
+	var compressed io.WriteCloser
+	if err == nil {
+		compressed, err = compression.Writer(s.codec, out)
+	}
+	if err != nil {
+		sink.Cancel()
+		return fmt.Errorf("error writing snapshot to sink: %v", err)
+	}
+	w := bufio.NewWriter(compressed)
+	encoder := json.NewEncoder(w)
+	var entries uint64
+	err = encoder.Encode(&header{Version: SnapshotVersion, Index: s.index, Compacted: s.compacted, Namespaces: names, Leases: s.leases, Locks: s.locks, Elections: s.elections, Commands: s.commands, Sessions: s.sessions, Schemas: s.schemas})
+	for _, name := range names {
+		if err != nil {
+			break
+		}
+		namespace := name
+		if namespace == DefaultNamespace {
+			namespace = ""
+		}
+		// every existing key has at least its current revision
+		s.view.Seek(name, true, nil, func(k []byte, v interface{}) bool {
+			r := &record{Namespace: namespace, Key: string(k), Revisions: v.([]Revision)}
+			r.Entry = s.view.Get(name, string(k))
+			err = encoder.Encode(r)
+			entries++
+			return err != nil
+		})
+	}
+	queues := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		queues = append(queues, name)
+	}
+	sort.Strings(queues)
+	for _, name := range queues {
+		for _, items := range []*iradix.Tree{s.queues[name].ready, s.queues[name].inflight} {
+			if err != nil {
+				break
+			}
+			items.Root().Walk(func(k []byte, v interface{}) bool {
+				err = encoder.Encode(&record{Queue: name, Item: v.(*Item)})
+				entries++
+				return err != nil
+			})
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = compressed.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err == nil {
+		err = envelope.Finish(entries)
+	}
 	if err != nil {
 		sink.Cancel()
 		return fmt.Errorf("error writing snapshot to sink: %v", err)
@@ -20,4 +158,151 @@ func (s *Snapshot) Persist(sink raft.SnapshotSink) error {
 }
 
 func (s *Snapshot) Release() {
+	s.view.Close()
+}
+
+// restore reads a snapshot stream in the current format, loading its keys
+// into the given empty storage.
+func restore(r io.Reader, values storage) (*state, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	raw := json.RawMessage{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("error reading snapshot header: %w", err)
+	}
+	probe := struct {
+		Version int `json:"version"`
+	}{}
+	if json.Unmarshal(raw, &probe) != nil || probe.Version == 0 {
+		return nil, fmt.Errorf("snapshot has no header")
+	}
+	if probe.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", probe.Version)
+	}
+	h := &header{}
+	if err := json.Unmarshal(raw, h); err != nil {
+		return nil, fmt.Errorf("error unmarshalling snapshot header: %w", err)
+	}
+	leases := map[uint64]*Lease{}
+	for _, lease := range h.Leases {
+		lease := lease
+		lease.Keys = map[Key]struct{}{}
+		leases[lease.ID] = &lease
+	}
+	locks := map[string]*Lock{}
+	for _, lock := range h.Locks {
+		lock := lock
+		locks[lock.Name] = &lock
+	}
+	elections := map[string]*Election{}
+	for _, election := range h.Elections {
+		election := election
+		elections[election.Name] = &election
+	}
+	queues := map[string]*Queue{}
+	values.Create(DefaultNamespace)
+	for _, name := range h.Namespaces {
+		if !values.HasNamespace(name) {
+			values.Create(name)
+		}
+	}
+	var entries uint64
+	for n := 1; ; n++ {
+		if n%restoreBatch == 0 {
+			if err := values.Flush(); err != nil {
+				return nil, fmt.Errorf("error storing snapshot records: %w", err)
+			}
+		}
+		r := &record{}
+		if err := decoder.Decode(r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading snapshot record: %w", err)
+		}
+		entries++
+		if r.Queue != "" && r.Item != nil {
+			restock(queues, r.Queue, r.Item)
+			continue
+		}
+		if r.Namespace == "" {
+			r.Namespace = DefaultNamespace
+		}
+		if !values.HasNamespace(r.Namespace) {
+			return nil, fmt.Errorf("snapshot record for key '%s' in unknown namespace '%s'", r.Key, r.Namespace)
+		}
+		for _, revision := range r.Revisions {
+			values.Append(r.Namespace, r.Key, revision)
+		}
+		if r.Entry == nil {
+			// a deleted key with revisions
+			continue
+		}
+		values.Put(r.Namespace, r.Key, r.Entry)
+	}
+	s := &state{
+		index:     h.Index,
+		compacted: h.Compacted,
+		leases:    leases,
+		locks:     locks,
+		elections: elections,
+		queues:    queues,
+		commands:  h.Commands,
+		sessions:  map[string]*session{},
+		entries:   entries,
+	}
+	schemas, err := restoreSchemas(h.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	s.schemas = schemas
+	for _, session := range h.Sessions {
+		s.sessions[session.Client] = session
+	}
+	if s.commands == nil {
+		s.commands = map[string]json.RawMessage{}
+	}
+	return s, nil
+}
+
+// restock puts an item back into the named queue, creating it if needed,
+// among either the visible items or those in flight.
+func restock(queues map[string]*Queue, name string, item *Item) {
+	queue, ok := queues[name]
+	if !ok {
+		queue = newQueue()
+		queues[name] = queue
+	}
+	if item.Deadline.IsZero() {
+		queue.ready, _, _ = queue.ready.Insert(id(item.ID), item)
+	} else {
+		queue.inflight, _, _ = queue.inflight.Insert(id(item.ID), item)
+	}
+}
+
+// restoreBatch is the number of snapshot records after which the storage
+// being restored is flushed, so that durable storages need not hold the
+// whole snapshot in memory.
+const restoreBatch = 10000
+
+// restoreLegacy reads the snapshots taken before the format was streamed,
+// which have no envelope: a bare map of keys to values, all of which are
+// restored into the default namespace with a single revision.
+func restoreLegacy(r io.Reader, values storage) (*state, error) {
+	legacy := map[string][]byte{}
+	if err := json.NewDecoder(r).Decode(&legacy); err != nil {
+		return nil, fmt.Errorf("snapshot has no envelope, and is not in the legacy format: %w", err)
+	}
+	values.Create(DefaultNamespace)
+	for k, v := range legacy {
+		values.Put(DefaultNamespace, k, &Entry{Value: v, Size: uint64(len(v))})
+		values.Append(DefaultNamespace, k, Revision{Value: v})
+	}
+	return &state{
+		leases:    map[uint64]*Lease{},
+		locks:     map[string]*Lock{},
+		elections: map[string]*Election{},
+		queues:    map[string]*Queue{},
+		commands:  map[string]json.RawMessage{},
+		sessions:  map[string]*session{},
+		schemas:   map[string]map[string]*Schema{},
+	}, nil
 }
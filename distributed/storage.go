@@ -0,0 +1,242 @@
+package distributed
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// storage holds the values of the namespaces of a context, along with the
+// revisions of their keys; it is only accessed with the context's lock
+// held, and only modified from the FSM goroutine.
+type storage interface {
+	// Namespaces returns the names of all namespaces in order.
+	Namespaces() []string
+	HasNamespace(namespace string) bool
+	Create(namespace string)
+	Drop(namespace string)
+	// Get returns the entry for a key, or nil; Delete removes it and
+	// returns the removed entry, or nil.
+	Get(namespace string, key string) *Entry
+	Put(namespace string, key string, entry *Entry)
+	Delete(namespace string, key string) *Entry
+	// Revisions returns the revisions of a key, the oldest first; Append
+	// adds a revision, newer than all the others, to the history of a key,
+	// where each revision is stored on its own.
+	Revisions(namespace string, key string) []Revision
+	Append(namespace string, key string, revision Revision)
+	// Compact drops the revisions superseded before the given index.
+	Compact(index uint64)
+	// Seek calls fn on the keys of a namespace from the given one onwards,
+	// in order, along with either their entry or their revisions, until it
+	// returns true.
+	Seek(namespace string, history bool, from []byte, fn func(k []byte, v interface{}) bool)
+	// Extra stores a record of the state of the context other than its
+	// keys, e.g. a lease, under its kind and ID, or drops it if nil; Extras
+	// returns the records of a kind by ID. Storages that are not durable
+	// need not keep them, since the context holds them.
+	Extra(kind string, id string, value interface{})
+	Extras(kind string) (map[string]json.RawMessage, error)
+	// View returns a read-only, point-in-time copy of the storage, which
+	// must be closed when no longer needed.
+	View() (storage, error)
+	// Empty returns a new, empty storage of the same kind, e.g. to restore
+	// a snapshot into; Replace puts the given one in the place of the
+	// storage and returns it, the storage replaced being left to close.
+	Empty() (storage, error)
+	Replace(fresh storage) (storage, error)
+	// Durable tells whether the storage outlives the process; if so, Flush
+	// persists the changes made so far, and Commit persists them along with
+	// the index of the last applied log entry.
+	Durable() bool
+	Flush() error
+	Commit(index uint64) error
+	Close() error
+}
+
+// memory is the storage of a context held in memory; the values and the
+// history of each namespace are kept in immutable radix trees, so that
+// views can capture a consistent state by simply holding on to their roots.
+// The history maps each key to a tree of its revisions by index.
+type memory struct {
+	values  map[string]*iradix.Tree
+	history map[string]*iradix.Tree
+}
+
+var _ storage = &memory{}
+
+func newMemory() *memory {
+	return &memory{
+		values:  map[string]*iradix.Tree{},
+		history: map[string]*iradix.Tree{},
+	}
+}
+
+func (m *memory) Namespaces() []string {
+	names := make([]string, 0, len(m.values))
+	for name := range m.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *memory) HasNamespace(namespace string) bool {
+	_, ok := m.values[namespace]
+	return ok
+}
+
+func (m *memory) Create(namespace string) {
+	m.values[namespace] = iradix.New()
+	m.history[namespace] = iradix.New()
+}
+
+func (m *memory) Drop(namespace string) {
+	delete(m.values, namespace)
+	delete(m.history, namespace)
+}
+
+func (m *memory) Get(namespace string, key string) *Entry {
+	if values, ok := m.values[namespace]; ok {
+		if entry, ok := values.Get([]byte(key)); ok {
+			return entry.(*Entry)
+		}
+	}
+	return nil
+}
+
+func (m *memory) Put(namespace string, key string, entry *Entry) {
+	m.values[namespace], _, _ = m.values[namespace].Insert([]byte(key), entry)
+}
+
+func (m *memory) Delete(namespace string, key string) *Entry {
+	values, entry, ok := m.values[namespace].Delete([]byte(key))
+	if !ok {
+		return nil
+	}
+	m.values[namespace] = values
+	return entry.(*Entry)
+}
+
+func (m *memory) Revisions(namespace string, key string) []Revision {
+	if history, ok := m.history[namespace]; ok {
+		if revisions, ok := history.Get([]byte(key)); ok {
+			return flatten(revisions.(*iradix.Tree))
+		}
+	}
+	return nil
+}
+
+func (m *memory) Append(namespace string, key string, revision Revision) {
+	revisions := iradix.New()
+	if previous, ok := m.history[namespace].Get([]byte(key)); ok {
+		revisions = previous.(*iradix.Tree)
+	}
+	revisions, _, _ = revisions.Insert(revisionKey(revision.Index), revision)
+	m.history[namespace], _, _ = m.history[namespace].Insert([]byte(key), revisions)
+}
+
+func (m *memory) Compact(index uint64) {
+	for name, history := range m.history {
+		txn := history.Txn()
+		history.Root().Walk(func(k []byte, v interface{}) bool {
+			revisions := v.(*iradix.Tree)
+			drop := prune(flatten(revisions), index)
+			if drop == 0 {
+				return false
+			} else if drop == revisions.Len() {
+				txn.Delete(k)
+				return false
+			}
+			pruned := revisions.Txn()
+			iterator := revisions.Root().Iterator()
+			for i := 0; i < drop; i++ {
+				r, _, _ := iterator.Next()
+				pruned.Delete(r)
+			}
+			txn.Insert(k, pruned.Commit())
+			return false
+		})
+		m.history[name] = txn.Commit()
+	}
+}
+
+// flatten returns the revisions in a tree, the oldest first.
+func flatten(revisions *iradix.Tree) []Revision {
+	result := make([]Revision, 0, revisions.Len())
+	revisions.Root().Walk(func(k []byte, v interface{}) bool {
+		result = append(result, v.(Revision))
+		return false
+	})
+	return result
+}
+
+// revisionKey returns the key of a revision, which sorts revisions by index.
+func revisionKey(index uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, index)
+	return k
+}
+
+func (m *memory) Seek(namespace string, history bool, from []byte, fn func(k []byte, v interface{}) bool) {
+	tree, ok := m.values[namespace]
+	if history {
+		tree, ok = m.history[namespace]
+	}
+	if !ok {
+		return
+	}
+	iterator := tree.Root().Iterator()
+	iterator.SeekLowerBound(from)
+	for k, v, ok := iterator.Next(); ok; k, v, ok = iterator.Next() {
+		if history {
+			v = flatten(v.(*iradix.Tree))
+		}
+		if fn(k, v) {
+			return
+		}
+	}
+}
+
+func (m *memory) Extra(kind string, id string, value interface{}) {}
+
+func (m *memory) Extras(kind string) (map[string]json.RawMessage, error) {
+	return map[string]json.RawMessage{}, nil
+}
+
+// View returns a copy of the storage sharing the same trees, which are
+// immutable, so that future changes do not affect it.
+func (m *memory) View() (storage, error) {
+	view := newMemory()
+	for name, values := range m.values {
+		view.values[name] = values
+		view.history[name] = m.history[name]
+	}
+	return view, nil
+}
+
+func (m *memory) Empty() (storage, error) {
+	return newMemory(), nil
+}
+
+func (m *memory) Replace(fresh storage) (storage, error) {
+	return fresh, nil
+}
+
+func (m *memory) Durable() bool {
+	return false
+}
+
+func (m *memory) Flush() error {
+	return nil
+}
+
+func (m *memory) Commit(index uint64) error {
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
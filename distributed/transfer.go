@@ -0,0 +1,261 @@
+package distributed
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dihedron/rafter/logging"
+	"github.com/hashicorp/raft"
+)
+
+// stagingPrefix starts the names of the hidden namespaces where the keys of
+// an import are staged until it is applied; clients cannot create them.
+const stagingPrefix = "\x00import/"
+
+// staging returns the name of the namespace where the keys of an import for
+// the given namespace are staged.
+func staging(id string, namespace string) string {
+	return stagingPrefix + id + "/" + namespace
+}
+
+// staged tells whether a namespace holds the keys staged by an import.
+func staged(namespace string) bool {
+	return strings.HasPrefix(namespace, stagingPrefix)
+}
+
+// imports is the set of the imports streamed to the local node, by ID; it
+// is not replicated, since only the leader can stage keys.
+type imports struct {
+	mtx sync.Mutex
+	ids map[string]struct{}
+}
+
+// begin records an import as in progress, before any of its keys is staged.
+func (i *imports) begin(id string) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	i.ids[id] = struct{}{}
+}
+
+// end records an import as over, whether it was applied or not.
+func (i *imports) end(id string) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	delete(i.ids, id)
+}
+
+// Abandoned returns the IDs of the imports whose keys are still staged but
+// that are not in progress on the local node, e.g. because the leader that
+// was receiving them stepped down, or their stream broke before their keys
+// could be dropped; the leader uses it to decide whether to drop them.
+func (c *Context) Abandoned() []string {
+	c.mtx.RLock()
+	namespaces := c.storage.Namespaces()
+	c.mtx.RUnlock()
+	c.imports.mtx.Lock()
+	defer c.imports.mtx.Unlock()
+	ids := []string{}
+	for _, namespace := range namespaces {
+		if !staged(namespace) {
+			continue
+		}
+		id := strings.SplitN(strings.TrimPrefix(namespace, stagingPrefix), "/", 2)[0]
+		if _, ok := c.imports.ids[id]; !ok && (len(ids) == 0 || ids[len(ids)-1] != id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// DropAbandonedImports commits the removal of the keys staged by abandoned
+// imports, which would otherwise be kept, hidden, in the state and in its
+// snapshots forever; it must only be called on the leader.
+func DropAbandonedImports(c *Context, r *raft.Raft, l logging.Logger) error {
+	for _, id := range c.Abandoned() {
+		message := &Message{
+			Type: Stage,
+			Key:  id,
+		}
+		data, err := c.encode(message)
+		if err != nil {
+			l.Error("error encoding Stage message: %v", err)
+			return err
+		}
+		f := r.Apply(data, time.Second)
+		if err := f.Error(); err != nil {
+			l.Error("error applying Stage message to cluster: %v", err)
+			return err
+		}
+		if err, ok := f.Response().(error); ok {
+			l.Error("received error from FSM: %v", err)
+			return err
+		}
+		l.Info("keys staged by abandoned import %s dropped", id)
+	}
+	return nil
+}
+
+// visible returns the namespaces that are not staging an import.
+func visible(namespaces []string) []string {
+	result := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		if !staged(namespace) {
+			result = append(result, namespace)
+		}
+	}
+	return result
+}
+
+// applyStage stores keys for the import in the message's key, in a hidden
+// namespace, without revisions or events, provided that all their values
+// match the schemas of their namespace; a stage without operations drops
+// the keys staged so far, e.g. when the import is abandoned.
+func (c *Context) applyStage(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(message.Operations) == 0 {
+		prefix := staging(message.Key, "")
+		for _, namespace := range c.storage.Namespaces() {
+			if strings.HasPrefix(namespace, prefix) {
+				c.storage.Drop(namespace)
+			}
+		}
+		return &Message{Index: l.Index}, nil
+	}
+	for _, operation := range message.Operations {
+		if err := c.validate(message.Namespace, operation.Key, operation.Value); err != nil {
+			c.logger.Error("error applying stage at index %d: %v", l.Index, err)
+			return nil, err
+		}
+	}
+	namespace := staging(message.Key, message.Namespace)
+	if !c.storage.HasNamespace(namespace) {
+		c.storage.Create(namespace)
+	}
+	for _, operation := range message.Operations {
+		c.storage.Put(namespace, operation.Key, &Entry{Value: operation.Value})
+	}
+	return &Message{
+		Number: int64(len(message.Operations)),
+		Index:  l.Index,
+	}, nil
+}
+
+// applyImport moves up to as many keys staged by the import in the
+// message's key as its number, or all of them if zero, into their
+// namespaces, creating the missing ones, after removing all the keys if it
+// replaces them; large imports are thus applied in bounded batches, the
+// first of which replaces the keys. Unless all the values in the batch
+// match their schemas, nothing is changed and the staged keys are dropped.
+// The result tells whether no staged keys are left.
+func (c *Context) applyImport(l *raft.Log, message *Message) (interface{}, error) {
+	c.mtx.Lock()
+	prefix := staging(message.Key, "")
+	namespaces := []string{}
+	for _, namespace := range c.storage.Namespaces() {
+		if strings.HasPrefix(namespace, prefix) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	// the batch is read before anything is changed, along with the
+	// staging namespaces it empties
+	type stagedKey struct {
+		namespace string
+		key       string
+		value     []byte
+	}
+	batch := []stagedKey{}
+	emptied := []string{}
+	for _, namespace := range namespaces {
+		full := false
+		c.storage.Seek(namespace, false, nil, func(k []byte, v interface{}) bool {
+			if message.Number > 0 && int64(len(batch)) >= message.Number {
+				full = true
+				return true
+			}
+			batch = append(batch, stagedKey{namespace: namespace, key: string(k), value: v.(*Entry).Value})
+			return false
+		})
+		if full {
+			break
+		}
+		emptied = append(emptied, namespace)
+	}
+	for _, s := range batch {
+		if err := c.validate(strings.TrimPrefix(s.namespace, prefix), s.key, s.value); err != nil {
+			for _, namespace := range namespaces {
+				c.storage.Drop(namespace)
+			}
+			c.mtx.Unlock()
+			c.logger.Error("error applying import at index %d: %v", l.Index, err)
+			return nil, err
+		}
+	}
+	removed := []Key{}
+	if message.Replace {
+		for _, namespace := range visible(c.storage.Namespaces()) {
+			removed = append(removed, c.clear(namespace, nil)...)
+		}
+	}
+	events := deletions(l.Index, removed)
+	for _, s := range batch {
+		target := strings.TrimPrefix(s.namespace, prefix)
+		if !c.storage.HasNamespace(target) {
+			c.storage.Create(target)
+		}
+		c.put(target, s.key, s.value, l.Index)
+		c.storage.Delete(s.namespace, s.key)
+		events = append(events, Event{Index: l.Index, Type: Put, Namespace: target, Key: s.key, Value: s.value})
+	}
+	for _, namespace := range emptied {
+		c.storage.Drop(namespace)
+	}
+	c.mtx.Unlock()
+	c.hub.publish(events...)
+	return &Message{
+		Removed:   removed,
+		Number:    int64(len(batch)),
+		Succeeded: len(emptied) == len(namespaces),
+		Index:     l.Index,
+	}, nil
+}
+
+// Export calls fn with the entries of the keys that start with the prefix
+// in the given namespaces, or in all of them if nil, in order, until it
+// returns an error; all the keys are read from a single view of the storage,
+// so that the export is consistent and unaffected by compactions, and fn
+// gets the index the view was taken at.
+func (c *Context) Export(namespaces []string, prefix string, fn func(index uint64, namespace string, key string, entry *Entry) error) error {
+	c.mtx.RLock()
+	view, err := c.storage.View()
+	index := c.settled
+	c.mtx.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer view.Close()
+	if namespaces == nil {
+		namespaces = visible(view.Namespaces())
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		if !view.HasNamespace(namespace) {
+			return fmt.Errorf("namespace '%s' not found", namespace)
+		}
+		view.Seek(namespace, false, []byte(prefix), func(k []byte, v interface{}) bool {
+			if !bytes.HasPrefix(k, []byte(prefix)) {
+				return true
+			}
+			err = fn(index, namespace, string(k), v.(*Entry))
+			return err != nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
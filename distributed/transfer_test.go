@@ -0,0 +1,141 @@
+package distributed
+
+import (
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+	"github.com/hashicorp/raft"
+)
+
+// exported returns the keys and values exported from a context.
+func exported(t *testing.T, c *Context, namespaces []string) map[string]string {
+	t.Helper()
+	pairs := map[string]string{}
+	err := c.Export(namespaces, "", func(index uint64, namespace string, key string, entry *Entry) error {
+		pairs[namespace+"/"+key] = string(entry.Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error exporting keys: %v", err)
+	}
+	return pairs
+}
+
+func TestImportReplace(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "old", Value: []byte("1")})
+	apply(t, c, 2, &Message{Type: Stage, Key: "x", Namespace: DefaultNamespace, Operations: []Operation{{Type: Set, Key: "a", Value: []byte("2")}}})
+	apply(t, c, 3, &Message{Type: Stage, Key: "x", Namespace: "ns", Operations: []Operation{{Type: Set, Key: "b", Value: []byte("3")}}})
+	// staged keys are hidden until the import is applied
+	if namespaces, _ := c.Namespaces(); len(namespaces) != 1 {
+		t.Errorf("expected staging namespaces to be hidden, got %v", namespaces)
+	}
+	if pairs := exported(t, c, nil); len(pairs) != 1 || pairs["default/old"] != "1" {
+		t.Errorf("expected only the old key before the import, got %v", pairs)
+	}
+	result := apply(t, c, 4, &Message{Type: Import, Key: "x", Replace: true})
+	if result.Number != 2 || len(result.Removed) != 1 {
+		t.Errorf("expected 2 keys imported and 1 removed, got %d and %d", result.Number, len(result.Removed))
+	}
+	pairs := exported(t, c, nil)
+	if len(pairs) != 2 || pairs["default/a"] != "2" || pairs["ns/b"] != "3" {
+		t.Errorf("expected imported keys only, got %v", pairs)
+	}
+	if namespaces := c.storage.Namespaces(); len(namespaces) != 2 {
+		t.Errorf("expected staging namespaces to be dropped, got %q", namespaces)
+	}
+}
+
+func TestImportBatches(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "old", Value: []byte("1")})
+	apply(t, c, 2, &Message{Type: Stage, Key: "x", Namespace: DefaultNamespace, Operations: []Operation{{Type: Set, Key: "a", Value: []byte("2")}, {Type: Set, Key: "b", Value: []byte("3")}}})
+	apply(t, c, 3, &Message{Type: Stage, Key: "x", Namespace: "ns", Operations: []Operation{{Type: Set, Key: "c", Value: []byte("4")}}})
+	// the first batch replaces the keys, the others only add to them
+	tests := []struct {
+		message  *Message
+		imported int64
+		removed  int
+		done     bool
+		pairs    int
+	}{
+		{&Message{Type: Import, Key: "x", Replace: true, Number: 2}, 2, 1, false, 2},
+		{&Message{Type: Import, Key: "x", Number: 2}, 1, 0, true, 3},
+	}
+	for i, test := range tests {
+		result := apply(t, c, uint64(4+i), test.message)
+		if result.Number != test.imported || len(result.Removed) != test.removed || result.Succeeded != test.done {
+			t.Errorf("batch %d: expected %d imported, %d removed and done %t, got %+v", i, test.imported, test.removed, test.done, result)
+		}
+		if pairs := exported(t, c, nil); len(pairs) != test.pairs {
+			t.Errorf("batch %d: expected %d keys, got %v", i, test.pairs, pairs)
+		}
+	}
+	if namespaces := c.storage.Namespaces(); len(namespaces) != 2 {
+		t.Errorf("expected staging namespaces to be dropped, got %q", namespaces)
+	}
+}
+
+func TestImportSchemaViolation(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "old", Value: []byte(`"v"`)})
+	apply(t, c, 2, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "a", Value: []byte(`{"type":"string"}`)})
+	// values are checked when they are staged
+	data, _ := c.encode(&Message{Type: Stage, Key: "x", Namespace: DefaultNamespace, Operations: []Operation{{Type: Set, Key: "a", Value: []byte("1")}}})
+	if _, ok := c.Apply(&raft.Log{Index: 3, Term: 1, Data: data}).(error); !ok {
+		t.Fatalf("expected stage violating a schema to fail")
+	}
+	// and again when they are imported, in case the schemas changed
+	apply(t, c, 4, &Message{Type: Stage, Key: "x", Namespace: DefaultNamespace, Operations: []Operation{{Type: Set, Key: "b", Value: []byte("1")}}})
+	apply(t, c, 5, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "b", Value: []byte(`{"type":"string"}`)})
+	data, _ = c.encode(&Message{Type: Import, Key: "x", Replace: true})
+	if _, ok := c.Apply(&raft.Log{Index: 6, Term: 1, Data: data}).(error); !ok {
+		t.Fatalf("expected import violating a schema to fail")
+	}
+	if pairs := exported(t, c, nil); len(pairs) != 1 || pairs["default/old"] != `"v"` {
+		t.Errorf("expected failed import to leave keys untouched, got %v", pairs)
+	}
+	if namespaces := c.storage.Namespaces(); len(namespaces) != 1 {
+		t.Errorf("expected staging namespaces to be dropped, got %q", namespaces)
+	}
+}
+
+func TestAbandonedImports(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	for i, id := range []string{"x", "y"} {
+		c.imports.begin(id)
+		apply(t, c, uint64(2*i+1), &Message{Type: Stage, Key: id, Namespace: DefaultNamespace, Operations: []Operation{{Type: Set, Key: "a", Value: []byte("1")}}})
+		apply(t, c, uint64(2*i+2), &Message{Type: Stage, Key: id, Namespace: "ns", Operations: []Operation{{Type: Set, Key: "b", Value: []byte("2")}}})
+	}
+	if ids := c.Abandoned(); len(ids) != 0 {
+		t.Errorf("expected no abandoned imports while in progress, got %q", ids)
+	}
+	c.imports.end("x")
+	ids := c.Abandoned()
+	if len(ids) != 1 || ids[0] != "x" {
+		t.Fatalf("expected import x to be abandoned, got %q", ids)
+	}
+	apply(t, c, 5, &Message{Type: Stage, Key: "x"})
+	if namespaces := c.storage.Namespaces(); len(namespaces) != 3 {
+		t.Errorf("expected only the staging namespaces of import y to be left, got %q", namespaces)
+	}
+}
+
+func TestExportAfterCompaction(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "b", Value: []byte("2")})
+	err := c.Export(nil, "", func(index uint64, namespace string, key string, entry *Entry) error {
+		if key == "a" {
+			// neither writes nor compactions affect an export in progress
+			apply(t, c, 3, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "b"})
+			apply(t, c, 4, &Message{Type: Compact, Revision: 3})
+		} else if key != "b" || index != 2 {
+			t.Errorf("unexpected key '%s' at index %d", key, index)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error exporting keys: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package distributed
+
+import (
+	"bytes"
+)
+
+// Target is the attribute of a key checked by a comparison.
+type Target int8
+
+const (
+	TargetValue Target = iota
+	TargetVersion
+	TargetModIndex
+	TargetExists
+	TargetCreateIndex
+	TargetSize
+	TargetLease
+)
+
+// Operator is the operator of a comparison.
+type Operator int8
+
+const (
+	Equal Operator = iota
+	NotEqual
+	Greater
+	Less
+)
+
+// Comparison is a condition on a key that is checked atomically inside
+// a transaction.
+type Comparison struct {
+	Key      string   `json:"key"`
+	Target   Target   `json:"target,omitempty"`
+	Operator Operator `json:"operator,omitempty"`
+	Value    []byte   `json:"value,omitempty"`
+	Number   uint64   `json:"number,omitempty"`
+	Exists   bool     `json:"exists,omitempty"`
+}
+
+// Operation is a Get, Set or Remove executed inside a transaction.
+type Operation struct {
+	Type  Type   `json:"type"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// evaluate checks the comparison against the current state of the key;
+// it must be called with the lock held.
+func (c *Context) evaluate(namespace string, comparison Comparison) bool {
+	entry := c.lookup(namespace, comparison.Key)
+	var result int
+	switch comparison.Target {
+	case TargetValue:
+		if entry == nil {
+			return false
+		}
+		result = bytes.Compare(entry.Value, comparison.Value)
+	case TargetVersion, TargetModIndex, TargetCreateIndex, TargetSize, TargetLease:
+		// missing keys have all of them at 0
+		var actual uint64
+		if entry != nil {
+			switch comparison.Target {
+			case TargetVersion:
+				actual = entry.Version
+			case TargetModIndex:
+				actual = entry.Index
+			case TargetCreateIndex:
+				actual = entry.Created
+			case TargetSize:
+				actual = entry.size()
+			case TargetLease:
+				actual = entry.Lease
+			}
+		}
+		switch {
+		case actual < comparison.Number:
+			result = -1
+		case actual > comparison.Number:
+			result = 1
+		}
+	case TargetExists:
+		if (entry != nil) != comparison.Exists {
+			result = 1
+		}
+		return (result == 0) == (comparison.Operator == Equal)
+	default:
+		return false
+	}
+	switch comparison.Operator {
+	case Equal:
+		return result == 0
+	case NotEqual:
+		return result != 0
+	case Greater:
+		return result > 0
+	case Less:
+		return result < 0
+	}
+	return false
+}
+
+// transact evaluates all comparisons and then executes either the success
+// or the failure operations, all within the namespace of the message, unless
+// any of the values to set does not match its schema; it must be called with
+// the lock held.
+func (c *Context) transact(message *Message, index uint64) (*Message, []Event, error) {
+	succeeded := true
+	for _, comparison := range message.Comparisons {
+		if !c.evaluate(message.Namespace, comparison) {
+			succeeded = false
+			break
+		}
+	}
+	operations := message.Success
+	if !succeeded {
+		operations = message.Failure
+	}
+	if err := c.check(message.Namespace, operations); err != nil {
+		return nil, nil, err
+	}
+	results, events := c.operate(message.Namespace, operations, index)
+	return &Message{
+		Succeeded: succeeded,
+		Results:   results,
+		Index:     index,
+	}, events, nil
+}
+
+// check validates the values set by the given operations against their
+// schemas; it must be called with the lock held.
+func (c *Context) check(namespace string, operations []Operation) error {
+	for _, operation := range operations {
+		if operation.Type == Set {
+			if err := c.validate(namespace, operation.Key, operation.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// operate executes the given operations in order within a namespace, and
+// returns their results, which tell whether the key existed before, and
+// the events to publish; it must be called with the lock held.
+func (c *Context) operate(namespace string, operations []Operation, index uint64) ([]*Message, []Event) {
+	results := make([]*Message, 0, len(operations))
+	events := []Event{}
+	for _, operation := range operations {
+		r := &Message{
+			Type: operation.Type,
+			Key:  operation.Key,
+		}
+		switch operation.Type {
+		case Get:
+			if entry := c.lookup(namespace, operation.Key); entry != nil {
+				r.Value = entry.Value
+				r.ModIndex = entry.Index
+				r.Entry = entry
+				r.Succeeded = true
+			}
+		case Set:
+			r.Succeeded = c.put(namespace, operation.Key, operation.Value, index) != nil
+			r.ModIndex = index
+			r.Entry = c.lookup(namespace, operation.Key)
+			events = append(events, Event{Index: index, Type: Put, Namespace: namespace, Key: operation.Key, Value: operation.Value})
+		case Remove:
+			if entry := c.remove(namespace, operation.Key); entry != nil {
+				r.Value = entry.Value
+				r.Entry = entry
+				r.Succeeded = true
+				events = append(events, Event{Index: index, Type: Delete, Namespace: namespace, Key: operation.Key})
+			}
+		}
+		results = append(results, r)
+	}
+	return results, events
+}
@@ -0,0 +1,90 @@
+package distributed
+
+import (
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+func TestTxnComparisons(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("b")})
+	apply(t, c, 2, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("b")})
+	tests := []struct {
+		name       string
+		comparison Comparison
+		expected   bool
+	}{
+		{"value equal", Comparison{Key: "a", Target: TargetValue, Operator: Equal, Value: []byte("b")}, true},
+		{"value greater", Comparison{Key: "a", Target: TargetValue, Operator: Greater, Value: []byte("a")}, true},
+		{"value less", Comparison{Key: "a", Target: TargetValue, Operator: Less, Value: []byte("a")}, false},
+		{"missing value", Comparison{Key: "x", Target: TargetValue, Operator: NotEqual, Value: []byte("b")}, false},
+		{"version", Comparison{Key: "a", Target: TargetVersion, Operator: Equal, Number: 2}, true},
+		{"modification index", Comparison{Key: "a", Target: TargetModIndex, Operator: Less, Number: 2}, false},
+		{"creation index", Comparison{Key: "a", Target: TargetCreateIndex, Operator: Equal, Number: 1}, true},
+		{"size", Comparison{Key: "a", Target: TargetSize, Operator: Greater, Number: 0}, true},
+		{"no lease", Comparison{Key: "a", Target: TargetLease, Operator: Equal, Number: 0}, true},
+		{"missing version", Comparison{Key: "x", Target: TargetVersion, Operator: Equal, Number: 0}, true},
+		{"exists", Comparison{Key: "a", Target: TargetExists, Operator: Equal, Exists: true}, true},
+		{"not exists", Comparison{Key: "x", Target: TargetExists, Operator: Equal, Exists: false}, true},
+		{"exists negated", Comparison{Key: "a", Target: TargetExists, Operator: NotEqual, Exists: true}, false},
+	}
+	for i, test := range tests {
+		result := apply(t, c, uint64(i+3), &Message{
+			Type:        Txn,
+			Namespace:   DefaultNamespace,
+			Comparisons: []Comparison{test.comparison},
+		})
+		if result.Succeeded != test.expected {
+			t.Errorf("%s: expected comparison to be %t", test.name, test.expected)
+		}
+	}
+}
+
+func TestTxnBranches(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte("1")})
+	txn := &Message{
+		Type:      Txn,
+		Namespace: DefaultNamespace,
+		Comparisons: []Comparison{
+			{Key: "a", Target: TargetValue, Operator: Equal, Value: []byte("1")},
+			{Key: "b", Target: TargetExists, Operator: Equal, Exists: false},
+		},
+		Success: []Operation{{Type: Set, Key: "b", Value: []byte("2")}, {Type: Remove, Key: "a"}, {Type: Get, Key: "a"}},
+		Failure: []Operation{{Type: Get, Key: "b"}},
+	}
+	// all comparisons hold: the success operations run in order
+	result := apply(t, c, 2, txn)
+	if !result.Succeeded || len(result.Results) != 3 {
+		t.Fatalf("expected success with 3 results, got %+v", result)
+	}
+	if set, removed, got := result.Results[0], result.Results[1], result.Results[2]; set.Succeeded || !removed.Succeeded || string(removed.Value) != "1" || got.Succeeded {
+		t.Errorf("expected new key set, old one removed and then missing, got %+v, %+v and %+v", set, removed, got)
+	}
+	// one comparison fails: only the failure operations run
+	result = apply(t, c, 3, txn)
+	if result.Succeeded || len(result.Results) != 1 || string(result.Results[0].Value) != "2" {
+		t.Fatalf("expected failure reading the new key, got %+v", result)
+	}
+	if entry, _ := c.Read(DefaultNamespace, "a"); entry != nil {
+		t.Errorf("expected failure branch to leave keys untouched, got %+v", entry)
+	}
+}
+
+func TestTxnSchemaViolation(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	apply(t, c, 1, &Message{Type: SetSchema, Namespace: DefaultNamespace, Key: "n", Value: []byte(`{"type":"number"}`)})
+	// the branch is validated as a whole before anything is changed
+	err := refused(t, c, 2, &Message{
+		Type:      Txn,
+		Namespace: DefaultNamespace,
+		Success:   []Operation{{Type: Set, Key: "a", Value: []byte("1")}, {Type: Set, Key: "n", Value: []byte(`"x"`)}},
+	})
+	if err == nil {
+		t.Fatalf("expected transaction violating a schema to fail")
+	}
+	if entry, _ := c.Read(DefaultNamespace, "a"); entry != nil {
+		t.Errorf("expected failed transaction to leave keys untouched, got %+v", entry)
+	}
+}
@@ -0,0 +1,142 @@
+package distributed
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// HistorySize is the number of recent events retained in memory so
+	// that watchers can resume from a past index.
+	HistorySize = 1024
+	// WatchBufferSize is the number of events that can be queued for a
+	// watcher; slower watchers are dropped and must resume.
+	WatchBufferSize = 128
+)
+
+// ErrCompacted is returned when a watcher asks to resume from an index
+// whose events are no longer available.
+var ErrCompacted = errors.New("requested index has been compacted")
+
+// EventType is the type of change to a key.
+type EventType int8
+
+const (
+	Put EventType = iota
+	Delete
+)
+
+func (t EventType) String() string {
+	return []string{"PUT", "DELETE"}[t]
+}
+
+// Event is a committed change to a key.
+type Event struct {
+	Index     uint64    `json:"index"`
+	Type      EventType `json:"type"`
+	Namespace string    `json:"namespace"`
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value,omitempty"`
+}
+
+// Subscription is an in-process subscription to the changes committed to
+// the context; the Events channel is closed when the subscriber falls too
+// far behind or the subscription is cancelled.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	hub    *hub
+}
+
+// Cancel stops the delivery of events.
+func (s *Subscription) Cancel() {
+	s.hub.mtx.Lock()
+	defer s.hub.mtx.Unlock()
+	if _, ok := s.hub.subscribers[s]; ok {
+		delete(s.hub.subscribers, s)
+		close(s.events)
+	}
+}
+
+// hub keeps the recent history of events and fans them out to the
+// subscribers.
+type hub struct {
+	mtx         sync.Mutex
+	history     []Event
+	compacted   uint64
+	subscribers map[*Subscription]struct{}
+}
+
+func newHub() *hub {
+	return &hub{
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// publish records the events and delivers them to the subscribers.
+func (h *hub) publish(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.history = append(h.history, events...)
+	if len(h.history) > HistorySize {
+		drop := len(h.history) - HistorySize
+		h.compacted = h.history[drop-1].Index
+		h.history = append([]Event{}, h.history[drop:]...)
+	}
+	for s := range h.subscribers {
+		for _, event := range events {
+			select {
+			case s.events <- event:
+			default:
+				// the subscriber is lagging behind: drop it
+				delete(h.subscribers, s)
+				close(s.events)
+			}
+			if _, ok := h.subscribers[s]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// reset discards the history, e.g. after restoring a snapshot taken at the
+// given index.
+func (h *hub) reset(index uint64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.history = nil
+	h.compacted = index
+}
+
+// Watch subscribes to the changes committed to the context, starting with
+// those at the given index if it is not 0, inclusive, so that resuming from
+// the index of the last event received delivers it again; it returns
+// ErrCompacted if some of the events since the given index are no longer
+// available.
+func (c *Context) Watch(from uint64) (*Subscription, []Event, error) {
+	h := c.hub
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	backlog := []Event{}
+	if from > 0 {
+		if from <= h.compacted {
+			return nil, nil, ErrCompacted
+		}
+		for _, event := range h.history {
+			if event.Index >= from {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	events := make(chan Event, WatchBufferSize)
+	s := &Subscription{
+		Events: events,
+		events: events,
+		hub:    h,
+	}
+	h.subscribers[s] = struct{}{}
+	return s, backlog, nil
+}
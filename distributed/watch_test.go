@@ -0,0 +1,96 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	test "github.com/dihedron/rafter/logging/testing"
+)
+
+// indexes returns the indexes of the given events.
+func indexes(events []Event) []uint64 {
+	result := make([]uint64, 0, len(events))
+	for _, event := range events {
+		result = append(result, event.Index)
+	}
+	return result
+}
+
+func TestWatchResume(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	for index := uint64(1); index <= 3; index++ {
+		apply(t, c, index, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte(fmt.Sprint(index))})
+	}
+	// the start index is inclusive, so resuming from the index of the last
+	// event received delivers it again
+	tests := []struct {
+		from     uint64
+		expected string
+	}{
+		{0, "[]"},
+		{1, "[1 2 3]"},
+		{3, "[3]"},
+		{4, "[]"},
+	}
+	for _, test := range tests {
+		s, backlog, err := c.Watch(test.from)
+		if err != nil {
+			t.Fatalf("error watching from %d: %v", test.from, err)
+		}
+		if got := fmt.Sprint(indexes(backlog)); got != test.expected {
+			t.Errorf("expected events %s from %d, got %s", test.expected, test.from, got)
+		}
+		s.Cancel()
+	}
+	// new events follow the backlog
+	s, _, _ := c.Watch(4)
+	defer s.Cancel()
+	apply(t, c, 4, &Message{Type: Remove, Namespace: DefaultNamespace, Key: "a"})
+	if event := <-s.Events; event.Index != 4 || event.Type != Delete || event.Key != "a" {
+		t.Errorf("expected deletion of 'a' at 4, got %+v", event)
+	}
+}
+
+func TestWatchCompaction(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	for index := uint64(1); index <= HistorySize+2; index++ {
+		apply(t, c, index, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte(fmt.Sprint(index))})
+	}
+	// the two oldest events no longer fit in the history
+	for _, from := range []uint64{1, 2} {
+		if _, _, err := c.Watch(from); !errors.Is(err, ErrCompacted) {
+			t.Errorf("expected watching from %d to fail as compacted, got %v", from, err)
+		}
+	}
+	s, backlog, err := c.Watch(3)
+	if err != nil {
+		t.Fatalf("error watching from the oldest event: %v", err)
+	}
+	s.Cancel()
+	if len(backlog) != HistorySize || backlog[0].Index != 3 {
+		t.Errorf("expected the whole history from 3, got %d events", len(backlog))
+	}
+	// watchers cannot resume from before a restored snapshot
+	c.hub.reset(HistorySize + 2)
+	if _, _, err := c.Watch(HistorySize + 2); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected watching from before the reset to fail as compacted, got %v", err)
+	}
+}
+
+func TestWatchLagging(t *testing.T) {
+	c := NewContext(test.NewLogger(t))
+	s, _, _ := c.Watch(0)
+	for index := uint64(1); index <= WatchBufferSize+1; index++ {
+		apply(t, c, index, &Message{Type: Set, Namespace: DefaultNamespace, Key: "a", Value: []byte(fmt.Sprint(index))})
+	}
+	// a watcher that falls behind is dropped once its buffer is full
+	received := 0
+	for range s.Events {
+		received++
+	}
+	if received != WatchBufferSize {
+		t.Errorf("expected %d events before the watcher was dropped, got %d", WatchBufferSize, received)
+	}
+	s.Cancel()
+}
@@ -0,0 +1,175 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dihedron/rafter/unmarshal"
+)
+
+// Sealed is the leading byte of data encrypted by a keyring; it is followed
+// by the length and the ID of the key, the nonce and the ciphertext. It
+// cannot be the first byte of a log entry or of a JSON document, so that
+// plaintext written before encryption was enabled can still be read.
+const Sealed byte = 0xE1
+
+// ErrNoKeyring is returned when reading encrypted data without a keyring.
+var ErrNoKeyring = errors.New("data is encrypted, but no key file was provided")
+
+// File is the content of a key file, either JSON or YAML: the keys are
+// base64-encoded, 16, 24 or 32 bytes long for AES-128, AES-192 and AES-256
+// respectively, and the active one is used to encrypt new data.
+type File struct {
+	Active string `json:"active" yaml:"active"`
+	Keys   []struct {
+		ID  string `json:"id" yaml:"id"`
+		Key string `json:"key" yaml:"key"`
+	} `json:"keys" yaml:"keys"`
+}
+
+// Keyring holds the keys used to encrypt data at rest with AES-GCM, by ID;
+// data is always encrypted with the active key, and can be decrypted with
+// any key in the ring, so that keys can be rotated while older data is
+// still around. A nil keyring leaves data in plaintext.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// Load reads a keyring from a JSON or YAML key file.
+func Load(path string) (*Keyring, error) {
+	file := &File{}
+	if err := unmarshal.FromFlag("@"+path, file); err != nil {
+		return nil, fmt.Errorf("error reading key file '%s': %w", path, err)
+	}
+	keys := map[string][]byte{}
+	for _, key := range file.Keys {
+		value, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding of key '%s' in key file '%s': %w", key.ID, path, err)
+		}
+		keys[key.ID] = value
+	}
+	return New(file.Active, keys)
+}
+
+// New creates a keyring out of the given keys, by ID.
+func New(active string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{
+		active: active,
+		keys:   map[string]cipher.AEAD{},
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key ID '%s': must be between 1 and 255 bytes long", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key '%s': %w", id, err)
+		}
+		if k.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("invalid key '%s': %w", id, err)
+		}
+	}
+	if _, ok := k.keys[active]; !ok {
+		return nil, fmt.Errorf("active key '%s' not found", active)
+	}
+	return k, nil
+}
+
+// Active returns the ID of the key used to encrypt new data.
+func (k *Keyring) Active() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// IDs returns the IDs of all the keys in the ring, in order.
+func (k *Keyring) IDs() []string {
+	if k == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Seal encrypts data with the active key; a nil keyring returns the data
+// unchanged.
+func (k *Keyring) Seal(data []byte) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+	aead := k.keys[k.active]
+	header := make([]byte, 0, 2+len(k.active)+aead.NonceSize())
+	header = append(header, Sealed, byte(len(k.active)))
+	header = append(header, k.active...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	header = append(header, nonce...)
+	return aead.Seal(header, nonce, data, header[:2+len(k.active)]), nil
+}
+
+// Open decrypts data sealed with any key in the ring; data that was not
+// sealed is returned unchanged.
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != Sealed {
+		return data, nil
+	}
+	aead, rest, err := k.key(data[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], data[:len(data)-len(rest)])
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsSealed tells whether data was encrypted by a keyring, and with which
+// key.
+func IsSealed(data []byte) (string, bool) {
+	if len(data) < 2 || data[0] != Sealed || len(data) < 2+int(data[1]) {
+		return "", false
+	}
+	return string(data[2 : 2+int(data[1])]), true
+}
+
+// key reads the ID of a key, prefixed by its length, and returns the key
+// along with the data that follows it.
+func (k *Keyring) key(data []byte) (cipher.AEAD, []byte, error) {
+	if k == nil {
+		return nil, nil, ErrNoKeyring
+	}
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, nil, fmt.Errorf("encrypted data is truncated")
+	}
+	id := string(data[1 : 1+int(data[0])])
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("data is encrypted with unknown key '%s'", id)
+	}
+	return aead, data[1+int(data[0]):], nil
+}
+
+// sealed tells whether the given prefix of a stream matches the header of
+// an encrypted stream.
+func sealed(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, magic)
+}
@@ -0,0 +1,100 @@
+package encryption
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// keyring returns a keyring holding a key derived from each of the given
+// IDs, the first of which is the active one.
+func keyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+	keys := map[string][]byte{}
+	for _, id := range ids {
+		keys[id] = []byte(strings.Repeat(id, 32)[:32])
+	}
+	k, err := New(ids[0], keys)
+	if err != nil {
+		t.Fatalf("error creating keyring: %v", err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	plaintext := []byte(`{"key":"value"}`)
+	sealed, err := keyring(t, "old").Seal(plaintext)
+	if err != nil {
+		t.Fatalf("error sealing data: %v", err)
+	}
+	if id, ok := IsSealed(sealed); !ok || id != "old" {
+		t.Fatalf("expected data sealed with key 'old', got '%s' (%t)", id, ok)
+	}
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	header := append([]byte{}, sealed...)
+	header[3] = 'x'
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		data    []byte
+		want    []byte
+		err     string
+	}{
+		{"sealed", keyring(t, "old"), sealed, plaintext, ""},
+		{"rotated key", keyring(t, "new", "old"), sealed, plaintext, ""},
+		{"plaintext", keyring(t, "old"), plaintext, plaintext, ""},
+		{"plaintext without keyring", nil, plaintext, plaintext, ""},
+		{"empty", keyring(t, "old"), []byte{}, []byte{}, ""},
+		{"without keyring", nil, sealed, nil, ErrNoKeyring.Error()},
+		{"wrong key ID", keyring(t, "new"), sealed, nil, "unknown key 'old'"},
+		{"tampered ciphertext", keyring(t, "old"), tampered, nil, "error decrypting data"},
+		{"tampered key ID", keyring(t, "old", "oxd"), header, nil, "error decrypting data"},
+		{"truncated key ID", keyring(t, "old"), sealed[:3], nil, "truncated"},
+		{"truncated nonce", keyring(t, "old"), sealed[:8], nil, "truncated"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.keyring.Open(test.data)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error opening data: %v", err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("expected '%s', got '%s'", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		active string
+		keys   map[string][]byte
+		err    string
+	}{
+		{"valid", "a", map[string][]byte{"a": make([]byte, 16), "b": make([]byte, 24)}, ""},
+		{"missing active key", "c", map[string][]byte{"a": make([]byte, 16)}, "active key 'c' not found"},
+		{"empty key ID", "a", map[string][]byte{"a": make([]byte, 16), "": make([]byte, 16)}, "invalid key ID"},
+		{"long key ID", "a", map[string][]byte{"a": make([]byte, 16), strings.Repeat("x", 256): make([]byte, 16)}, "invalid key ID"},
+		{"invalid key size", "a", map[string][]byte{"a": make([]byte, 10)}, "invalid key 'a'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.active, test.keys)
+			if test.err == "" && err != nil {
+				t.Fatalf("error creating keyring: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
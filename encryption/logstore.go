@@ -0,0 +1,59 @@
+package encryption
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// LogStore encrypts the data of the Raft log entries it stores in an
+// underlying store, and decrypts it when they are read back; entries
+// written before encryption was enabled are read as they are.
+type LogStore struct {
+	raft.LogStore
+	keyring *Keyring
+}
+
+var _ raft.LogStore = &LogStore{}
+
+// NewLogStore wraps a Raft log store so that entries are encrypted with the
+// given keyring.
+func NewLogStore(store raft.LogStore, keyring *Keyring) *LogStore {
+	return &LogStore{LogStore: store, keyring: keyring}
+}
+
+// GetLog gets a log entry at a given index, decrypting its data.
+func (s *LogStore) GetLog(index uint64, log *raft.Log) error {
+	if err := s.LogStore.GetLog(index, log); err != nil {
+		return err
+	}
+	data, err := s.keyring.Open(log.Data)
+	if err != nil {
+		return fmt.Errorf("error decrypting log entry at index %d: %w", index, err)
+	}
+	log.Data = data
+	return nil
+}
+
+// StoreLog stores a log entry, encrypting its data.
+func (s *LogStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores multiple log entries, encrypting their data; the entries
+// are copied, since Raft keeps using them after they are stored.
+func (s *LogStore) StoreLogs(logs []*raft.Log) error {
+	sealed := make([]*raft.Log, 0, len(logs))
+	for _, log := range logs {
+		copy := *log
+		if len(log.Data) > 0 {
+			data, err := s.keyring.Seal(log.Data)
+			if err != nil {
+				return fmt.Errorf("error encrypting log entry at index %d: %w", log.Index, err)
+			}
+			copy.Data = data
+		}
+		sealed = append(sealed, &copy)
+	}
+	return s.LogStore.StoreLogs(sealed)
+}
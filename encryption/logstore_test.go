@@ -0,0 +1,55 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestLogStore(t *testing.T) {
+	inner := raft.NewInmemStore()
+	// an entry written before encryption was enabled
+	if err := inner.StoreLog(&raft.Log{Index: 1, Data: []byte("plain")}); err != nil {
+		t.Fatalf("error storing log entry: %v", err)
+	}
+	store := NewLogStore(inner, keyring(t, "key"))
+	logs := []*raft.Log{
+		{Index: 2, Data: []byte("first")},
+		{Index: 3, Type: raft.LogNoop},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("error storing log entries: %v", err)
+	}
+	if err := store.StoreLog(&raft.Log{Index: 4, Data: []byte("second")}); err != nil {
+		t.Fatalf("error storing log entry: %v", err)
+	}
+	if string(logs[0].Data) != "first" {
+		t.Errorf("expected entries passed in to be left unchanged, got %q", logs[0].Data)
+	}
+
+	log := &raft.Log{}
+	if err := inner.GetLog(2, log); err != nil {
+		t.Fatalf("error reading log entry: %v", err)
+	}
+	if id, ok := IsSealed(log.Data); !ok || id != "key" || bytes.Contains(log.Data, []byte("first")) {
+		t.Errorf("expected entry to be stored encrypted with 'key', got %q", log.Data)
+	}
+	for index, want := range map[uint64]string{1: "plain", 2: "first", 3: "", 4: "second"} {
+		log := &raft.Log{}
+		if err := store.GetLog(index, log); err != nil {
+			t.Fatalf("error reading log entry %d: %v", index, err)
+		}
+		if string(log.Data) != want || log.Index != index {
+			t.Errorf("expected entry %d to hold %q, got %q at index %d", index, want, log.Data, log.Index)
+		}
+	}
+
+	// entries cannot be read without the key they were encrypted with
+	if err := NewLogStore(inner, keyring(t, "other")).GetLog(2, log); err == nil {
+		t.Errorf("expected entry encrypted with another key not to be read")
+	}
+	if err := NewLogStore(inner, nil).GetLog(2, log); err == nil {
+		t.Errorf("expected entry not to be read without a keyring")
+	}
+}
@@ -0,0 +1,212 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// magic is the leading sequence of an encrypted stream; it is followed by
+// the length and the ID of the key and the base nonce, and then by chunks
+// of ciphertext, each prefixed by its length. The nonce of each chunk is
+// the base nonce XORed with the chunk's sequence number, and the last chunk
+// is authenticated as such, so that truncated streams are detected.
+var magic = []byte{Sealed, 'R', 'F', 'T', 'S', 1}
+
+// ChunkSize is the size of the plaintext in each chunk of an encrypted
+// stream.
+const ChunkSize = 64 * 1024
+
+// Writer returns a writer that encrypts what is written to it with the
+// active key before passing it on to w; it must be closed to write the
+// last chunk, which does not close w. A nil keyring writes plaintext.
+func (k *Keyring) Writer(w io.Writer) (io.WriteCloser, error) {
+	if k == nil {
+		return nopCloser{w}, nil
+	}
+	aead := k.keys[k.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	header := append([]byte{}, magic...)
+	header = append(header, byte(len(k.active)))
+	header = append(header, k.active...)
+	header = append(header, nonce...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, nonce: nonce, buffer: make([]byte, 0, ChunkSize)}, nil
+}
+
+// Reader returns a reader that decrypts the stream read from r with the
+// key it was encrypted with; streams that were not encrypted are read as
+// they are.
+func (k *Keyring) Reader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(len(magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !sealed(prefix) {
+		return br, nil
+	}
+	br.Discard(len(magic))
+	length, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("error reading encrypted stream header: %w", err)
+	}
+	header := make([]byte, 1+int(length))
+	header[0] = length
+	if _, err := io.ReadFull(br, header[1:]); err != nil {
+		return nil, fmt.Errorf("error reading encrypted stream header: %w", err)
+	}
+	aead, _, err := k.key(header)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, fmt.Errorf("error reading encrypted stream header: %w", err)
+	}
+	return &reader{r: br, aead: aead, nonce: nonce}, nil
+}
+
+// KeyOf returns the ID of the key an encrypted stream was encrypted with,
+// reading its header off r.
+func KeyOf(r io.Reader) (string, bool, error) {
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	if !sealed(header) {
+		return "", false, nil
+	}
+	id := make([]byte, header[len(magic)])
+	if _, err := io.ReadFull(r, id); err != nil {
+		return "", false, fmt.Errorf("error reading encrypted stream header: %w", err)
+	}
+	return string(id), true, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// chunkNonce returns the nonce of the chunk with the given sequence number.
+func chunkNonce(base []byte, sequence uint64) []byte {
+	nonce := append([]byte{}, base...)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], sequence)
+	for i := range counter {
+		nonce[len(nonce)-8+i] ^= counter[i]
+	}
+	return nonce
+}
+
+// additional data authenticating whether a chunk is the last one.
+var (
+	more = []byte{0}
+	last = []byte{1}
+)
+
+type writer struct {
+	w        io.Writer
+	aead     cipher.AEAD
+	nonce    []byte
+	sequence uint64
+	buffer   []byte
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buffer[len(w.buffer):cap(w.buffer)], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+		// the last chunk is only written on close, and may be full
+		if len(w.buffer) == cap(w.buffer) && len(p) > 0 {
+			if err := w.flush(more); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	return w.flush(last)
+}
+
+func (w *writer) flush(data []byte) error {
+	chunk := w.aead.Seal(nil, chunkNonce(w.nonce, w.sequence), w.buffer, data)
+	w.sequence++
+	w.buffer = w.buffer[:0]
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(chunk)))
+	if _, err := w.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(chunk)
+	return err
+}
+
+type reader struct {
+	r        io.Reader
+	aead     cipher.AEAD
+	nonce    []byte
+	sequence uint64
+	buffer   []byte
+	done     bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.buffer) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next chunk.
+func (r *reader) next() error {
+	var length [4]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return fmt.Errorf("encrypted stream is truncated: %w", err)
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > ChunkSize+uint32(r.aead.Overhead()) {
+		return fmt.Errorf("invalid chunk size in encrypted stream: %d", size)
+	}
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(r.r, chunk); err != nil {
+		return fmt.Errorf("encrypted stream is truncated: %w", err)
+	}
+	nonce := chunkNonce(r.nonce, r.sequence)
+	r.sequence++
+	plaintext, err := r.aead.Open(nil, nonce, chunk, more)
+	if err != nil {
+		if plaintext, err = r.aead.Open(nil, nonce, chunk, last); err != nil {
+			return fmt.Errorf("error decrypting chunk %d of encrypted stream: %w", r.sequence-1, err)
+		}
+		r.done = true
+	}
+	r.buffer = plaintext
+	return nil
+}
@@ -0,0 +1,123 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// encrypt writes data to an encrypted stream, and returns the stream.
+func encrypt(t *testing.T, k *Keyring, data []byte) []byte {
+	t.Helper()
+	stream := &bytes.Buffer{}
+	w, err := k.Writer(stream)
+	if err != nil {
+		t.Fatalf("error creating writer: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing writer: %v", err)
+	}
+	return stream.Bytes()
+}
+
+// chunks splits an encrypted stream into its header and its chunks, each
+// with its length prefix.
+func chunks(t *testing.T, k *Keyring, stream []byte) ([]byte, [][]byte) {
+	t.Helper()
+	offset := len(magic) + 1 + int(stream[len(magic)]) + k.keys[k.active].NonceSize()
+	header, result := stream[:offset], [][]byte{}
+	for offset < len(stream) {
+		size := 4 + int(binary.BigEndian.Uint32(stream[offset:]))
+		result = append(result, stream[offset:offset+size])
+		offset += size
+	}
+	return header, result
+}
+
+// decrypt reads an encrypted stream back.
+func decrypt(k *Keyring, stream []byte) ([]byte, error) {
+	r, err := k.Reader(bytes.NewReader(stream))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	k := keyring(t, "key")
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3 * ChunkSize} {
+		data := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+		stream := encrypt(t, k, data)
+		if id, ok, err := KeyOf(bytes.NewReader(stream)); err != nil || !ok || id != "key" {
+			t.Errorf("expected stream of %d bytes encrypted with 'key', got '%s' (%t, %v)", size, id, ok, err)
+		}
+		got, err := decrypt(keyring(t, "new", "key"), stream)
+		if err != nil {
+			t.Fatalf("error decrypting stream of %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("stream of %d bytes decrypted to %d different bytes", size, len(got))
+		}
+	}
+}
+
+func TestStreamPlaintext(t *testing.T) {
+	data := []byte(`{"key":"value"}`)
+	var k *Keyring
+	stream := encrypt(t, k, data)
+	if !bytes.Equal(stream, data) {
+		t.Fatalf("expected nil keyring to write plaintext, got %q", stream)
+	}
+	if _, ok, err := KeyOf(bytes.NewReader(stream)); ok || err != nil {
+		t.Errorf("expected plaintext not to be encrypted, got %t (%v)", ok, err)
+	}
+	for _, k := range []*Keyring{nil, keyring(t, "key")} {
+		if got, err := decrypt(k, stream); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("expected plaintext to be read as it is, got %q (%v)", got, err)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	k := keyring(t, "key")
+	header, parts := chunks(t, k, encrypt(t, k, bytes.Repeat([]byte("x"), 2*ChunkSize+1)))
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(parts))
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{header}, parts...), nil)
+	}
+	flipped := append([]byte{}, parts[1]...)
+	flipped[len(flipped)-1] ^= 1
+	last := parts[2]
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		stream  []byte
+		err     string
+	}{
+		{"without last chunk", k, join(parts[0], parts[1]), "truncated"},
+		{"truncated last chunk", k, join(parts[0], parts[1], last[:len(last)-1]), "truncated"},
+		{"without length of last chunk", k, join(parts[0], parts[1], last[:2]), "truncated"},
+		{"last chunk first", k, join(last), "error decrypting chunk 0"},
+		{"reordered chunks", k, join(parts[1], parts[0], last), "error decrypting chunk 0"},
+		{"repeated chunk", k, join(parts[0], parts[0], parts[1], last), "error decrypting chunk 1"},
+		{"tampered chunk", k, join(parts[0], flipped, last), "error decrypting chunk 1"},
+		{"truncated header", k, header[:len(header)-1], "header"},
+		{"wrong key ID", keyring(t, "other"), join(parts...), "unknown key 'key'"},
+		{"without keyring", nil, join(parts...), ErrNoKeyring.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := decrypt(test.keyring, test.stream); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}